@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+)
+
+type (
+	/*
+		instant is the one time a command runs at, the lots it works on are viewed at it, see LotService.lotAt.
+
+		It is the first time its clock tells while the command runs, or the time a journaled command was first applied at.
+		Each command has its own, carried by its context, so commands running side by side keep their own time.
+	*/
+	instant struct {
+		mu    sync.Mutex
+		clock pm.Clock
+		at    time.Time
+		told  bool
+	}
+
+	// toldClock tells the time of its clock and remembers the time it told last, see LotService.record.
+	toldClock struct {
+		mu    sync.Mutex
+		clock pm.Clock
+		at    time.Time
+	}
+
+	// instantKey is the context key of the instant of a command.
+	instantKey struct{}
+
+	// instantCommand runs its command at one instant of the clock of the lot service.
+	instantCommand struct {
+		lotService  *LotService
+		command     Commander
+		commandLine string // as entered, see LotService.Undo
+	}
+)
+
+func (tc *toldClock) Now() time.Time {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.at = tc.clock.Now()
+	return tc.at
+}
+
+// the time told last without moving the clock on, zero before it is first told
+func (tc *toldClock) lastTold() time.Time {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	return tc.at
+}
+
+// the instant the given clock tells first, it is only read once needed
+func newInstant(clock pm.Clock) *instant {
+	return &instant{clock: clock}
+}
+
+// an instant stopped at the given time
+func instantAt(at time.Time) *instant {
+	return &instant{at: at, told: true}
+}
+
+func (in *instant) Now() time.Time {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if !in.told {
+		in.at, in.told = in.clock.Now(), true
+	}
+	return in.at
+}
+
+// the time of the instant, unless it is not told yet
+func (in *instant) toldAt() (time.Time, bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	return in.at, in.told
+}
+
+// the context of a command running at the instant
+func withInstant(ctx context.Context, in *instant) context.Context {
+	return context.WithValue(ctx, instantKey{}, in)
+}
+
+// the instant the command of the context runs at, the clock of the service when it runs outside of a command
+func (ls *LotService) instantOf(ctx context.Context) pm.Clock {
+	if in, ok := ctx.Value(instantKey{}).(*instant); ok {
+		return in
+	}
+	return ls.clock
+}
+
+// the context itself when it carries the instant of a command, otherwise the context of one running at the next time the clock tells
+func (ls *LotService) atOneInstant(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(instantKey{}).(*instant); ok {
+		return ctx
+	}
+	return withInstant(ctx, newInstant(ls.clock))
+}
+
+// the lot as the command of the context works on it, telling the instant of the command and tagging its events with its change
+func (ls *LotService) lotAt(ctx context.Context, parkingLot *pm.ParkingLot) *pm.ParkingLot {
+	return parkingLot.View(ls.instantOf(ctx)).Tagged(changeOf(ctx))
+}
+
+func (ic *instantCommand) Execute(ctx context.Context) error {
+	return ic.lotService.execute(withInstant(ctx, newInstant(ic.lotService.clock)), ic.command, ic.commandLine)
+}
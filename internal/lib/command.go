@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	pm "github.com/ilivestrong/internal/lib/parking_manager"
 )
@@ -22,27 +24,72 @@ const (
 	TokenForQueryRegistrationNoByColor  = "registration_numbers_for_cars_with_color"
 	TokenForQuerySlotNoByRegistrationNo = "slot_number_for_registration_number"
 	TokenForQuerySlotNoByColor          = "slot_numbers_for_cars_with_color"
+	TokenForUseLot                      = "use_lot"
+	TokenForQueryLotByRegistrationNo    = "lot_for_registration_number"
+	TokenForQueryFeeByRegistrationNo    = "fee_for_registration_number"
+	TokenForLeaveByTicket               = "leave_by_ticket"
+	TokenForTicketInfo                  = "ticket_info"
+	TokenForLeaveByRegistrationNo       = "leave_by_registration_number"
+	TokenForReserve                     = "reserve"
+	TokenForWaitlist                    = "waitlist"
+	TokenForCancelWaitlist              = "cancel_waitlist"
+	TokenForTagSlot                     = "tag_slot"
+	TokenForParkAt                      = "park_at"
+	TokenForSaveSnapshot                = "save_snapshot"
+	TokenForLoadSnapshot                = "load_snapshot"
+	TokenForHistoryForRegistrationNo    = "history_for_registration_number"
+	TokenForHistoryForSlot              = "history_for_slot"
+	TokenForUndo                        = "undo"
+	TokenForRedo                        = "redo"
+	TokenForBegin                       = "begin"
+	TokenForCommit                      = "commit"
+	TokenForRollback                    = "rollback"
 
-	MaxNumberOfSlots = 20000
+	timeLayout = "2006-01-02 15:04"
+
+	// the times of a reservation window, either a date and a time or a time of today
+	windowTimeLayout  = "2006-01-02T15:04"
+	windowClockLayout = "15:04"
 )
 
 var (
 	ErrCreateParkingLotCommandMissing = errors.New("invalid input file, require 'create_parking_lot' as the first command")
 	ErrInvalidCreateParkingLotCommand = errors.New("invalid 'create_parking_lot' command")
 	ErrInvalidInputFile               = errors.New("invalid input file")
-	ErrMaxSlotExceeded                = fmt.Errorf("max slots available: %d", MaxNumberOfSlots)
+	ErrMaxSlotExceeded                = errors.New("max slots exceeded")
 )
 
 var (
-	parkingLot       *pm.ParkingLot
 	commandsWithArgs map[string]int = map[string]int{
 		TokenForCreateParkingLot:            1,
 		TokenForPark:                        2,
 		TokenForLeave:                       1,
 		TokenForQueryRegistrationNoByColor:  1,
 		TokenForQuerySlotNoByRegistrationNo: 1,
+		TokenForQuerySlotNoByColor:          1,
+		TokenForUseLot:                      1,
+		TokenForQueryLotByRegistrationNo:    1,
+		TokenForQueryFeeByRegistrationNo:    1,
+		TokenForLeaveByTicket:               1,
+		TokenForTicketInfo:                  1,
+		TokenForLeaveByRegistrationNo:       1,
+		TokenForReserve:                     3,
+		TokenForCancelWaitlist:              1,
+		TokenForTagSlot:                     2,
+		TokenForParkAt:                      3,
+		TokenForSaveSnapshot:                1,
+		TokenForLoadSnapshot:                1,
+		TokenForHistoryForRegistrationNo:    1,
+		TokenForHistoryForSlot:              1,
+	}
+
+	// the flags a command takes besides --lot, which every command takes
+	commandFlags = map[string][]string{
+		TokenForCreateParkingLot: {"fill-order", "strategy", "seed", "gates"},
+		TokenForPark:             {"needs", "gate"},
+		TokenForParkAt:           {"needs"},
+		TokenForStatus:           {"times"},
 	}
-	newlineOrNothing = "\n"
 )
 
 type (
@@ -50,36 +97,137 @@ type (
 		Execute(ctx context.Context) error
 	}
 
+	// commandEnv is shared by every command built by the same CommandBuilder.
+	commandEnv struct {
+		lotService       *LotService
+		owriter          *bufio.Writer
+		newlineOrNothing string
+		lotName          string // the lot given with --lot, the active lot when empty
+	}
+
 	CreateParkingLotCommand struct {
-		capacity int
-		owriter  *bufio.Writer
+		commandEnv
+		reversible
+		layout  pm.Layout
+		options []pm.Option
+		seed    string // drawn for a random strategy given without a seed, journaled so a replay draws the same slots
 	}
 	ParkCommand struct {
+		commandEnv
+		reversible
+		vehicle *pm.Vehicle
+		gate    string // nearest slot to the gate, when given
+	}
+	ParkAtCommand struct {
+		commandEnv
+		reversible
+		slot    string // number or label, resolved against the lot on execute
 		vehicle *pm.Vehicle
-		owriter *bufio.Writer
 	}
 	LeaveCommand struct {
-		slot    int
-		owriter *bufio.Writer
+		commandEnv
+		reversible
+		slot string // number or label, resolved against the lot on execute
 	}
 	StatusCommand struct {
-		owriter *bufio.Writer
+		commandEnv
+		showTimes bool // adds the Since and Duration columns
 	}
 	QueryRegistrationNoByColorCommand struct {
-		color   string
-		owriter *bufio.Writer
+		commandEnv
+		color string
 	}
 	QuerySlotNoByRegistrationNoCommand struct {
+		commandEnv
 		registrationNo string
-		owriter        *bufio.Writer
 	}
 	QuerySlotNoByColorCommand struct {
-		color   string
-		owriter *bufio.Writer
+		commandEnv
+		color string
+	}
+	UseLotCommand struct {
+		commandEnv
+		reversible
+		name string
+	}
+	QueryLotByRegistrationNoCommand struct {
+		commandEnv
+		registrationNo string
+	}
+	QueryFeeByRegistrationNoCommand struct {
+		commandEnv
+		registrationNo string
+	}
+	LeaveByTicketCommand struct {
+		commandEnv
+		reversible
+		ticketID string
+	}
+	TicketInfoCommand struct {
+		commandEnv
+		ticketID string
+	}
+	LeaveByRegistrationNoCommand struct {
+		commandEnv
+		reversible
+		registrationNo string
+	}
+	WaitlistCommand struct {
+		commandEnv
+	}
+	CancelWaitlistCommand struct {
+		commandEnv
+		reversible
+		registrationNo string
+	}
+	TagSlotCommand struct {
+		commandEnv
+		reversible
+		slot       string
+		attributes pm.SlotAttributes
+	}
+	SaveSnapshotCommand struct {
+		commandEnv
+		fileName string
+	}
+	LoadSnapshotCommand struct {
+		commandEnv
+		fileName string
+	}
+	HistoryForRegistrationNoCommand struct {
+		commandEnv
+		registrationNo string
+	}
+	UndoCommand struct {
+		commandEnv
+	}
+	RedoCommand struct {
+		commandEnv
+	}
+	BeginCommand struct {
+		commandEnv
+	}
+	CommitCommand struct {
+		commandEnv
+	}
+	RollbackCommand struct {
+		commandEnv
+	}
+	HistoryForSlotCommand struct {
+		commandEnv
+		slot string // number or label, resolved against the lot on execute
+	}
+	ReserveCommand struct {
+		commandEnv
+		reversible
+		registrationNo string
+		vehicleType    pm.VehicleType
+		from           string // resolved against the clock of the lot on execute
+		to             string
 	}
 
 	CommandBuilder struct {
-		owriter *bufio.Writer
+		commandEnv
 	}
 )
 
@@ -87,20 +235,57 @@ type (
 Instantiates a command builder object.
 
 It allows to parse command(s) individually or in bulk.
+All the commands built by it operate on the parking lot owned by the given lot service.
 */
-func NewCommandBuilder(mode string, oWriter *bufio.Writer) *CommandBuilder {
+func NewCommandBuilder(mode string, oWriter *bufio.Writer, lotService *LotService) *CommandBuilder {
+	newlineOrNothing := "\n"
 	if mode == "interactive" {
 		newlineOrNothing = ""
 	}
-	return &CommandBuilder{owriter: oWriter}
+	return &CommandBuilder{
+		commandEnv: commandEnv{
+			lotService:       lotService,
+			owriter:          oWriter,
+			newlineOrNothing: newlineOrNothing,
+		},
+	}
 }
 
 /*
 Parses command tokens and their args and returns a concrete Command object.
 
 The returned command object is used to execute the command on-demand.
+When the lot service keeps a journal, the commands changing the lots are journaled as they are executed.
 */
 func (cb *CommandBuilder) ParseCommand(commandName string, args ...string) Commander {
+	command := cb.parseCommand(commandName, args...)
+	if command == nil {
+		return nil
+	}
+	if !journaledCommands[commandName] || !cb.lotService.isJournaling() {
+		return &instantCommand{lotService: cb.lotService, command: command, commandLine: commandLine(commandName, args)}
+	}
+	if createCmd, ok := command.(*CreateParkingLotCommand); ok && createCmd.seed != "" {
+		args = append(slices.Clip(args), "--seed", createCmd.seed)
+	}
+	return &journaledCommand{
+		commandEnv: cb.commandEnv,
+		command:    command,
+		name:       commandName,
+		args:       args,
+	}
+}
+
+func (cb *CommandBuilder) parseCommand(commandName string, args ...string) Commander {
+	// any command can be run against a specific lot with --lot <name>
+	args, flags, err := splitFlags(args, append(commandFlags[commandName], "lot")...)
+	if err != nil {
+		writeToOutput(cb.owriter, fmt.Sprintf("\n%s\n", err))
+		return nil
+	}
+	env := cb.commandEnv
+	env.lotName = flags["lot"]
+
 	if argsCount, ok := commandsWithArgs[commandName]; ok && commandName != "" && len(args) < argsCount {
 		writeToOutput(cb.owriter, fmt.Sprintf("\nargs missing for command: %s\n", commandName))
 		return nil
@@ -108,41 +293,203 @@ func (cb *CommandBuilder) ParseCommand(commandName string, args ...string) Comma
 
 	switch commandName {
 	case TokenForCreateParkingLot:
-		capacity, err := strconv.Atoi(args[0])
+		options, drawnSeed := make([]pm.Option, 0), ""
+		if value, ok := flags["fill-order"]; ok {
+			levelOrder, err := pm.ParseLevelOrder(value)
+			if err != nil {
+				writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid fill order: %s\n", value))
+				return nil
+			}
+			options = append(options, pm.WithLevelOrder(levelOrder))
+		}
+		if name, ok := flags["strategy"]; ok {
+			// a random strategy without a seed differs from run to run
+			seed := time.Now().UnixNano()
+			if value, ok := flags["seed"]; ok {
+				if seed, err = strconv.ParseInt(value, 10, 64); err != nil {
+					writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid seed: %s\n", value))
+					return nil
+				}
+			} else {
+				drawnSeed = strconv.FormatInt(seed, 10)
+			}
+			strategy, err := pm.NewAllocationStrategy(name, seed)
+			if err != nil {
+				writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid allocation strategy: %s\n", name))
+				return nil
+			}
+			options = append(options, pm.WithAllocationStrategy(strategy))
+		}
+
+		layout, err := parseLayout(args)
 		if err != nil {
 			writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid args provided for command: %s", commandName))
 		}
+		if fileName, ok := flags["gates"]; ok && err == nil {
+			gates, err := loadGates(fileName, layout.Capacity())
+			if err != nil {
+				writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid gates: %s\n", err))
+				return nil
+			}
+			options = append(options, pm.WithGates(gates...))
+		}
 		return &CreateParkingLotCommand{
-			capacity: capacity,
-			owriter:  cb.owriter,
+			commandEnv: env,
+			layout:     layout,
+			options:    options,
+			seed:       drawnSeed,
 		}
 	case TokenForPark:
+		vehicle, ok := cb.parseVehicle(commandName, args, flags)
+		if !ok {
+			return nil
+		}
 		return &ParkCommand{
-			vehicle: pm.NewVehicle(args[0], args[1]),
-			owriter: cb.owriter,
+			commandEnv: env,
+			vehicle:    vehicle,
+			gate:       flags["gate"],
+		}
+	case TokenForParkAt:
+		vehicle, ok := cb.parseVehicle(commandName, args[1:], flags)
+		if !ok {
+			return nil
+		}
+		return &ParkAtCommand{
+			commandEnv: env,
+			slot:       args[0],
+			vehicle:    vehicle,
 		}
 	case TokenForLeave:
-		slot, _ := strconv.Atoi(args[0])
 		return &LeaveCommand{
-			slot:    slot,
-			owriter: cb.owriter,
+			commandEnv: env,
+			slot:       args[0],
 		}
 	case TokenForStatus:
-		return &StatusCommand{owriter: cb.owriter}
+		_, showTimes := flags["times"]
+		return &StatusCommand{
+			commandEnv: env,
+			showTimes:  showTimes,
+		}
 	case TokenForQueryRegistrationNoByColor:
 		return &QueryRegistrationNoByColorCommand{
-			color:   args[0],
-			owriter: cb.owriter,
+			commandEnv: env,
+			color:      args[0],
 		}
 	case TokenForQuerySlotNoByRegistrationNo:
 		return &QuerySlotNoByRegistrationNoCommand{
+			commandEnv:     env,
 			registrationNo: args[0],
-			owriter:        cb.owriter,
 		}
 	case TokenForQuerySlotNoByColor:
 		return &QuerySlotNoByColorCommand{
-			color:   args[0],
-			owriter: cb.owriter,
+			commandEnv: env,
+			color:      args[0],
+		}
+	case TokenForUseLot:
+		return &UseLotCommand{
+			commandEnv: env,
+			name:       args[0],
+		}
+	case TokenForQueryLotByRegistrationNo:
+		return &QueryLotByRegistrationNoCommand{
+			commandEnv:     env,
+			registrationNo: args[0],
+		}
+	case TokenForQueryFeeByRegistrationNo:
+		return &QueryFeeByRegistrationNoCommand{
+			commandEnv:     env,
+			registrationNo: args[0],
+		}
+	case TokenForLeaveByTicket:
+		return &LeaveByTicketCommand{
+			commandEnv: env,
+			ticketID:   args[0],
+		}
+	case TokenForTicketInfo:
+		return &TicketInfoCommand{
+			commandEnv: env,
+			ticketID:   args[0],
+		}
+	case TokenForLeaveByRegistrationNo:
+		return &LeaveByRegistrationNoCommand{
+			commandEnv:     env,
+			registrationNo: args[0],
+		}
+	case TokenForReserve:
+		vehicleType := pm.VehicleTypeCar
+		if len(args) > 3 {
+			var err error
+			if vehicleType, err = pm.ParseVehicleType(args[3]); err != nil {
+				writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid vehicle type: %s\n", args[3]))
+				return nil
+			}
+		}
+		return &ReserveCommand{
+			commandEnv:     env,
+			registrationNo: args[0],
+			vehicleType:    vehicleType,
+			from:           args[1],
+			to:             args[2],
+		}
+	case TokenForTagSlot:
+		attributes, err := pm.ParseSlotAttributes(args[1])
+		if err != nil {
+			writeToOutput(cb.owriter, fmt.Sprintf("\n%s\n", err))
+			return nil
+		}
+		return &TagSlotCommand{
+			commandEnv: env,
+			slot:       args[0],
+			attributes: attributes,
+		}
+	case TokenForWaitlist:
+		return &WaitlistCommand{
+			commandEnv: env,
+		}
+	case TokenForCancelWaitlist:
+		return &CancelWaitlistCommand{
+			commandEnv:     env,
+			registrationNo: args[0],
+		}
+	case TokenForSaveSnapshot:
+		return &SaveSnapshotCommand{
+			commandEnv: env,
+			fileName:   args[0],
+		}
+	case TokenForLoadSnapshot:
+		return &LoadSnapshotCommand{
+			commandEnv: env,
+			fileName:   args[0],
+		}
+	case TokenForHistoryForRegistrationNo:
+		return &HistoryForRegistrationNoCommand{
+			commandEnv:     env,
+			registrationNo: args[0],
+		}
+	case TokenForHistoryForSlot:
+		return &HistoryForSlotCommand{
+			commandEnv: env,
+			slot:       args[0],
+		}
+	case TokenForUndo:
+		return &UndoCommand{
+			commandEnv: env,
+		}
+	case TokenForRedo:
+		return &RedoCommand{
+			commandEnv: env,
+		}
+	case TokenForBegin:
+		return &BeginCommand{
+			commandEnv: env,
+		}
+	case TokenForCommit:
+		return &CommitCommand{
+			commandEnv: env,
+		}
+	case TokenForRollback:
+		return &RollbackCommand{
+			commandEnv: env,
 		}
 	case "":
 		writeToOutput(cb.owriter, "\nno command provided \n\n")
@@ -171,7 +518,24 @@ func (cb *CommandBuilder) BuildCommands(ctx context.Context, inputFileName strin
 	scanner := bufio.NewScanner(file)
 	scanner.Scan()
 	tokens := strings.Split(scanner.Text(), " ")
-	if tokens[0] != TokenForCreateParkingLot {
+	commands := make([]Commander, 0)
+	switch {
+	case tokens[0] == TokenForCreateParkingLot:
+		// intilialise a parking lot
+		createCmd := cb.ParseCommand(TokenForCreateParkingLot, tokens[1:]...)
+		if createCmd == nil {
+			return nil, ErrInvalidCreateParkingLotCommand
+		}
+		err = createCmd.Execute(ctx)
+		if err != nil {
+			return nil, err
+		}
+	case tokens[0] == TokenForLoadSnapshot || tokens[0] == TokenForBegin || cb.lotService.HasParkingLot():
+		// the lots come from a snapshot, loaded first or restored from the state file, or are created within a transaction
+		if cmd := cb.ParseCommand(tokens[0], tokens[1:]...); cmd != nil {
+			commands = append(commands, cmd)
+		}
+	default:
 		/*
 			Assumption: The first command must be create_parking_lot command.
 			Without a parking lot, no command/operation would make sense and allowed.
@@ -179,18 +543,16 @@ func (cb *CommandBuilder) BuildCommands(ctx context.Context, inputFileName strin
 		log.Fatal(ErrCreateParkingLotCommandMissing) // cannot proceed, panic!
 	}
 
-	// intilialise a parking lot
-	err = cb.ParseCommand(TokenForCreateParkingLot, tokens[1]).Execute(ctx)
-	if err != nil {
-		return nil, err
-	}
-
 	// build rest of the commands
-	commands := make([]Commander, 0)
 	for scanner.Scan() {
 		tokens := strings.Split(scanner.Text(), " ")
 
 		cmd := cb.ParseCommand(tokens[0], tokens[1:]...)
+		if cmd == nil && tokens[0] != "" {
+			// reported already, it fails the transaction it is in when it comes to be executed
+			commands = append(commands, &rejectedCommand{lotService: cb.lotService, commandLine: scanner.Text()})
+			continue
+		}
 		if cmd == nil {
 			continue
 		}
@@ -205,81 +567,275 @@ func (cb *CommandBuilder) BuildCommands(ctx context.Context, inputFileName strin
 	return commands, nil
 }
 
+// parses <registration number> <color> [type] and the --needs flag of the park commands
+func (cb *CommandBuilder) parseVehicle(commandName string, args []string, flags map[string]string) (*pm.Vehicle, bool) {
+	if len(args) < 2 {
+		writeToOutput(cb.owriter, fmt.Sprintf("\nargs missing for command: %s\n", commandName))
+		return nil, false
+	}
+	vehicleType := pm.VehicleTypeCar
+	if len(args) > 2 {
+		var err error
+		if vehicleType, err = pm.ParseVehicleType(args[2]); err != nil {
+			writeToOutput(cb.owriter, fmt.Sprintf("\ninvalid vehicle type: %s\n", args[2]))
+			return nil, false
+		}
+	}
+	needs, err := pm.ParseSlotAttributes(flags["needs"])
+	if err != nil {
+		writeToOutput(cb.owriter, fmt.Sprintf("\n%s\n", err))
+		return nil, false
+	}
+	return pm.NewVehicleNeeding(args[0], args[1], vehicleType, needs), true
+}
+
 func (cplCmd *CreateParkingLotCommand) Execute(ctx context.Context) error {
-	if cplCmd.capacity > MaxNumberOfSlots {
-		writeToOutput(cplCmd.owriter, fmt.Sprintf("cannot create :%d slots. %s", cplCmd.capacity, ErrMaxSlotExceeded.Error()))
+	capacity := cplCmd.layout.Capacity()
+	maxSlots := cplCmd.lotService.GetMaxSlots()
+	if capacity > maxSlots {
+		writeToOutput(cplCmd.owriter, fmt.Sprintf("cannot create :%d slots. max slots available: %d", capacity, maxSlots))
 
 		/*
 			we want to propagate this error up, as we want to exit gracefully in FileMode.
 			As we don't have an option (like in interactive mode) to fix what's inside the input file at runtime
 		*/
-		return ErrMaxSlotExceeded
+		return fmt.Errorf("%w: %d", ErrMaxSlotExceeded, maxSlots)
 	}
 
-	if cplCmd.capacity <= 0 {
-		writeToOutput(cplCmd.owriter, fmt.Sprintf("invalid slot number: %d", cplCmd.capacity))
+	if err := cplCmd.layout.Validate(); err != nil {
+		if capacity > 0 {
+			writeToOutput(cplCmd.owriter, err.Error())
+			cplCmd.fail()
+			return nil
+		}
+		writeToOutput(cplCmd.owriter, fmt.Sprintf("invalid slot number: %d", capacity))
+		cplCmd.fail()
 		return nil
 	}
 
-	writeToOutput(cplCmd.owriter, fmt.Sprintf("Created a parking lot with %d slots", cplCmd.capacity))
-	parkingLot = pm.NewParkingLot(cplCmd.capacity)
+	name, lotDescription := DefaultLotName, "a parking lot"
+	if cplCmd.lotName != "" {
+		name, lotDescription = cplCmd.lotName, "parking lot "+cplCmd.lotName
+	}
+	// only the very first lot of a session starts the output
+	newlineOrNothing := ""
+	if cplCmd.lotService.HasParkingLot() {
+		newlineOrNothing = cplCmd.newlineOrNothing
+	}
+
+	parkingLot, err := cplCmd.lotService.CreateParkingLot(ctx, name, cplCmd.layout, cplCmd.options...)
+	if errors.Is(err, ErrLotExists) {
+		writeToOutput(cplCmd.owriter, fmt.Sprintf(newlineOrNothing+"Sorry, %s exists already", lotDescription))
+		cplCmd.fail()
+		return nil
+	}
+	if !parkingLot.IsMultiLevel() {
+		writeToOutput(cplCmd.owriter, fmt.Sprintf(newlineOrNothing+"Created %s with %d slots", lotDescription, capacity))
+		return nil
+	}
+	writeToOutput(cplCmd.owriter, fmt.Sprintf(newlineOrNothing+"Created %s with %d slots on %d levels", lotDescription, capacity, len(parkingLot.GetLevelOccupancy())))
 	return nil
 }
 func (parkCmd *ParkCommand) Execute(ctx context.Context) error {
-	if len(parkingLot.GetAvailableSlots()) == 0 {
-		writeToOutput(parkCmd.owriter, newlineOrNothing+"Sorry, parking lot is full")
+	parkingLot, ok := parkCmd.resolveParkingLot(ctx)
+	if !ok {
+		parkCmd.fail()
+		return nil
+	}
+	defer parkCmd.admitWaitlisted(parkingLot)
+	slot, err := parkCmd.lotService.parkOnce(parkingLot, parkCmd.vehicle.GetRegistrationNo(), func() (int, error) {
+		if parkCmd.gate != "" {
+			return parkingLot.ParkFromGate(parkCmd.vehicle, parkCmd.gate)
+		}
+		return parkingLot.Park(parkCmd.vehicle)
+	})
+	if errors.Is(err, pm.ErrUnknownGate) {
+		writeToOutput(parkCmd.owriter, fmt.Sprintf(parkCmd.newlineOrNothing+"Sorry, unknown gate: %s", parkCmd.gate))
+		parkCmd.fail()
+		return nil
+	}
+	if parkCmd.reportParkError(parkingLot, parkCmd.vehicle, err) {
+		parkCmd.fail()
 		return nil
 	}
 
-	slot := int(parkingLot.GetAvailableSlots()[0])
-	parkingLot.UpdateAvailableSlots(parkingLot.GetAvailableSlots()[1:])
-	parkingLot.UpdateOccupiedSlot(slot, parkCmd.vehicle)
-	parkingLot.UpdateSlotByRegistrationNo(parkCmd.vehicle.GetRegistrationNo(), slot)
-	parkingLot.UpdateVehiclesByColor(parkCmd.vehicle.GetColor(), parkCmd.vehicle)
-
-	writeToOutput(parkCmd.owriter, fmt.Sprintf(newlineOrNothing+"Allocated slot number: %d", slot))
+	writeToOutput(parkCmd.owriter, fmt.Sprintf(parkCmd.newlineOrNothing+"Allocated slot number: %s, ticket: %s", parkingLot.SlotLabel(slot), parkCmd.vehicle.GetTicketID()))
 	return nil
 }
 
-func (leaveCmd *LeaveCommand) Execute(ctx context.Context) error {
-	vehicle, exists := parkingLot.GetOccupiedSlots()[leaveCmd.slot]
-	if !exists {
-		writeToOutput(leaveCmd.owriter, fmt.Sprintf("slot %d is not occupied", leaveCmd.slot))
+func (parkAtCmd *ParkAtCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := parkAtCmd.resolveParkingLot(ctx)
+	if !ok {
+		parkAtCmd.fail()
+		return nil
+	}
+	defer parkAtCmd.admitWaitlisted(parkingLot)
+	slot, err := parkingLot.ParseSlot(parkAtCmd.slot)
+	if err == nil {
+		_, err = parkAtCmd.lotService.parkOnce(parkingLot, parkAtCmd.vehicle.GetRegistrationNo(), func() (int, error) {
+			return slot, parkingLot.ParkAt(parkAtCmd.vehicle, slot)
+		})
+	}
+	switch {
+	case errors.Is(err, pm.ErrInvalidSlot):
+		writeToOutput(parkAtCmd.owriter, fmt.Sprintf(parkAtCmd.newlineOrNothing+"Sorry, invalid slot number: %s", parkAtCmd.slot))
+		parkAtCmd.fail()
+		return nil
+	case errors.Is(err, pm.ErrSlotOccupied):
+		writeToOutput(parkAtCmd.owriter, fmt.Sprintf(parkAtCmd.newlineOrNothing+"Sorry, slot number %s is occupied", parkingLot.SlotLabel(slot)))
+		parkAtCmd.fail()
+		return nil
+	case errors.Is(err, pm.ErrSlotReserved):
+		writeToOutput(parkAtCmd.owriter, fmt.Sprintf(parkAtCmd.newlineOrNothing+"Sorry, slot number %s is reserved", parkingLot.SlotLabel(slot)))
+		parkAtCmd.fail()
+		return nil
+	case errors.Is(err, pm.ErrSlotTooSmall):
+		writeToOutput(parkAtCmd.owriter, fmt.Sprintf(parkAtCmd.newlineOrNothing+"Sorry, slot number %s is too small for a %s", parkingLot.SlotLabel(slot), parkAtCmd.vehicle.GetType()))
+		parkAtCmd.fail()
+		return nil
+	case errors.Is(err, pm.ErrNoSlotWithAttributes):
+		writeToOutput(parkAtCmd.owriter, fmt.Sprintf(parkAtCmd.newlineOrNothing+"Sorry, slot number %s is not %s", parkingLot.SlotLabel(slot), parkAtCmd.vehicle.GetNeeds()))
+		parkAtCmd.fail()
+		return nil
+	}
+	if parkAtCmd.reportParkError(parkingLot, parkAtCmd.vehicle, err) {
+		parkAtCmd.fail()
 		return nil
 	}
 
-	parkingLot.RemoveSlotFromOccupiedSlots(leaveCmd.slot)
-	parkingLot.RemoveRegistrationNoFromOccupiedSlots(vehicle.GetRegistrationNo())
-	parkingLot.RemoveVehicleFromColorToVehicleMapping(vehicle)
+	writeToOutput(parkAtCmd.owriter, fmt.Sprintf(parkAtCmd.newlineOrNothing+"Allocated slot number: %s, ticket: %s", parkingLot.SlotLabel(slot), parkAtCmd.vehicle.GetTicketID()))
+	return nil
+}
 
-	// sync the slots - in order
-	i := 0
-	for i < len(parkingLot.GetAvailableSlots()) && parkingLot.GetAvailableSlots()[i] < leaveCmd.slot {
-		i++
+// reports why the vehicle could not be parked, false when it was
+func (env commandEnv) reportParkError(parkingLot *pm.ParkingLot, vehicle *pm.Vehicle, err error) bool {
+	if err == nil {
+		return false
+	}
+	var alreadyParked *pm.VehicleAlreadyParkedError
+	if errors.As(err, &alreadyParked) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, vehicle %s is already parked at slot number: %s", alreadyParked.RegistrationNo, parkingLot.SlotLabel(alreadyParked.Slot)))
+		return true
+	}
+	var parkedInOtherLot *VehicleParkedInOtherLotError
+	if errors.As(err, &parkedInOtherLot) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, vehicle %s is already parked in lot %s at slot number: %s", parkedInOtherLot.RegistrationNo, parkedInOtherLot.LotName, parkedInOtherLot.Label))
+		return true
+	}
+	// the validator names the registration number as normalized, the vehicle keeps it as given
+	if errors.Is(err, pm.ErrInvalidRegistrationNo) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, %s", err))
+		return true
+	}
+	if errors.Is(err, pm.ErrUnknownColor) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, unknown color: %s", vehicle.GetColor()))
+		return true
+	}
+	if errors.Is(err, pm.ErrNoSlotForVehicleType) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, no free slot for a %s", vehicle.GetType()))
+		return true
+	}
+	if errors.Is(err, pm.ErrNoSlotWithAttributes) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, no free slot with %s for a %s", vehicle.GetNeeds(), vehicle.GetType()))
+		return true
+	}
+	if errors.Is(err, pm.ErrParkingLotFull) {
+		writeToOutput(env.owriter, env.newlineOrNothing+"Sorry, parking lot is full")
+		return true
+	}
+	var waitlisted *pm.WaitlistedError
+	if errors.As(err, &waitlisted) {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, parking lot is full, vehicle %s is waitlisted at position: %d", waitlisted.RegistrationNo, waitlisted.Position))
+		return true
 	}
+	writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, %s", err))
+	return true
+}
 
-	updatedAvailableSlots := append(parkingLot.GetAvailableSlots()[:i], append([]int{leaveCmd.slot}, parkingLot.GetAvailableSlots()[i:]...)...)
-	parkingLot.UpdateAvailableSlots(updatedAvailableSlots)
+func (leaveCmd *LeaveCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := leaveCmd.resolveParkingLot(ctx)
+	if !ok {
+		leaveCmd.fail()
+		return nil
+	}
+	var vehicle *pm.Vehicle
+	slot, err := parkingLot.ParseSlot(leaveCmd.slot)
+	if err == nil {
+		vehicle, err = parkingLot.Leave(slot)
+	}
+	if errors.Is(err, pm.ErrInvalidSlot) || errors.Is(err, pm.ErrSlotNotOccupied) {
+		writeToOutput(leaveCmd.owriter, fmt.Sprintf("slot %s is not occupied", leaveCmd.slot))
+		leaveCmd.fail()
+		return nil
+	}
 
-	writeToOutput(leaveCmd.owriter, fmt.Sprintf(newlineOrNothing+"Slot number %d is free", leaveCmd.slot))
+	leaveCmd.reportLeave(parkingLot, slot, vehicle)
+	leaveCmd.admitWaitlisted(parkingLot)
 	return nil
 }
 func (statusCmd *StatusCommand) Execute(ctx context.Context) error {
-	slots := make([]int, 0, len(parkingLot.GetOccupiedSlots()))
-	for slot := range parkingLot.GetOccupiedSlots() {
+	parkingLot, ok := statusCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
+	occupiedSlots := parkingLot.GetOccupiedSlots()
+	slots := make([]int, 0, len(occupiedSlots))
+	for slot := range occupiedSlots {
 		slots = append(slots, slot)
 	}
 
+	// reserved slots nobody has parked at yet are listed along with the occupied ones, from the time they are held
+	reservedSlots := map[int]pm.Reservation{}
+	for _, reservation := range parkingLot.GetReservations() {
+		if !reservation.Held {
+			continue
+		}
+		reservedSlots[reservation.Slot] = reservation
+		slots = append(slots, reservation.Slot)
+	}
+
 	sort.Ints(slots)
 
-	writeToOutput(statusCmd.owriter, fmt.Sprintf(newlineOrNothing+"%-10s %-20s %-10s", "Slot No.", "Registration No", "Color"))
+	header := fmt.Sprintf("%-10s %-20s %-10s %-10s", "Slot No.", "Registration No", "Color", "Type")
+	if statusCmd.showTimes {
+		header += fmt.Sprintf(" %-16s %-10s", "Since", "Duration")
+	}
+	writeToOutput(statusCmd.owriter, statusCmd.newlineOrNothing+header)
+
+	now := parkingLot.Now()
 	for _, slot := range slots {
-		vehicle := parkingLot.GetOccupiedSlots()[slot]
-		writeToOutput(statusCmd.owriter, fmt.Sprintf("\n%-10d %-20s %-10s", slot, vehicle.GetRegistrationNo(), vehicle.GetColor()))
+		if reservation, ok := reservedSlots[slot]; ok {
+			row := fmt.Sprintf("\n%-10s %-20s %-10s %-10s", parkingLot.SlotLabel(slot), reservation.RegistrationNo, "reserved", reservation.VehicleType)
+			if statusCmd.showTimes {
+				row += fmt.Sprintf(" %-16s %-10s", reservation.From.Format(timeLayout), "-")
+			}
+			writeToOutput(statusCmd.owriter, row)
+			continue
+		}
+
+		vehicle := occupiedSlots[slot]
+		row := fmt.Sprintf("\n%-10s %-20s %-10s %-10s", parkingLot.SlotLabel(slot), vehicle.GetRegistrationNo(), vehicle.GetColor(), vehicle.GetType())
+		if statusCmd.showTimes {
+			row += fmt.Sprintf(" %-16s %-10s", vehicle.GetEntryTime().Format(timeLayout), formatDuration(vehicle.GetParkedDuration(now)))
+		}
+		writeToOutput(statusCmd.owriter, row)
+	}
+
+	// per level breakdown of a multi-level lot
+	if !parkingLot.IsMultiLevel() {
+		return nil
+	}
+	writeToOutput(statusCmd.owriter, fmt.Sprintf("\n\n%-10s %-10s %-10s", "Level", "Occupied", "Free"))
+	for _, level := range parkingLot.GetLevelOccupancy() {
+		writeToOutput(statusCmd.owriter, fmt.Sprintf("\n%-10s %-10d %-10d", fmt.Sprintf("L%d", level.Level), level.Occupied, level.Capacity-level.Occupied))
 	}
 	return nil
 }
 func (qRegNoByColorCmd *QueryRegistrationNoByColorCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := qRegNoByColorCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
 	vehicles, ok := parkingLot.GetVehiclesByColor(qRegNoByColorCmd.color)
 	if !ok {
 		writeToOutput(qRegNoByColorCmd.owriter, "Not found")
@@ -291,37 +847,497 @@ func (qRegNoByColorCmd *QueryRegistrationNoByColorCommand) Execute(ctx context.C
 		output = append(output, vehicle.GetRegistrationNo())
 	}
 
-	writeToOutput(qRegNoByColorCmd.owriter, fmt.Sprintf(newlineOrNothing+"%s", strings.Join(output, ", ")))
+	writeToOutput(qRegNoByColorCmd.owriter, fmt.Sprintf(qRegNoByColorCmd.newlineOrNothing+"%s", strings.Join(output, ", ")))
 	return nil
 }
 func (qSlotNoByRegNoCmd *QuerySlotNoByRegistrationNoCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := qSlotNoByRegNoCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
 	slot, exists := parkingLot.GetSlotByRegistrationNo(qSlotNoByRegNoCmd.registrationNo)
 	if !exists {
-		writeToOutput(qSlotNoByRegNoCmd.owriter, "Not found"+newlineOrNothing)
+		writeToOutput(qSlotNoByRegNoCmd.owriter, "Not found"+qSlotNoByRegNoCmd.newlineOrNothing)
 		return nil
 	}
 
-	writeToOutput(qSlotNoByRegNoCmd.owriter, fmt.Sprintf("%d\n", slot))
+	writeToOutput(qSlotNoByRegNoCmd.owriter, fmt.Sprintf("%s\n", parkingLot.SlotLabel(slot)))
 	return nil
 }
 func (qSlotNoByColorCmd *QuerySlotNoByColorCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := qSlotNoByColorCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
 	vehicles, exists := parkingLot.GetVehiclesByColor(qSlotNoByColorCmd.color)
 	if !exists {
-		writeToOutput(qSlotNoByColorCmd.owriter, "Not found"+newlineOrNothing)
+		writeToOutput(qSlotNoByColorCmd.owriter, "Not found"+qSlotNoByColorCmd.newlineOrNothing)
 		return nil
 	}
 
 	slots := []string{}
 	for _, vehicle := range vehicles {
 		if slot, exists := parkingLot.GetSlotByRegistrationNo(vehicle.GetRegistrationNo()); exists {
-			slots = append(slots, fmt.Sprintf("%d", slot))
+			slots = append(slots, parkingLot.SlotLabel(slot))
 		}
 	}
 
-	writeToOutput(qSlotNoByColorCmd.owriter, fmt.Sprintf(newlineOrNothing+"%s\n", strings.Join(slots, ", ")))
+	writeToOutput(qSlotNoByColorCmd.owriter, fmt.Sprintf(qSlotNoByColorCmd.newlineOrNothing+"%s\n", strings.Join(slots, ", ")))
 	return nil
 }
 
+func (useLotCmd *UseLotCommand) Execute(ctx context.Context) error {
+	if err := useLotCmd.lotService.UseLot(ctx, useLotCmd.name); err != nil {
+		writeToOutput(useLotCmd.owriter, fmt.Sprintf(useLotCmd.newlineOrNothing+"Sorry, unknown parking lot: %s", useLotCmd.name))
+		useLotCmd.fail()
+		return nil
+	}
+
+	writeToOutput(useLotCmd.owriter, fmt.Sprintf(useLotCmd.newlineOrNothing+"Using parking lot %s", useLotCmd.name))
+	return nil
+}
+func (qLotByRegNoCmd *QueryLotByRegistrationNoCommand) Execute(ctx context.Context) error {
+	lotSlots := qLotByRegNoCmd.lotService.FindRegistrationNo(qLotByRegNoCmd.registrationNo)
+	if len(lotSlots) == 0 {
+		writeToOutput(qLotByRegNoCmd.owriter, "Not found"+qLotByRegNoCmd.newlineOrNothing)
+		return nil
+	}
+
+	output := make([]string, 0, len(lotSlots))
+	for _, lotSlot := range lotSlots {
+		output = append(output, fmt.Sprintf("%s: %s", lotSlot.LotName, lotSlot.Label))
+	}
+	writeToOutput(qLotByRegNoCmd.owriter, fmt.Sprintf(qLotByRegNoCmd.newlineOrNothing+"%s\n", strings.Join(output, ", ")))
+	return nil
+}
+
+// quotes what the vehicle would pay if it left now, the vehicle stays parked
+func (qFeeByRegNoCmd *QueryFeeByRegistrationNoCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := qFeeByRegNoCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
+	vehicle, _, exists := parkingLot.GetVehicleByRegistrationNo(qFeeByRegNoCmd.registrationNo)
+	if !exists {
+		writeToOutput(qFeeByRegNoCmd.owriter, "Not found"+qFeeByRegNoCmd.newlineOrNothing)
+		return nil
+	}
+
+	now := parkingLot.Now()
+	fee := qFeeByRegNoCmd.lotService.GetTariff().Fee(vehicle.GetType().String(), vehicle.GetEntryTime(), now)
+	writeToOutput(qFeeByRegNoCmd.owriter, fmt.Sprintf(qFeeByRegNoCmd.newlineOrNothing+"%.2f, parked for %s\n", fee, formatDuration(vehicle.GetParkedDuration(now))))
+	return nil
+}
+
+func (leaveByTicketCmd *LeaveByTicketCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := leaveByTicketCmd.resolveTicketLot(ctx, leaveByTicketCmd.ticketID)
+	if !ok {
+		leaveByTicketCmd.fail()
+		return nil
+	}
+	vehicle, slot, err := parkingLot.LeaveByTicket(leaveByTicketCmd.ticketID)
+	if err != nil {
+		// not in the given lot, or left in the meantime
+		writeToOutput(leaveByTicketCmd.owriter, fmt.Sprintf(leaveByTicketCmd.newlineOrNothing+"Sorry, unknown ticket: %s", leaveByTicketCmd.ticketID))
+		leaveByTicketCmd.fail()
+		return nil
+	}
+
+	leaveByTicketCmd.reportLeave(parkingLot, slot, vehicle)
+	leaveByTicketCmd.admitWaitlisted(parkingLot)
+	return nil
+}
+func (ticketInfoCmd *TicketInfoCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := ticketInfoCmd.resolveTicketLot(ctx, ticketInfoCmd.ticketID)
+	if !ok {
+		return nil
+	}
+	vehicle, slot, exists := parkingLot.GetVehicleByTicket(ticketInfoCmd.ticketID)
+	if !exists {
+		writeToOutput(ticketInfoCmd.owriter, fmt.Sprintf(ticketInfoCmd.newlineOrNothing+"Sorry, unknown ticket: %s", ticketInfoCmd.ticketID))
+		return nil
+	}
+
+	now := parkingLot.Now()
+	fee := ticketInfoCmd.lotService.GetTariff().Fee(vehicle.GetType().String(), vehicle.GetEntryTime(), now)
+	writeToOutput(ticketInfoCmd.owriter, fmt.Sprintf(ticketInfoCmd.newlineOrNothing+"Ticket %s: %s %s %s at slot number %s since %s, parked for %s, fee %.2f",
+		vehicle.GetTicketID(), vehicle.GetRegistrationNo(), vehicle.GetColor(), vehicle.GetType(), parkingLot.SlotLabel(slot),
+		vehicle.GetEntryTime().Format(timeLayout), formatDuration(vehicle.GetParkedDuration(now)), fee))
+	return nil
+}
+
+func (leaveByRegNoCmd *LeaveByRegistrationNoCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := leaveByRegNoCmd.resolveParkingLot(ctx)
+	if !ok {
+		leaveByRegNoCmd.fail()
+		return nil
+	}
+	vehicle, slot, err := parkingLot.LeaveByRegistrationNo(leaveByRegNoCmd.registrationNo)
+	if errors.Is(err, pm.ErrVehicleNotParked) {
+		writeToOutput(leaveByRegNoCmd.owriter, fmt.Sprintf(leaveByRegNoCmd.newlineOrNothing+"Sorry, vehicle %s is not parked", leaveByRegNoCmd.registrationNo))
+		leaveByRegNoCmd.fail()
+		return nil
+	}
+
+	leaveByRegNoCmd.reportLeave(parkingLot, slot, vehicle)
+	leaveByRegNoCmd.admitWaitlisted(parkingLot)
+	return nil
+}
+
+func (tagSlotCmd *TagSlotCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := tagSlotCmd.resolveParkingLot(ctx)
+	if !ok {
+		tagSlotCmd.fail()
+		return nil
+	}
+	defer tagSlotCmd.admitWaitlisted(parkingLot)
+	slot, err := parkingLot.ParseSlot(tagSlotCmd.slot)
+	if err == nil {
+		err = parkingLot.TagSlot(slot, tagSlotCmd.attributes)
+	}
+	if err != nil {
+		writeToOutput(tagSlotCmd.owriter, fmt.Sprintf(tagSlotCmd.newlineOrNothing+"Sorry, invalid slot number: %s", tagSlotCmd.slot))
+		tagSlotCmd.fail()
+		return nil
+	}
+
+	writeToOutput(tagSlotCmd.owriter, fmt.Sprintf(tagSlotCmd.newlineOrNothing+"Slot number %s is tagged %s", parkingLot.SlotLabel(slot), tagSlotCmd.attributes))
+	return nil
+}
+
+func (saveCmd *SaveSnapshotCommand) Execute(ctx context.Context) error {
+	if err := saveCmd.lotService.SaveSnapshot(saveCmd.fileName); err != nil {
+		writeToOutput(saveCmd.owriter, fmt.Sprintf(saveCmd.newlineOrNothing+"Sorry, failed to save snapshot: %s", err))
+		return nil
+	}
+	writeToOutput(saveCmd.owriter, fmt.Sprintf(saveCmd.newlineOrNothing+"Saved snapshot to %s", saveCmd.fileName))
+	return nil
+}
+
+func (loadCmd *LoadSnapshotCommand) Execute(ctx context.Context) error {
+	// like create_parking_lot, loading the very first lots of a session starts the output
+	newlineOrNothing := ""
+	if loadCmd.lotService.HasParkingLot() {
+		newlineOrNothing = loadCmd.newlineOrNothing
+	}
+	if err := loadCmd.lotService.LoadSnapshot(ctx, loadCmd.fileName); err != nil {
+		writeToOutput(loadCmd.owriter, fmt.Sprintf(newlineOrNothing+"Sorry, failed to load snapshot: %s", err))
+		return nil
+	}
+	writeToOutput(loadCmd.owriter, fmt.Sprintf(newlineOrNothing+"Loaded snapshot from %s", loadCmd.fileName))
+	return nil
+}
+
+func (reserveCmd *ReserveCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := reserveCmd.resolveParkingLot(ctx)
+	if !ok {
+		reserveCmd.fail()
+		return nil
+	}
+	defer reserveCmd.admitWaitlisted(parkingLot)
+	from, to, err := parseWindow(reserveCmd.from, reserveCmd.to, parkingLot.Now())
+	if err != nil {
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, %s", err))
+		reserveCmd.fail()
+		return nil
+	}
+
+	slot, err := parkingLot.Reserve(reserveCmd.registrationNo, reserveCmd.vehicleType, from, to)
+	if err == nil {
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Reserved slot number: %s from %s to %s", parkingLot.SlotLabel(slot), from.Format(timeLayout), to.Format(timeLayout)))
+		return nil
+	}
+	reserveCmd.fail()
+	var alreadyParked *pm.VehicleAlreadyParkedError
+	switch {
+	case errors.As(err, &alreadyParked):
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, vehicle %s is already parked at slot number: %s", alreadyParked.RegistrationNo, parkingLot.SlotLabel(alreadyParked.Slot)))
+	case errors.Is(err, pm.ErrVehicleAlreadyReserved):
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, vehicle %s already has a reservation", reserveCmd.registrationNo))
+	case errors.Is(err, pm.ErrInvalidReservation):
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, %s", err))
+	case errors.Is(err, pm.ErrInvalidRegistrationNo):
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, invalid registration number: %s", reserveCmd.registrationNo))
+	case errors.Is(err, pm.ErrNoSlotForVehicleType):
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, no free slot for a %s", reserveCmd.vehicleType))
+	case errors.Is(err, pm.ErrNoSlotForWindow):
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, every slot for a %s is reserved during the window", reserveCmd.vehicleType))
+	case errors.Is(err, pm.ErrParkingLotFull):
+		writeToOutput(reserveCmd.owriter, reserveCmd.newlineOrNothing+"Sorry, parking lot is full")
+	default:
+		writeToOutput(reserveCmd.owriter, fmt.Sprintf(reserveCmd.newlineOrNothing+"Sorry, %s", err))
+	}
+	return nil
+}
+
+func (waitlistCmd *WaitlistCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := waitlistCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
+	waitlist := parkingLot.GetWaitlist()
+	if len(waitlist) == 0 {
+		writeToOutput(waitlistCmd.owriter, waitlistCmd.newlineOrNothing+"Waitlist is empty")
+		return nil
+	}
+
+	writeToOutput(waitlistCmd.owriter, waitlistCmd.newlineOrNothing+fmt.Sprintf("%-10s %-20s %-10s %-10s", "Position", "Registration No", "Color", "Type"))
+	for i, vehicle := range waitlist {
+		writeToOutput(waitlistCmd.owriter, fmt.Sprintf("\n%-10d %-20s %-10s %-10s", i+1, vehicle.GetRegistrationNo(), vehicle.GetColor(), vehicle.GetType()))
+	}
+	return nil
+}
+func (cancelWaitlistCmd *CancelWaitlistCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := cancelWaitlistCmd.resolveParkingLot(ctx)
+	if !ok {
+		cancelWaitlistCmd.fail()
+		return nil
+	}
+	if err := parkingLot.CancelWaitlist(cancelWaitlistCmd.registrationNo); err != nil {
+		writeToOutput(cancelWaitlistCmd.owriter, fmt.Sprintf(cancelWaitlistCmd.newlineOrNothing+"Sorry, vehicle %s is not waitlisted", cancelWaitlistCmd.registrationNo))
+		cancelWaitlistCmd.fail()
+		return nil
+	}
+
+	writeToOutput(cancelWaitlistCmd.owriter, fmt.Sprintf(cancelWaitlistCmd.newlineOrNothing+"Removed vehicle %s from the waitlist", cancelWaitlistCmd.registrationNo))
+	return nil
+}
+func (historyCmd *HistoryForRegistrationNoCommand) Execute(ctx context.Context) error {
+	history := historyCmd.lotService.HistoryForRegistrationNo(historyCmd.registrationNo)
+	if len(history) == 0 {
+		writeToOutput(historyCmd.owriter, historyCmd.newlineOrNothing+"Not found")
+		return nil
+	}
+
+	writeToOutput(historyCmd.owriter, historyCmd.newlineOrNothing+fmt.Sprintf("%-16s %-10s %-20s %-10s %s", "Time", "Lot", "Event", "Slot No.", "Detail"))
+	for _, event := range history {
+		// a waitlisted vehicle has no slot, the lot of an event may have been replaced since
+		slot := "-"
+		if parkingLot, err := historyCmd.lotService.GetNamedParkingLot(event.Lot); err == nil && event.Slot > 0 {
+			slot = parkingLot.SlotLabel(event.Slot)
+		} else if event.Slot > 0 {
+			slot = strconv.Itoa(event.Slot)
+		}
+		writeToOutput(historyCmd.owriter, fmt.Sprintf("\n%-16s %-10s %-20s %-10s %s", event.At.Format(timeLayout), event.Lot, event.Type, slot, describeEvent(event)))
+	}
+	return nil
+}
+func (historyCmd *HistoryForSlotCommand) Execute(ctx context.Context) error {
+	parkingLot, ok := historyCmd.resolveParkingLot(ctx)
+	if !ok {
+		return nil
+	}
+	slot, err := parkingLot.ParseSlot(historyCmd.slot)
+	if err != nil {
+		writeToOutput(historyCmd.owriter, fmt.Sprintf(historyCmd.newlineOrNothing+"Sorry, invalid slot: %s", historyCmd.slot))
+		return nil
+	}
+	lotName := historyCmd.lotName
+	if lotName == "" {
+		lotName = historyCmd.lotService.GetActiveLotName()
+	}
+	history := historyCmd.lotService.HistoryForSlot(lotName, slot)
+	if len(history) == 0 {
+		writeToOutput(historyCmd.owriter, historyCmd.newlineOrNothing+"Not found")
+		return nil
+	}
+
+	writeToOutput(historyCmd.owriter, historyCmd.newlineOrNothing+fmt.Sprintf("%-16s %-20s %-20s %s", "Time", "Event", "Registration No", "Detail"))
+	for _, event := range history {
+		registrationNo := event.RegistrationNo()
+		if registrationNo == "" {
+			registrationNo = "-"
+		}
+		writeToOutput(historyCmd.owriter, fmt.Sprintf("\n%-16s %-20s %-20s %s", event.At.Format(timeLayout), event.Type, registrationNo, describeEvent(event)))
+	}
+	return nil
+}
+
+func (undoCmd *UndoCommand) Execute(ctx context.Context) error {
+	commandLine, ok, err := undoCmd.lotService.Undo(ctx)
+	switch {
+	case errors.Is(err, ErrTransactionOpen):
+		writeToOutput(undoCmd.owriter, undoCmd.newlineOrNothing+"Sorry, cannot undo within a transaction")
+	case !ok:
+		writeToOutput(undoCmd.owriter, undoCmd.newlineOrNothing+"Nothing to undo")
+	case err != nil:
+		writeToOutput(undoCmd.owriter, fmt.Sprintf(undoCmd.newlineOrNothing+"Sorry, failed to undo %s: %s", commandLine, err))
+	default:
+		writeToOutput(undoCmd.owriter, fmt.Sprintf(undoCmd.newlineOrNothing+"Undone: %s", commandLine))
+	}
+	return nil
+}
+func (redoCmd *RedoCommand) Execute(ctx context.Context) error {
+	commandLine, ok, err := redoCmd.lotService.Redo(ctx)
+	switch {
+	case errors.Is(err, ErrTransactionOpen):
+		writeToOutput(redoCmd.owriter, redoCmd.newlineOrNothing+"Sorry, cannot redo within a transaction")
+	case !ok:
+		writeToOutput(redoCmd.owriter, redoCmd.newlineOrNothing+"Nothing to redo")
+	case err != nil:
+		writeToOutput(redoCmd.owriter, fmt.Sprintf(redoCmd.newlineOrNothing+"Sorry, failed to redo %s: %s", commandLine, err))
+	default:
+		writeToOutput(redoCmd.owriter, fmt.Sprintf(redoCmd.newlineOrNothing+"Redone: %s", commandLine))
+	}
+	return nil
+}
+
+func (beginCmd *BeginCommand) Execute(ctx context.Context) error {
+	if err := beginCmd.lotService.Begin(); err != nil {
+		writeToOutput(beginCmd.owriter, beginCmd.newlineOrNothing+"Sorry, a transaction is open already")
+		return nil
+	}
+
+	writeToOutput(beginCmd.owriter, beginCmd.newlineOrNothing+"Began a transaction")
+	return nil
+}
+func (commitCmd *CommitCommand) Execute(ctx context.Context) error {
+	committed, err := commitCmd.lotService.Commit(ctx)
+	var failed *TransactionFailedError
+	switch {
+	case errors.Is(err, ErrNoTransaction):
+		writeToOutput(commitCmd.owriter, commitCmd.newlineOrNothing+"Sorry, no transaction to commit")
+	case errors.As(err, &failed):
+		writeToOutput(commitCmd.owriter, fmt.Sprintf(commitCmd.newlineOrNothing+"Sorry, %s", failed))
+	case err != nil:
+		writeToOutput(commitCmd.owriter, fmt.Sprintf(commitCmd.newlineOrNothing+"Sorry, failed to roll back: %s", err))
+	default:
+		writeToOutput(commitCmd.owriter, fmt.Sprintf(commitCmd.newlineOrNothing+"Committed %s", countOf(committed, "change")))
+	}
+	return nil
+}
+func (rollbackCmd *RollbackCommand) Execute(ctx context.Context) error {
+	rolledBack, err := rollbackCmd.lotService.Rollback(ctx)
+	switch {
+	case errors.Is(err, ErrNoTransaction):
+		writeToOutput(rollbackCmd.owriter, rollbackCmd.newlineOrNothing+"Sorry, no transaction to roll back")
+	case err != nil:
+		writeToOutput(rollbackCmd.owriter, fmt.Sprintf(rollbackCmd.newlineOrNothing+"Sorry, failed to roll back: %s", err))
+	default:
+		writeToOutput(rollbackCmd.owriter, fmt.Sprintf(rollbackCmd.newlineOrNothing+"Rolled back %s", countOf(rolledBack, "change")))
+	}
+	return nil
+}
+
+// the detail of an event as listed by the history commands: the ticket, the reservation window or the attributes of the slot
+func describeEvent(event pm.Event) string {
+	switch {
+	case event.Undone != nil:
+		return fmt.Sprintf("%s %s", event.Undone.Type, describeEvent(*event.Undone))
+	case event.TicketID != "":
+		return event.TicketID
+	case event.Reservation != nil:
+		return fmt.Sprintf("%s - %s", event.Reservation.From.Format(timeLayout), event.Reservation.To.Format(timeLayout))
+	case event.Type == pm.EventSlotTagged:
+		return event.Attributes
+	}
+	return "-"
+}
+
+// the lot the command runs against, viewed at the instant of the command. Reports an unknown --lot itself.
+func (env commandEnv) resolveParkingLot(ctx context.Context) (*pm.ParkingLot, bool) {
+	if env.lotName == "" {
+		// only a snapshot which failed to load leaves a command file without a lot
+		parkingLot := env.lotService.GetParkingLot()
+		if parkingLot == nil {
+			writeToOutput(env.owriter, env.newlineOrNothing+"Sorry, no parking lot")
+			return nil, false
+		}
+		return env.lotService.lotAt(ctx, parkingLot), true
+	}
+
+	parkingLot, err := env.lotService.GetNamedParkingLot(env.lotName)
+	if err != nil {
+		writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, unknown parking lot: %s", env.lotName))
+		return nil, false
+	}
+	return env.lotService.lotAt(ctx, parkingLot), true
+}
+
+/*
+The lot holding the ticket, tickets are unique across the lots so a gate does not need to know the lot.
+
+With --lot only that lot is looked at. Reports an unknown ticket (or lot) itself.
+*/
+func (env commandEnv) resolveTicketLot(ctx context.Context, ticketID string) (*pm.ParkingLot, bool) {
+	if env.lotName != "" {
+		return env.resolveParkingLot(ctx)
+	}
+	if _, parkingLot, ok := env.lotService.FindTicket(ticketID); ok {
+		return env.lotService.lotAt(ctx, parkingLot), true
+	}
+	writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Sorry, unknown ticket: %s", ticketID))
+	return nil, false
+}
+
+// tells which slot got free, for how long the vehicle was parked and the fee it pays
+func (env commandEnv) reportLeave(parkingLot *pm.ParkingLot, slot int, vehicle *pm.Vehicle) {
+	now := parkingLot.Now()
+	fee := env.lotService.GetTariff().Fee(vehicle.GetType().String(), vehicle.GetEntryTime(), now)
+	writeToOutput(env.owriter, fmt.Sprintf(env.newlineOrNothing+"Slot number %s is free, parked for %s, fee %.2f", parkingLot.SlotLabel(slot), formatDuration(vehicle.GetParkedDuration(now)), fee))
+}
+
+/*
+Resolves the window of a reservation, each end is either 2024-11-01T10:00 or a time of today like 10:00.
+
+A window given as times only which ends before it starts ends on the next day, e.g. 22:00 06:00,
+one which is over already is the window of the next day, e.g. 08:00 08:30 at nine.
+*/
+func parseWindow(fromValue, toValue string, now time.Time) (time.Time, time.Time, error) {
+	from, err := parseWindowTime(fromValue, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseWindowTime(toValue, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if len(toValue) == len(windowClockLayout) && !to.After(from) {
+		to = to.AddDate(0, 0, 1)
+	}
+	if len(fromValue) == len(windowClockLayout) && len(toValue) == len(windowClockLayout) && !to.After(now) {
+		from, to = from.AddDate(0, 0, 1), to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+func parseWindowTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation(windowTimeLayout, value, now.Location()); err == nil {
+		return t, nil
+	}
+	clock, err := time.Parse(windowClockLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s", value)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location()), nil
+}
+
+// parks the waitlisted vehicles the freed slot(s) can take and reports them, with the ones the lot admitted during the command
+func (env commandEnv) admitWaitlisted(parkingLot *pm.ParkingLot) {
+	for _, admission := range parkingLot.AdmitWaitlisted() {
+		writeToOutput(env.owriter, fmt.Sprintf("\nAllocated slot number: %s to waitlisted vehicle %s, ticket: %s", parkingLot.SlotLabel(admission.Slot), admission.Vehicle.GetRegistrationNo(), admission.Vehicle.GetTicketID()))
+	}
+}
+
+// hours and minutes, e.g. 2h05m
+func formatDuration(duration time.Duration) string {
+	minutes := int(duration.Minutes())
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// the count with the noun, e.g. 1 change, 2 changes
+func countOf(count int, noun string) string {
+	if count == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// the command as entered, e.g. "park KA-01-HH-1234 White"
+func commandLine(commandName string, args []string) string {
+	return strings.Join(append([]string{commandName}, args...), " ")
+}
+
 func writeToOutput(writer *bufio.Writer, message string) {
 	fmt.Fprintf(writer, "%s", message)
 	writer.Flush()
@@ -0,0 +1,238 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+	"github.com/ilivestrong/internal/lib/pricing"
+)
+
+const (
+	DefaultMaxNumberOfSlots   = 20000
+	DefaultRegistrationFormat = pm.RegistrationFormatIndian
+	DefaultReservationGrace   = pm.DefaultReservationGrace
+	DefaultReservationLead    = pm.DefaultReservationLead
+	DefaultSpecialSlots       = "kept"
+
+	EnvMaxNumberOfSlots   = "PARKINGLOT_MAX_SLOTS"
+	EnvRegistrationFormat = "PARKINGLOT_REGISTRATION_FORMAT"
+	EnvStrictRegistration = "PARKINGLOT_STRICT_REGISTRATION"
+	EnvColorPalette       = "PARKINGLOT_COLOR_PALETTE"
+	EnvTariffFile         = "PARKINGLOT_TARIFF_FILE"
+	EnvReservationGrace   = "PARKINGLOT_RESERVATION_GRACE"
+	EnvReservationLead    = "PARKINGLOT_RESERVATION_LEAD"
+	EnvWaitlist           = "PARKINGLOT_WAITLIST"
+	EnvSpecialSlots       = "PARKINGLOT_SPECIAL_SLOTS"
+	EnvStateFile          = "PARKINGLOT_STATE_FILE"
+	EnvJournalFile        = "PARKINGLOT_JOURNAL_FILE"
+	EnvCompactEvery       = "PARKINGLOT_COMPACT_EVERY"
+	EnvEventLogFile       = "PARKINGLOT_EVENT_LOG_FILE"
+	EnvUndoLimit          = "PARKINGLOT_UNDO_LIMIT"
+	EnvHistoryLimit       = "PARKINGLOT_HISTORY_LIMIT"
+)
+
+type (
+	// Config holds the runtime settings of a lot service.
+	Config struct {
+		MaxSlots int
+
+		// RegistrationFormat names the pm registration validator, StrictRegistration makes park refuse invalid numbers.
+		RegistrationFormat string
+		StrictRegistration bool
+
+		// ColorPalette restricts the colours which can be parked, empty means any colour.
+		ColorPalette []string
+
+		// Clock stamps the entry of the vehicles, the system clock when nil.
+		Clock pm.Clock
+
+		// Tariff prices the stay of the vehicles on leave.
+		Tariff *pricing.Tariff
+
+		// ReservationGrace is how long a reserved slot waits for its vehicle after the window starts.
+		ReservationGrace time.Duration
+
+		// ReservationLead is how long before the window starts a reserved slot is kept free for its vehicle.
+		ReservationLead time.Duration
+
+		// Waitlist queues the vehicles which find a lot full instead of turning them away.
+		Waitlist bool
+
+		// SpecialSlots names the pm special slot policy, whether vehicles without needs may take tagged slots.
+		SpecialSlots string
+
+		// StateFile is the snapshot the lots are restored from on startup and saved to on exit, none when empty.
+		StateFile string
+
+		// JournalFile records the commands changing the lots before they are applied, to recover them after a crash.
+		// It is compacted into the state file every CompactEvery records.
+		JournalFile  string
+		CompactEvery int
+
+		// EventLogFile keeps the events of the lots, the lots are derived from it on startup, none when empty.
+		EventLogFile string
+
+		// UndoLimit is how many changes can be undone, 0 turns undo off.
+		UndoLimit int
+
+		// HistoryLimit is how many of the latest events are kept in memory, the history commands look back that far.
+		HistoryLimit int
+	}
+)
+
+func DefaultConfig() Config {
+	return Config{
+		MaxSlots:           DefaultMaxNumberOfSlots,
+		RegistrationFormat: DefaultRegistrationFormat,
+		Tariff:             pricing.DefaultTariff(),
+		ReservationGrace:   DefaultReservationGrace,
+		ReservationLead:    DefaultReservationLead,
+		SpecialSlots:       DefaultSpecialSlots,
+		CompactEvery:       DefaultCompactEvery,
+		UndoLimit:          DefaultUndoLimit,
+		HistoryLimit:       DefaultHistoryLimit,
+	}
+}
+
+/*
+Returns the default config overridden by the PARKINGLOT_* environment variables.
+
+Command line flags are applied on top of it by the caller.
+*/
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	if value, ok := os.LookupEnv(EnvMaxNumberOfSlots); ok {
+		maxSlots, err := strconv.Atoi(value)
+		if err != nil || maxSlots <= 0 {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvMaxNumberOfSlots, value)
+		}
+		cfg.MaxSlots = maxSlots
+	}
+	if value, ok := os.LookupEnv(EnvRegistrationFormat); ok {
+		cfg.RegistrationFormat = value
+	}
+	if value, ok := os.LookupEnv(EnvStrictRegistration); ok {
+		strict, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvStrictRegistration, value)
+		}
+		cfg.StrictRegistration = strict
+	}
+	if value, ok := os.LookupEnv(EnvColorPalette); ok {
+		cfg.ColorPalette = ParseColorPalette(value)
+	}
+	if value, ok := os.LookupEnv(EnvTariffFile); ok {
+		tariff, err := pricing.LoadTariff(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %v", EnvTariffFile, err)
+		}
+		cfg.Tariff = tariff
+	}
+	if value, ok := os.LookupEnv(EnvReservationGrace); ok {
+		grace, err := time.ParseDuration(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvReservationGrace, value)
+		}
+		cfg.ReservationGrace = grace
+	}
+	if value, ok := os.LookupEnv(EnvReservationLead); ok {
+		lead, err := time.ParseDuration(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvReservationLead, value)
+		}
+		cfg.ReservationLead = lead
+	}
+	if value, ok := os.LookupEnv(EnvWaitlist); ok {
+		waitlist, err := strconv.ParseBool(value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvWaitlist, value)
+		}
+		cfg.Waitlist = waitlist
+	}
+	if value, ok := os.LookupEnv(EnvSpecialSlots); ok {
+		cfg.SpecialSlots = value
+	}
+	if value, ok := os.LookupEnv(EnvStateFile); ok {
+		cfg.StateFile = value
+	}
+	if value, ok := os.LookupEnv(EnvJournalFile); ok {
+		cfg.JournalFile = value
+	}
+	if value, ok := os.LookupEnv(EnvCompactEvery); ok {
+		compactEvery, err := strconv.Atoi(value)
+		if err != nil || compactEvery <= 0 {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvCompactEvery, value)
+		}
+		cfg.CompactEvery = compactEvery
+	}
+	if value, ok := os.LookupEnv(EnvEventLogFile); ok {
+		cfg.EventLogFile = value
+	}
+	if value, ok := os.LookupEnv(EnvUndoLimit); ok {
+		undoLimit, err := strconv.Atoi(value)
+		if err != nil || undoLimit < 0 {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvUndoLimit, value)
+		}
+		cfg.UndoLimit = undoLimit
+	}
+	if value, ok := os.LookupEnv(EnvHistoryLimit); ok {
+		historyLimit, err := strconv.Atoi(value)
+		if err != nil || historyLimit <= 0 {
+			return cfg, fmt.Errorf("invalid %s: %q", EnvHistoryLimit, value)
+		}
+		cfg.HistoryLimit = historyLimit
+	}
+	return cfg, cfg.Validate()
+}
+
+func (cfg Config) Validate() error {
+	if cfg.MaxSlots <= 0 {
+		return fmt.Errorf("invalid max slots: %d", cfg.MaxSlots)
+	}
+	if _, err := pm.LookupRegistrationFormat(cfg.RegistrationFormat); err != nil {
+		return err
+	}
+	if _, err := pm.ParseSpecialSlotPolicy(cfg.SpecialSlots); err != nil {
+		return err
+	}
+	if cfg.ReservationGrace < 0 {
+		return fmt.Errorf("invalid reservation grace: %s", cfg.ReservationGrace)
+	}
+	if cfg.ReservationLead < 0 {
+		return fmt.Errorf("invalid reservation lead: %s", cfg.ReservationLead)
+	}
+	if cfg.JournalFile != "" && cfg.StateFile == "" {
+		return fmt.Errorf("a journal file needs a state file to be compacted into")
+	}
+	if cfg.EventLogFile != "" && (cfg.StateFile != "" || cfg.JournalFile != "") {
+		return fmt.Errorf("an event log file cannot be combined with a state or journal file, the lots are derived from the events")
+	}
+	if cfg.CompactEvery <= 0 {
+		return fmt.Errorf("invalid compact every: %d", cfg.CompactEvery)
+	}
+	if cfg.UndoLimit < 0 {
+		return fmt.Errorf("invalid undo limit: %d", cfg.UndoLimit)
+	}
+	if cfg.HistoryLimit <= 0 {
+		return fmt.Errorf("invalid history limit: %d", cfg.HistoryLimit)
+	}
+	if cfg.Tariff == nil {
+		return fmt.Errorf("%w: none configured", pricing.ErrInvalidTariff)
+	}
+	return cfg.Tariff.Validate()
+}
+
+// splits a comma separated list of colours, e.g. "white,red,gray"
+func ParseColorPalette(value string) []string {
+	palette := make([]string, 0)
+	for _, color := range strings.Split(value, ",") {
+		if color = strings.TrimSpace(color); color != "" {
+			palette = append(palette, color)
+		}
+	}
+	return palette
+}
@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the flags which take no value, they are set (to an empty value) by being given, e.g. status --times
+var switchFlags = map[string]bool{
+	"times": true,
+}
+
+/*
+Splits the args of a command into its positional args and its --name value flags.
+
+Only the flags in allowed are accepted, e.g. park KA-01-HH-1234 White --gate G2.
+*/
+func splitFlags(args []string, allowed ...string) ([]string, map[string]string, error) {
+	positional, flags := make([]string, 0, len(args)), map[string]string{}
+	for i := 0; i < len(args); i++ {
+		name, isFlag := strings.CutPrefix(args[i], "--")
+		if !isFlag {
+			positional = append(positional, args[i])
+			continue
+		}
+
+		known := false
+		for _, allowedName := range allowed {
+			known = known || name == allowedName
+		}
+		if !known {
+			return nil, nil, fmt.Errorf("unknown flag: --%s", name)
+		}
+		if switchFlags[name] {
+			flags[name] = ""
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, nil, fmt.Errorf("missing value for flag: --%s", name)
+		}
+		flags[name] = args[i+1]
+		i++
+	}
+	return positional, flags, nil
+}
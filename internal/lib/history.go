@@ -0,0 +1,206 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+)
+
+const DefaultHistoryLimit = 10000
+
+var (
+	ErrCorruptEventLog = errors.New("corrupt event log")
+)
+
+// the events about vehicles, as listed by the history of a registration number
+var vehicleEvents = map[pm.EventType]bool{
+	pm.EventParked:              true,
+	pm.EventLeft:                true,
+	pm.EventReserved:            true,
+	pm.EventReservationClaimed:  true,
+	pm.EventReservationReleased: true,
+	pm.EventReservationExpired:  true,
+	pm.EventReservationMoved:    true,
+	pm.EventWaitlisted:          true,
+	pm.EventWaitlistCancelled:   true,
+}
+
+/*
+Records an event of the service itself, stamped with the instant of the command of the context once it is told.
+
+The service does not time anything itself, before that the event is stamped with the time told last.
+*/
+func (ls *LotService) record(ctx context.Context, event pm.Event) {
+	event.At, event.Change = ls.clock.lastTold(), changeOf(ctx)
+	if in, ok := ctx.Value(instantKey{}).(*instant); ok {
+		if at, told := in.toldAt(); told {
+			event.At = at
+		}
+	}
+	ls.events.Append(event)
+}
+
+// the events of the vehicle across all the lots, the ones undone too, oldest first
+func (ls *LotService) HistoryForRegistrationNo(registrationNo string) []pm.Event {
+	if validator, err := pm.LookupRegistrationFormat(ls.config.RegistrationFormat); err == nil {
+		registrationNo = validator.Normalize(registrationNo)
+	}
+	return ls.events.Events(func(event pm.Event) bool {
+		isVehicleEvent := vehicleEvents[event.Type] || event.Undone != nil && vehicleEvents[event.Undone.Type]
+		return isVehicleEvent && event.RegistrationNo() == registrationNo
+	})
+}
+
+// the events of the slot of the named lot since the lot was created (or restored), oldest first
+func (ls *LotService) HistoryForSlot(lotName string, slot int) []pm.Event {
+	history := make([]pm.Event, 0)
+	for _, event := range ls.events.Events(func(event pm.Event) bool { return event.Lot == lotName }) {
+		switch {
+		case event.Type == pm.EventLotCreated || event.Type == pm.EventLotRestored:
+			history = history[:0]
+		case event.Slot == slot:
+			history = append(history, event)
+		}
+	}
+	return history
+}
+
+/*
+Derives the lots from the events in the file, then appends the events to come to it.
+
+The file holds an event per line, as JSON. A last line cut short by a crash is cut off the file,
+a line which cannot be read anywhere else is reported as ErrCorruptEventLog.
+*/
+func (ls *LotService) OpenEventLog(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	events, size, err := readEvents(file)
+	if err == nil {
+		err = ls.deriveLots(events)
+	}
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	ls.eventFile = file
+	ls.events.OnAppend(func(event pm.Event) {
+		ls.eventFileMu.Lock()
+		defer ls.eventFileMu.Unlock()
+
+		if ls.heldEvents != nil {
+			ls.heldEvents = append(ls.heldEvents, event)
+			return
+		}
+		ls.writeEvent(event)
+	})
+	return nil
+}
+
+// appends the event to the event log file, the caller holds eventFileMu
+func (ls *LotService) writeEvent(event pm.Event) {
+	line, err := json.Marshal(event)
+	if err == nil {
+		_, err = ls.eventFile.Write(append(line, '\n'))
+	}
+	if err != nil {
+		log.Printf("failed to write event %d to the event log: %v", event.Seq, err)
+	}
+}
+
+// reads the events of the file, returns them with the size of the complete lines
+func readEvents(file *os.File) ([]pm.Event, int64, error) {
+	content, err := os.ReadFile(file.Name())
+	if err != nil {
+		return nil, 0, err
+	}
+	events := make([]pm.Event, 0)
+	offset := 0
+	for offset < len(content) {
+		end := bytes.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			// the last line was not written completely
+			break
+		}
+		var event pm.Event
+		if err := json.Unmarshal(content[offset:offset+end], &event); err != nil {
+			return nil, 0, fmt.Errorf("%w: line %d: %v", ErrCorruptEventLog, len(events)+1, err)
+		}
+		events = append(events, event)
+		offset += end + 1
+	}
+	return events, int64(offset), nil
+}
+
+// replaces the lots with the ones derived from the events, the events are kept as the history
+func (ls *LotService) deriveLots(events []pm.Event) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	eventsByLot, activeLot := map[string][]pm.Event{}, ""
+	for _, event := range events {
+		switch event.Type {
+		case pm.EventSnapshotLoaded:
+			clear(eventsByLot)
+		case pm.EventLotCreated:
+			eventsByLot[event.Lot], activeLot = []pm.Event{event}, event.Lot
+		case pm.EventLotRestored:
+			eventsByLot[event.Lot] = []pm.Event{event}
+		case pm.EventLotSelected:
+			activeLot = event.Lot
+		case pm.EventLotDropped:
+			// the creation of the lot was undone
+			delete(eventsByLot, event.Lot)
+			if activeLot == event.Lot {
+				activeLot = ""
+			}
+		default:
+			if _, ok := eventsByLot[event.Lot]; !ok {
+				return fmt.Errorf("%w: event %d of unknown lot %s", ErrCorruptEventLog, event.Seq, event.Lot)
+			}
+			eventsByLot[event.Lot] = append(eventsByLot[event.Lot], event)
+		}
+	}
+
+	ls.events = pm.NewEventLog(events...)
+	ls.events.Bound(ls.config.HistoryLimit)
+	lots := make(map[string]*pm.ParkingLot, len(eventsByLot))
+	for name, lotEvents := range eventsByLot {
+		parkingLot, err := pm.DeriveParkingLot(lotEvents, append(ls.lotOptions(), pm.WithEventLog(ls.events, name))...)
+		if err != nil {
+			return fmt.Errorf("lot %s: %w", name, err)
+		}
+		lots[name] = parkingLot
+	}
+	ls.lots, ls.activeLot = lots, activeLot
+	return nil
+}
+
+// records the lots loaded from a snapshot, in the order of their names
+func (ls *LotService) recordSnapshotLoaded(ctx context.Context, lots map[string]*pm.ParkingLot, activeLot string) {
+	names := make([]string, 0, len(lots))
+	for name := range lots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ls.record(ctx, pm.Event{Type: pm.EventSnapshotLoaded})
+	for _, name := range names {
+		ls.record(ctx, pm.Event{Type: pm.EventLotRestored, Lot: name, State: lots[name].Snapshot()})
+	}
+	if activeLot != "" {
+		ls.record(ctx, pm.Event{Type: pm.EventLotSelected, Lot: activeLot})
+	}
+}
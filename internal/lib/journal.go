@@ -0,0 +1,365 @@
+package lib
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCompactEvery = 1000
+
+	// every record starts with the length and the CRC-32C of its payload
+	journalHeaderSize = 8
+)
+
+var (
+	ErrCorruptJournal = errors.New("corrupt journal")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// the commands changing the state of the lots, they are journaled before they are applied
+	journaledCommands = map[string]bool{
+		TokenForCreateParkingLot:      true,
+		TokenForPark:                  true,
+		TokenForParkAt:                true,
+		TokenForLeave:                 true,
+		TokenForLeaveByTicket:         true,
+		TokenForLeaveByRegistrationNo: true,
+		TokenForUseLot:                true,
+		TokenForReserve:               true,
+		TokenForCancelWaitlist:        true,
+		TokenForTagSlot:               true,
+		TokenForUndo:                  true,
+		TokenForRedo:                  true,
+		TokenForBegin:                 true,
+		TokenForCommit:                true,
+		TokenForRollback:              true,
+	}
+)
+
+type (
+	/*
+		JournalRecord is a command as it was entered, with the time it was applied at.
+
+		On disk a record is a big endian uint32 length, a big endian uint32 CRC-32C (Castagnoli) of the payload,
+		then the payload, the record as JSON:
+
+		{"seq": 42, "at": "2024-11-01T09:00:00Z", "command": "park", "args": ["KA-01-HH-1234", "White"]}
+
+		The sequence numbers go on across compactions, the snapshot keeps the last one it covers.
+	*/
+	JournalRecord struct {
+		Seq     uint64    `json:"seq"`
+		At      time.Time `json:"at"`
+		Command string    `json:"command"`
+		Args    []string  `json:"args,omitempty"`
+	}
+
+	// Journal is an append-only file of the commands applied since the last compaction.
+	Journal struct {
+		mu      sync.Mutex
+		file    *os.File
+		seq     uint64 // of the last record appended
+		records int    // appended since the journal was last reset
+
+		// Recovered is the number of bytes of a torn record, cut off the end of the file when it was opened.
+		Recovered int64
+	}
+
+	// journaledCommand appends its command to the journal of the lot service before executing it.
+	journaledCommand struct {
+		commandEnv
+		command Commander
+		name    string
+		args    []string
+	}
+)
+
+/*
+Opens (or creates) the journal file and returns the records it holds, in order.
+
+A record which was not written completely, e.g. because of a crash while appending it, is cut off the end of the file.
+A record which is damaged anywhere else is reported as ErrCorruptJournal, it is not the torn tail of an append
+and dropping it would lose the records behind it.
+*/
+func OpenJournal(fileName string) (*Journal, []JournalRecord, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	journal := &Journal{file: file}
+	records := make([]JournalRecord, 0)
+	offset := 0
+	for offset < len(content) {
+		record, size, err := decodeJournalRecord(content[offset:])
+		if err != nil {
+			if !isTorn(content[offset:]) {
+				file.Close()
+				return nil, nil, fmt.Errorf("%w: record at offset %d: %v", ErrCorruptJournal, offset, err)
+			}
+			break
+		}
+		records = append(records, record)
+		journal.seq = record.Seq
+		offset += size
+	}
+
+	if offset < len(content) {
+		journal.Recovered = int64(len(content) - offset)
+		if err := file.Truncate(int64(offset)); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	if _, err := file.Seek(int64(offset), io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	journal.records = len(records)
+	return journal, records, nil
+}
+
+// Appends the record with the next sequence number, it is on disk when Append returns.
+func (j *Journal) Append(record JournalRecord) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	record.Seq = j.seq + 1
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return 0, err
+	}
+	// one write, so a crash leaves at most one torn record at the end
+	buffer := make([]byte, journalHeaderSize, journalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buffer[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buffer[4:8], crc32.Checksum(payload, crcTable))
+	buffer = append(buffer, payload...)
+	if _, err := j.file.Write(buffer); err != nil {
+		return 0, err
+	}
+	if err := j.file.Sync(); err != nil {
+		return 0, err
+	}
+	j.seq, j.records = record.Seq, j.records+1
+	return record.Seq, nil
+}
+
+// the number of records appended since the journal was last reset
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.records
+}
+
+// Empties the journal once its records are in a snapshot, the sequence numbers go on.
+func (j *Journal) Reset() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	j.records = 0
+	return j.file.Sync()
+}
+
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// makes sure the next record comes after the given sequence number, e.g. the one of a snapshot
+func (j *Journal) resumeAfter(seq uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seq = max(j.seq, seq)
+}
+
+// decodes the record at the start of the content, returns it with its size on disk
+func decodeJournalRecord(content []byte) (JournalRecord, int, error) {
+	var record JournalRecord
+	if len(content) < journalHeaderSize {
+		return record, 0, io.ErrUnexpectedEOF
+	}
+	length := int(binary.BigEndian.Uint32(content[0:4]))
+	if length == 0 {
+		return record, 0, errors.New("empty record")
+	}
+	if len(content)-journalHeaderSize < length {
+		return record, 0, io.ErrUnexpectedEOF
+	}
+	payload := content[journalHeaderSize : journalHeaderSize+length]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(content[4:8]) {
+		return record, 0, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return record, 0, err
+	}
+	return record, journalHeaderSize + length, nil
+}
+
+/*
+Tells whether an undecodable record is the torn tail of the journal: no record can be decoded anywhere after it.
+
+A crash tears the last record only, the rest of the file may be zeros (preallocated by the file system).
+A good record further on means one in the middle was damaged, its length as much as its payload,
+the records after it must not be dropped.
+*/
+func isTorn(content []byte) bool {
+	for offset := 1; offset+journalHeaderSize < len(content); offset++ {
+		if _, _, err := decodeJournalRecord(content[offset:]); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Replays the journal records the lots do not have yet, then journals the commands built from now on.
+
+A record is applied as it was originally, at the time it was applied at, so the slots, tickets and entry times come out the same.
+Records up to the sequence number of the loaded snapshot are in it already and skipped,
+a transaction the journal ends within is rolled back, as it was not committed.
+*/
+func (ls *LotService) Recover(ctx context.Context, journal *Journal, records []JournalRecord) error {
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	builder := NewCommandBuilder("replay", bufio.NewWriter(io.Discard), ls)
+	for _, record := range records {
+		if record.Seq <= ls.journalSeq {
+			continue
+		}
+		command := builder.parseCommand(record.Command, record.Args...)
+		if command == nil {
+			return fmt.Errorf("%w: record %d: invalid command: %s", ErrCorruptJournal, record.Seq, record.Command)
+		}
+		if err := ls.apply(ctx, command, commandLine(record.Command, record.Args), record.At); err != nil {
+			return fmt.Errorf("replaying journal record %d: %w", record.Seq, err)
+		}
+		ls.journalSeq = record.Seq
+	}
+	journal.resumeAfter(ls.journalSeq)
+	ls.journal = journal
+
+	// the crash came before the transaction was committed
+	if ls.InTransaction() {
+		ctx := ls.atOneInstant(ctx)
+		if _, err := ls.Rollback(ctx); err != nil {
+			return fmt.Errorf("rolling back the transaction of the journal: %w", err)
+		}
+		seq, err := journal.Append(JournalRecord{At: ls.instantOf(ctx).Now(), Command: TokenForRollback})
+		if err != nil {
+			return err
+		}
+		ls.journalSeq = seq
+	}
+	return nil
+}
+
+/*
+Saves all the lots to the state file and empties the journal, as it is all in the snapshot.
+
+The snapshot is written before the journal is emptied, a crash in between replays no record twice:
+the snapshot keeps the sequence number of the last record it covers. Without a journal the lots are only saved.
+The changes compacted can no longer be undone, an undo replayed from the journal has to find the same history.
+*/
+func (ls *LotService) Compact() error {
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	return ls.compact()
+}
+
+func (ls *LotService) compact() error {
+	if err := ls.saveSnapshot(ls.config.StateFile, ls.journalSeq); err != nil {
+		return err
+	}
+	ls.ForgetChanges()
+	if ls.journal == nil {
+		return nil
+	}
+	return ls.journal.Reset()
+}
+
+// Closes the journal and the event log file, if any.
+func (ls *LotService) Close() error {
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	var errs []error
+	if ls.journal != nil {
+		errs = append(errs, ls.journal.Close())
+	}
+	if ls.eventFile != nil {
+		errs = append(errs, ls.eventFile.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (ls *LotService) isJournaling() bool {
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	return ls.journal != nil
+}
+
+// executes the command at the given time, see instant
+func (ls *LotService) apply(ctx context.Context, command Commander, commandLine string, at time.Time) error {
+	return ls.execute(withInstant(ctx, instantAt(at)), command, commandLine)
+}
+
+/*
+Appends the command to the journal, then executes it, compacting the journal every Config.CompactEvery records.
+
+Journaled commands run one at a time, so the journal is in the order they were applied in.
+*/
+func (jc *journaledCommand) Execute(ctx context.Context) error {
+	ls := jc.lotService
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	at := ls.clock.Now()
+	seq, err := ls.journal.Append(JournalRecord{At: at, Command: jc.name, Args: jc.args})
+	if err != nil {
+		// not applied, as it could not be recovered
+		writeToOutput(jc.owriter, fmt.Sprintf(jc.newlineOrNothing+"Sorry, failed to journal %s: %s", jc.name, err))
+		return err
+	}
+	err = ls.apply(ctx, jc.command, commandLine(jc.name, jc.args), at)
+	ls.journalSeq = seq
+	if err != nil {
+		return err
+	}
+
+	// the snapshot must not include the changes of an open transaction, a crash would keep them
+	if ls.journal.Len() >= ls.config.CompactEvery && !ls.InTransaction() {
+		if err := ls.compact(); err != nil {
+			writeToOutput(jc.owriter, fmt.Sprintf(jc.newlineOrNothing+"Sorry, failed to compact the journal: %s", err))
+		}
+	}
+	return nil
+}
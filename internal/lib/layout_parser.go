@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+)
+
+/*
+Parses the args of create_parking_lot into a layout.
+
+A bare number declares that many car (medium) sized slots, <size>=<count> declares slots of a size,
+e.g. "6" or "small=2 medium=10 large=3 xlarge=1". Slots are numbered in the order they are declared.
+Prefixing a group with L<level>: puts it on a level of a multi-level lot, e.g. "L1:20 L2:small=5 L2:15".
+Suffixing a group with +<attribute> tags its slots, e.g. "medium=2+ev+accessible 10".
+*/
+func parseLayout(args []string) (pm.Layout, error) {
+	layout := make(pm.Layout, 0, len(args))
+	for _, arg := range args {
+		var attributes pm.SlotAttributes
+		if group, attributeNames, ok := strings.Cut(arg, "+"); ok {
+			var err error
+			if attributes, err = pm.ParseSlotAttributes(attributeNames); err != nil {
+				return nil, err
+			}
+			arg = group
+		}
+
+		level := 0
+		if levelPart, group, ok := strings.Cut(arg, ":"); ok {
+			n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(levelPart), "L"))
+			if err != nil || !strings.HasPrefix(strings.ToUpper(levelPart), "L") {
+				return nil, fmt.Errorf("invalid level: %s", arg)
+			}
+			level, arg = n, group
+		}
+
+		size, count := pm.SlotSizeMedium, arg
+		if sizeName, value, ok := strings.Cut(arg, "="); ok {
+			var err error
+			if size, err = pm.ParseSlotSize(sizeName); err != nil {
+				return nil, err
+			}
+			count = value
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot count: %s", arg)
+		}
+		layout = append(layout, pm.SlotGroup{Level: level, Size: size, Count: n, Attributes: attributes})
+	}
+	return layout, nil
+}
+
+/*
+Reads the entry gates of a lot from a JSON file, e.g. {"gates": {"G1": [1, 2, 3], "G2": [3, 2, 1]}}.
+
+Each gate lists the distance of every slot to it, in the order of the slot numbers, so a lot of 3 slots needs 3 distances.
+*/
+func loadGates(fileName string, capacity int) ([]pm.Gate, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gates: %v", err)
+	}
+
+	var file struct {
+		Gates map[string][]int `json:"gates"`
+	}
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("%w: %v", pm.ErrInvalidGate, err)
+	}
+	gates := make([]pm.Gate, 0, len(file.Gates))
+	for name, distances := range file.Gates {
+		gates = append(gates, pm.Gate{Name: name, Distances: distances})
+	}
+	sort.Slice(gates, func(i, j int) bool { return gates[i].Name < gates[j].Name })
+	return gates, pm.ValidateGates(gates, capacity)
+}
@@ -0,0 +1,246 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+	"github.com/ilivestrong/internal/lib/pricing"
+)
+
+const DefaultLotName = "default"
+
+var (
+	ErrUnknownLot = errors.New("unknown parking lot")
+	ErrLotExists  = errors.New("parking lot exists already")
+)
+
+type (
+	LotService struct {
+		mu        sync.RWMutex
+		config    Config
+		lots      map[string]*pm.ParkingLot
+		activeLot string
+		tickets   *pm.TicketIssuer // shared by the lots, so a ticket is unique in the whole session
+		clock     *toldClock       // shared by the lots, the commands view them at an instant of it, see instant
+
+		journalMu  sync.Mutex // held while a journaled command is applied, see Recover
+		journal    *Journal
+		journalSeq uint64 // of the last journal record applied to the lots
+
+		events      *pm.EventLog // of all the lots, the history queries are answered from the latest ones
+		eventFileMu sync.Mutex
+		eventFile   *os.File   // the events are appended to, see OpenEventLog
+		heldEvents  []pm.Event // appended while a transaction is open, written to the file once it ends
+
+		changeMu    sync.Mutex   // held while a reversible command is executed, undone or redone
+		changeSeq   uint64       // of the latest change begun, its events are tagged with it, see changeSet
+		undoHistory []change     // the latest change last, at most Config.UndoLimit of them
+		redoHistory []change     // the changes undone, the latest undo last
+		transaction *transaction // open between begin and commit (or rollback)
+
+		parkMu sync.Mutex // held while a vehicle is parked, so a registration number is parked in one lot only
+	}
+
+	// VehicleParkedInOtherLotError is returned when parking a registration number which holds a slot in another lot of the service.
+	VehicleParkedInOtherLotError struct {
+		RegistrationNo string
+		LotSlot
+	}
+
+	// LotSlot locates a parked vehicle across the lots of a service.
+	LotSlot struct {
+		LotName string
+		Slot    int
+		Label   string
+	}
+)
+
+/*
+Instantiates a lot service object.
+
+The lot service owns the state of the named parking lots of a session and which one of them is active,
+each service is independent of the others, so several sessions can live side by side in one process.
+It is safe for concurrent use, the parking lots it hands out guard their own state.
+*/
+func NewLotService(config Config) *LotService {
+	var clock pm.Clock = pm.SystemClock{}
+	if config.Clock != nil {
+		clock = config.Clock
+	}
+	events := pm.NewEventLog()
+	events.Bound(config.HistoryLimit)
+	return &LotService{
+		config:  config,
+		lots:    map[string]*pm.ParkingLot{},
+		tickets: pm.NewTicketIssuer(),
+		clock:   &toldClock{clock: clock},
+		events:  events,
+	}
+}
+
+func (err *VehicleParkedInOtherLotError) Error() string {
+	return fmt.Sprintf("vehicle %s is already parked in lot %s at slot %s", err.RegistrationNo, err.LotName, err.Label)
+}
+func (err *VehicleParkedInOtherLotError) Unwrap() error {
+	return pm.ErrVehicleAlreadyParked
+}
+
+func (ls *LotService) GetMaxSlots() int {
+	return ls.config.MaxSlots
+}
+
+func (ls *LotService) GetTariff() *pricing.Tariff {
+	return ls.config.Tariff
+}
+
+/*
+Creates the named parking lot and makes it the active one, a lot of that name already is not replaced (ErrLotExists).
+
+The options are applied on top of the ones from the config.
+*/
+func (ls *LotService) CreateParkingLot(ctx context.Context, name string, layout pm.Layout, options ...pm.Option) (*pm.ParkingLot, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.lots[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrLotExists, name)
+	}
+	options = append(append(ls.lotOptions(), options...), pm.WithEventLog(ls.events, name))
+	parkingLot := pm.NewParkingLotWithLayout(layout, options...)
+	ls.lots[name] = parkingLot
+	ls.activeLot = name
+	ls.record(ctx, pm.Event{Type: pm.EventLotCreated, Lot: name, State: parkingLot.Snapshot()})
+	return parkingLot, nil
+}
+
+// returns the active parking lot, nil until a lot is created
+func (ls *LotService) GetParkingLot() *pm.ParkingLot {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return ls.lots[ls.activeLot]
+}
+
+func (ls *LotService) GetNamedParkingLot(name string) (*pm.ParkingLot, error) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	parkingLot, ok := ls.lots[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLot, name)
+	}
+	return parkingLot, nil
+}
+
+func (ls *LotService) HasParkingLot() bool {
+	return ls.GetParkingLot() != nil
+}
+
+func (ls *LotService) GetActiveLotName() string {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	return ls.activeLot
+}
+
+// the names of all the lots, sorted
+func (ls *LotService) GetLotNames() []string {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	names := make([]string, 0, len(ls.lots))
+	for name := range ls.lots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (ls *LotService) UseLot(ctx context.Context, name string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if _, ok := ls.lots[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownLot, name)
+	}
+	ls.activeLot = name
+	ls.record(ctx, pm.Event{Type: pm.EventLotSelected, Lot: name})
+	return nil
+}
+
+// looks the registration number up in every lot, in the order of the lot names
+func (ls *LotService) FindRegistrationNo(registrationNo string) []LotSlot {
+	found := make([]LotSlot, 0)
+	for _, name := range ls.GetLotNames() {
+		parkingLot, err := ls.GetNamedParkingLot(name)
+		if err != nil {
+			continue
+		}
+		if slot, ok := parkingLot.GetSlotByRegistrationNo(registrationNo); ok {
+			found = append(found, LotSlot{LotName: name, Slot: slot, Label: parkingLot.SlotLabel(slot)})
+		}
+	}
+	return found
+}
+
+/*
+Parks a vehicle into the lot with park, unless the registration number holds a slot in another lot of the service.
+
+Vehicles are parked one at a time, so two lots cannot take the same registration number side by side.
+The lot parked into checks the registration number itself.
+*/
+func (ls *LotService) parkOnce(parkingLot *pm.ParkingLot, registrationNo string, park func() (int, error)) (int, error) {
+	ls.parkMu.Lock()
+	defer ls.parkMu.Unlock()
+
+	for _, name := range ls.GetLotNames() {
+		otherLot, err := ls.GetNamedParkingLot(name)
+		if err != nil || otherLot.SameLot(parkingLot) {
+			continue
+		}
+		if vehicle, slot, ok := otherLot.GetVehicleByRegistrationNo(registrationNo); ok {
+			return 0, &VehicleParkedInOtherLotError{RegistrationNo: vehicle.GetRegistrationNo(), LotSlot: LotSlot{LotName: name, Slot: slot, Label: otherLot.SlotLabel(slot)}}
+		}
+	}
+	return park()
+}
+
+// finds the lot holding the ticket, in the order of the lot names
+func (ls *LotService) FindTicket(ticketID string) (string, *pm.ParkingLot, bool) {
+	for _, name := range ls.GetLotNames() {
+		parkingLot, err := ls.GetNamedParkingLot(name)
+		if err != nil {
+			continue
+		}
+		if _, _, ok := parkingLot.GetVehicleByTicket(ticketID); ok {
+			return name, parkingLot, true
+		}
+	}
+	return "", nil, false
+}
+
+// translates the config into parking lot options, the config is validated up front by the caller
+func (ls *LotService) lotOptions() []pm.Option {
+	options := []pm.Option{
+		pm.WithColorCanonicalizer(pm.NewColorCanonicalizer(ls.config.ColorPalette...)),
+		pm.WithTicketIssuer(ls.tickets),
+		pm.WithReservationGrace(ls.config.ReservationGrace),
+		pm.WithReservationLead(ls.config.ReservationLead),
+		pm.WithClock(ls.clock),
+	}
+	if validator, err := pm.LookupRegistrationFormat(ls.config.RegistrationFormat); err == nil {
+		options = append(options, pm.WithRegistrationValidator(validator, ls.config.StrictRegistration))
+	}
+	if policy, err := pm.ParseSpecialSlotPolicy(ls.config.SpecialSlots); err == nil {
+		options = append(options, pm.WithSpecialSlotPolicy(policy))
+	}
+	if ls.config.Waitlist {
+		options = append(options, pm.WithWaitlist())
+	}
+	return options
+}
@@ -0,0 +1,277 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+const (
+	AllocationNearest      = "nearest"
+	AllocationFarthest     = "farthest"
+	AllocationRoundRobin   = "round-robin"
+	AllocationRandom       = "random"
+	AllocationLoadBalanced = "load-balanced"
+)
+
+var (
+	ErrUnknownAllocationStrategy = errors.New("unknown allocation strategy")
+
+	allocationStrategyNames = []string{AllocationNearest, AllocationFarthest, AllocationRoundRobin, AllocationRandom, AllocationLoadBalanced}
+)
+
+type (
+	/*
+		AllocationStrategy picks the slot a vehicle is parked (or a reservation is held) at.
+
+		The lot narrows the free slots down to the candidates first: the smallest slot size fitting the vehicle,
+		then the slots with the fewest attributes the vehicle does not need.
+		The strategy only chooses among them, it returns the index of a candidate and one of its free slots.
+		A strategy may keep state between the choices, it is called under the lock of its lot and must not be shared by lots.
+	*/
+	AllocationStrategy interface {
+		Choose(candidates []Candidate) (int, int)
+	}
+
+	// Candidate is a pool of free slots fitting a vehicle, they have the same size and attributes within a slot group.
+	Candidate struct {
+		Level int
+		// LevelRank orders the levels by the level order of the lot, the lowest rank is filled first.
+		LevelRank int
+		// Zone is the level of a multi-level lot and the slot group of a flat one.
+		Zone         int
+		ZoneFree     int
+		ZoneCapacity int
+		pool         *slotAllocator
+	}
+
+	// nearestStrategy fills the lot from the entrance: the preferred level first, then the lowest slot number.
+	nearestStrategy struct{}
+
+	// farthestStrategy fills the lot from its far end: the last level in the level order first, then the highest slot number.
+	farthestStrategy struct{}
+
+	// roundRobinStrategy moves to the next level with a free slot on every allocation, nearest slot within a level.
+	roundRobinStrategy struct {
+		lastRank int
+		started  bool
+	}
+
+	// randomStrategy picks any of the fitting free slots with the same probability.
+	randomStrategy struct {
+		seed   int64
+		source *countingSource
+		rnd    *rand.Rand
+	}
+
+	// countingSource counts the values drawn from it, so a restored strategy can skip as many.
+	countingSource struct {
+		rand.Source
+		drawn int64
+	}
+
+	// loadBalancedStrategy picks the zone with the lowest occupancy, nearest slot within a zone.
+	loadBalancedStrategy struct{}
+
+	// builtinStrategy is a strategy NewAllocationStrategy can make again, see Snapshot.
+	builtinStrategy interface {
+		nameAndSeed() (string, int64)
+		// where the strategy is in its sequence, false when it has no sequence or has not started it
+		position() (int64, bool)
+		seek(position int64)
+		// back to the start of the sequence, as the strategy was made
+		reset()
+	}
+)
+
+/*
+Returns a new strategy by name, one of nearest, farthest, round-robin, random and load-balanced.
+
+The seed only matters to random, the same seed gives the same sequence of slots.
+*/
+func NewAllocationStrategy(name string, seed int64) (AllocationStrategy, error) {
+	switch strings.ToLower(name) {
+	case AllocationNearest:
+		return nearestStrategy{}, nil
+	case AllocationFarthest:
+		return farthestStrategy{}, nil
+	case AllocationRoundRobin:
+		return &roundRobinStrategy{}, nil
+	case AllocationRandom:
+		source := &countingSource{Source: rand.NewSource(seed)}
+		return &randomStrategy{seed: seed, source: source, rnd: rand.New(source)}, nil
+	case AllocationLoadBalanced:
+		return loadBalancedStrategy{}, nil
+	}
+	return nil, fmt.Errorf("%w: %s (one of %s)", ErrUnknownAllocationStrategy, name, strings.Join(allocationStrategyNames, ", "))
+}
+
+// Allocates the slots with the given strategy, nearest is the default.
+func WithAllocationStrategy(strategy AllocationStrategy) Option {
+	return func(pl *ParkingLot) {
+		pl.allocationStrategy = strategy
+	}
+}
+
+// the lowest free slot of the candidate
+func (c Candidate) Nearest() int {
+	slot, _ := c.pool.Peek()
+	return slot
+}
+
+// the highest free slot of the candidate
+func (c Candidate) Farthest() int {
+	slot, _ := c.pool.PeekLast()
+	return slot
+}
+
+// the number of free slots of the candidate, never 0
+func (c Candidate) Len() int {
+	return c.pool.Len()
+}
+
+// the free slots of the candidate in ascending order
+func (c Candidate) Slots() []int {
+	return c.pool.Slots()
+}
+
+// the free slot of the candidate with n free slots below it, n is below Len
+func (c Candidate) Slot(n int) int {
+	return c.pool.Nth(n)
+}
+
+func (nearestStrategy) Choose(candidates []Candidate) (int, int) {
+	return nearest(candidates, func(Candidate) bool { return true })
+}
+
+func (farthestStrategy) Choose(candidates []Candidate) (int, int) {
+	chosen, chosenSlot := 0, candidates[0].Farthest()
+	for i, candidate := range candidates[1:] {
+		slot := candidate.Farthest()
+		if candidate.LevelRank > candidates[chosen].LevelRank ||
+			candidate.LevelRank == candidates[chosen].LevelRank && slot > chosenSlot {
+			chosen, chosenSlot = i+1, slot
+		}
+	}
+	return chosen, chosenSlot
+}
+
+func (rr *roundRobinStrategy) Choose(candidates []Candidate) (int, int) {
+	// the first level after the last one used, wrapping around to the first level
+	next, first := 0, 0
+	hasNext := false
+	for i, candidate := range candidates {
+		if candidate.LevelRank < candidates[first].LevelRank {
+			first = i
+		}
+		if rr.started && candidate.LevelRank > rr.lastRank && (!hasNext || candidate.LevelRank < candidates[next].LevelRank) {
+			next, hasNext = i, true
+		}
+	}
+	rank := candidates[first].LevelRank
+	if hasNext {
+		rank = candidates[next].LevelRank
+	}
+	rr.lastRank, rr.started = rank, true
+	return nearest(candidates, func(candidate Candidate) bool { return candidate.LevelRank == rank })
+}
+
+func (rs *randomStrategy) Choose(candidates []Candidate) (int, int) {
+	total := 0
+	for _, candidate := range candidates {
+		total += candidate.Len()
+	}
+	n := rs.rnd.Intn(total)
+	for i, candidate := range candidates {
+		if n < candidate.Len() {
+			return i, candidate.Slot(n)
+		}
+		n -= candidate.Len()
+	}
+	return 0, candidates[0].Nearest() // unreachable, the lengths add up to total
+}
+
+func (loadBalancedStrategy) Choose(candidates []Candidate) (int, int) {
+	// occupied/capacity compared by cross multiplication
+	occupied := func(c Candidate) int { return c.ZoneCapacity - c.ZoneFree }
+	least := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if occupied(candidate)*least.ZoneCapacity < occupied(least)*candidate.ZoneCapacity {
+			least = candidate
+		}
+	}
+	return nearest(candidates, func(candidate Candidate) bool {
+		return occupied(candidate)*least.ZoneCapacity == occupied(least)*candidate.ZoneCapacity
+	})
+}
+
+func (nearestStrategy) nameAndSeed() (string, int64)      { return AllocationNearest, 0 }
+func (farthestStrategy) nameAndSeed() (string, int64)     { return AllocationFarthest, 0 }
+func (*roundRobinStrategy) nameAndSeed() (string, int64)  { return AllocationRoundRobin, 0 }
+func (rs *randomStrategy) nameAndSeed() (string, int64)   { return AllocationRandom, rs.seed }
+func (loadBalancedStrategy) nameAndSeed() (string, int64) { return AllocationLoadBalanced, 0 }
+
+func (nearestStrategy) position() (int64, bool)      { return 0, false }
+func (farthestStrategy) position() (int64, bool)     { return 0, false }
+func (loadBalancedStrategy) position() (int64, bool) { return 0, false }
+func (nearestStrategy) seek(int64)                   {}
+func (farthestStrategy) seek(int64)                  {}
+func (loadBalancedStrategy) seek(int64)              {}
+func (nearestStrategy) reset()                       {}
+func (farthestStrategy) reset()                      {}
+func (loadBalancedStrategy) reset()                  {}
+
+// the rank of the level used last
+func (rr *roundRobinStrategy) position() (int64, bool) {
+	return int64(rr.lastRank), rr.started
+}
+
+func (rr *roundRobinStrategy) seek(position int64) {
+	rr.lastRank, rr.started = int(position), true
+}
+
+func (rr *roundRobinStrategy) reset() {
+	rr.lastRank, rr.started = 0, false
+}
+
+// the number of values drawn
+func (rs *randomStrategy) position() (int64, bool) {
+	return rs.source.drawn, rs.source.drawn > 0
+}
+
+func (rs *randomStrategy) seek(position int64) {
+	if position < rs.source.drawn {
+		// a source cannot go back, it is drawn from the seed again
+		rs.reset()
+	}
+	for rs.source.drawn < position {
+		rs.source.Int63()
+	}
+}
+
+func (rs *randomStrategy) reset() {
+	rs.source = &countingSource{Source: rand.NewSource(rs.seed)}
+	rs.rnd = rand.New(rs.source)
+}
+
+func (cs *countingSource) Int63() int64 {
+	cs.drawn++
+	return cs.Source.Int63()
+}
+
+// the nearest slot among the accepted candidates, at least one candidate is expected to be accepted
+func nearest(candidates []Candidate, accept func(candidate Candidate) bool) (int, int) {
+	chosen, chosenSlot := -1, 0
+	for i, candidate := range candidates {
+		if !accept(candidate) {
+			continue
+		}
+		slot := candidate.Nearest()
+		if chosen < 0 || candidate.LevelRank < candidates[chosen].LevelRank ||
+			candidate.LevelRank == candidates[chosen].LevelRank && slot < chosenSlot {
+			chosen, chosenSlot = i, slot
+		}
+	}
+	return chosen, chosenSlot
+}
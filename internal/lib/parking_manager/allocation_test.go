@@ -0,0 +1,132 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// numbers the cars parked by parkCars
+var parkedCars int
+
+// parks count cars and returns their slots
+func parkCars(t *testing.T, parkingLot *ParkingLot, count int) []int {
+	t.Helper()
+	slots := make([]int, 0, count)
+	for range count {
+		parkedCars++
+		slot, err := parkingLot.Park(NewVehicle(fmt.Sprintf("KA-01-HH-%04d", parkedCars), "White"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+func TestAllocationStrategies(t *testing.T) {
+	levels := Layout{
+		{Level: 1, Size: SlotSizeMedium, Count: 3},
+		{Level: 2, Size: SlotSizeMedium, Count: 2},
+		{Level: 3, Size: SlotSizeMedium, Count: 3},
+	}
+	zones := Layout{
+		{Size: SlotSizeMedium, Count: 4},
+		{Size: SlotSizeMedium, Count: 2},
+	}
+	tests := []struct {
+		strategy string
+		layout   Layout
+		options  []Option
+		want     []int
+	}{
+		{AllocationNearest, levels, nil, []int{1, 2, 3, 4, 5, 6}},
+		{AllocationNearest, levels, []Option{WithLevelOrder(LevelOrderHighestFirst)}, []int{6, 7, 8, 4, 5, 1}},
+		{AllocationFarthest, levels, nil, []int{8, 7, 6, 5, 4, 3}},
+		{AllocationFarthest, levels, []Option{WithLevelOrder(LevelOrderHighestFirst)}, []int{3, 2, 1, 5, 4, 8}},
+		{AllocationRoundRobin, levels, nil, []int{1, 4, 6, 2, 5, 7, 3, 8}},
+		{AllocationRoundRobin, zones, nil, []int{1, 2, 3, 4, 5, 6}},
+		{AllocationLoadBalanced, levels, nil, []int{1, 4, 6, 2, 7, 5}},
+		{AllocationLoadBalanced, zones, nil, []int{1, 5, 2, 3, 6, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			strategy, err := NewAllocationStrategy(tt.strategy, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parkingLot := NewParkingLotWithLayout(tt.layout, append(tt.options, WithAllocationStrategy(strategy))...)
+			if got := parkCars(t, parkingLot, len(tt.want)); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected slots %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRandomAllocationIsSeeded(t *testing.T) {
+	run := func(seed int64) []int {
+		strategy, err := NewAllocationStrategy(AllocationRandom, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parkingLot := NewParkingLot(20, WithAllocationStrategy(strategy))
+		slots := parkCars(t, parkingLot, 10)
+
+		// freed slots come back into the draw
+		for _, slot := range slots[:5] {
+			if _, err := parkingLot.Leave(slot); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return append(slots, parkCars(t, parkingLot, 15)...)
+	}
+
+	first := run(7)
+	if second := run(7); fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Fatalf("expected the same slots for the same seed, got %v and %v", first, second)
+	}
+	if other := run(8); fmt.Sprint(first) == fmt.Sprint(other) {
+		t.Errorf("expected other slots for another seed, got %v twice", first)
+	}
+
+	// the lot fills up exactly, no slot given twice
+	seen := map[int]bool{}
+	for _, slot := range first[10:] {
+		if seen[slot] {
+			t.Fatalf("slot %d given twice in %v", slot, first)
+		}
+		seen[slot] = true
+	}
+	for _, slot := range first[5:10] {
+		if seen[slot] {
+			t.Fatalf("slot %d given twice in %v", slot, first)
+		}
+	}
+}
+
+func TestFarthestAllocationReusesFreedSlots(t *testing.T) {
+	strategy, _ := NewAllocationStrategy(AllocationFarthest, 0)
+	parkingLot := NewParkingLot(5, WithAllocationStrategy(strategy))
+	parkCars(t, parkingLot, 5)
+
+	for _, slot := range []int{2, 4} {
+		if _, err := parkingLot.Leave(slot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := parkCars(t, parkingLot, 2); got[0] != 4 || got[1] != 2 {
+		t.Fatalf("expected slots [4 2], got %v", got)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-9999", "White")); !errors.Is(err, ErrParkingLotFull) {
+		t.Fatalf("expected a full lot, got %v", err)
+	}
+	if slots := parkingLot.GetAvailableSlots(); len(slots) != 0 {
+		t.Fatalf("expected no free slots, got %v", slots)
+	}
+}
+
+func TestUnknownAllocationStrategy(t *testing.T) {
+	if _, err := NewAllocationStrategy("cheapest", 0); !errors.Is(err, ErrUnknownAllocationStrategy) {
+		t.Fatalf("expected ErrUnknownAllocationStrategy, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+const (
+	SlotAttributeAccessible SlotAttributes = 1 << iota
+	SlotAttributeEV
+	SlotAttributeStaff
+	SlotAttributeCompact
+)
+
+const (
+	// SpecialSlotsKept gives the tagged slots only to the vehicles needing them.
+	SpecialSlotsKept SpecialSlotPolicy = iota
+	// SpecialSlotsLastResort lets any vehicle have a tagged slot once the untagged ones are taken.
+	SpecialSlotsLastResort
+)
+
+var (
+	ErrUnknownSlotAttribute     = errors.New("unknown slot attribute")
+	ErrUnknownSpecialSlotPolicy = errors.New("unknown special slot policy")
+	ErrNoSlotWithAttributes     = errors.New("no free slot has the attributes")
+
+	slotAttributeNames     = []string{"accessible", "ev", "staff", "compact"}
+	specialSlotPolicyNames = []string{"kept", "last-resort"}
+)
+
+type (
+	// SlotAttributes is the set of special features of a slot, or the features a vehicle needs.
+	SlotAttributes uint8
+
+	// SpecialSlotPolicy tells whether vehicles without needs may be given tagged slots.
+	SpecialSlotPolicy int
+)
+
+// parses a comma (or plus) separated list of attributes, e.g. "ev,accessible", "none" or "" is no attribute
+func ParseSlotAttributes(names string) (SlotAttributes, error) {
+	var attributes SlotAttributes
+	for _, name := range strings.FieldsFunc(names, func(r rune) bool { return r == ',' || r == '+' }) {
+		if strings.EqualFold(name, "none") {
+			continue
+		}
+		found := false
+		for i, attributeName := range slotAttributeNames {
+			if strings.EqualFold(name, attributeName) {
+				attributes |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownSlotAttribute, name)
+		}
+	}
+	return attributes, nil
+}
+
+func (attributes SlotAttributes) String() string {
+	names := make([]string, 0, len(slotAttributeNames))
+	for i, name := range slotAttributeNames {
+		if attributes&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// whether every attribute of other is in the set
+func (attributes SlotAttributes) Has(other SlotAttributes) bool {
+	return attributes&other == other
+}
+
+func ParseSpecialSlotPolicy(name string) (SpecialSlotPolicy, error) {
+	for policy, policyName := range specialSlotPolicyNames {
+		if strings.EqualFold(name, policyName) {
+			return SpecialSlotPolicy(policy), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownSpecialSlotPolicy, name)
+}
+
+func (policy SpecialSlotPolicy) String() string {
+	if policy < 0 || int(policy) >= len(specialSlotPolicyNames) {
+		return fmt.Sprintf("policy(%d)", int(policy))
+	}
+	return specialSlotPolicyNames[policy]
+}
+
+// Decides whether vehicles without needs may be given tagged slots, SpecialSlotsKept by default.
+func WithSpecialSlotPolicy(policy SpecialSlotPolicy) Option {
+	return func(pl *ParkingLot) {
+		pl.specialSlotPolicy = policy
+	}
+}
+
+// a vehicle which needs slots with the attributes, e.g. an EV charger
+func NewVehicleNeeding(registrationNo string, color string, vehicleType VehicleType, needs SlotAttributes) *Vehicle {
+	vehicle := NewVehicleOfType(registrationNo, color, vehicleType)
+	vehicle.needs = needs
+	return vehicle
+}
+
+func (vehicle *Vehicle) GetNeeds() SlotAttributes {
+	return vehicle.needs
+}
+
+func (pl *ParkingLot) GetSlotAttributes(slot int) (SlotAttributes, bool) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	seg, ok := findSegment(pl.segments, slot)
+	if !ok {
+		return 0, false
+	}
+	return seg.attributesOf(slot), true
+}
+
+/*
+Replaces the attributes of the slot, no attributes makes it an ordinary slot again.
+
+A free slot moves to the pool of its new attributes right away, an occupied (or held) one once it is freed.
+*/
+func (pl *ParkingLot) TagSlot(slot int, attributes SlotAttributes) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	seg, ok := findSegment(pl.segments, slot)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrInvalidSlot, slot)
+	}
+	pl.tagSlot(seg, slot, attributes)
+	return nil
+}
+
+// see TagSlot, the caller holds the lock
+func (pl *ParkingLot) tagSlot(seg *segment, slot int, attributes SlotAttributes) {
+	previous := seg.attributesOf(slot)
+	if previous == attributes {
+		return
+	}
+
+	free := pl.isFree(slot)
+	seg.setAttributes(slot, attributes)
+	if free {
+		seg.pool(previous).Take(slot)
+		pl.releaseTo(seg, slot)
+	}
+	pl.record(Event{Type: EventSlotTagged, Slot: slot, Attributes: attributes.String(), PreviousAttributes: previous.String()})
+}
+
+// the attributes of a slot of the segment
+func (seg *segment) attributesOf(slot int) SlotAttributes {
+	if attributes, ok := seg.retagged[slot]; ok {
+		return attributes
+	}
+	return seg.attributes
+}
+
+func (seg *segment) setAttributes(slot int, attributes SlotAttributes) {
+	if attributes == seg.attributes {
+		delete(seg.retagged, slot)
+		return
+	}
+	if seg.retagged == nil {
+		seg.retagged = map[int]SlotAttributes{}
+	}
+	seg.retagged[slot] = attributes
+}
+
+// the allocator of the free slots with exactly the attributes, created empty on first use
+func (seg *segment) pool(attributes SlotAttributes) *slotAllocator {
+	free, ok := seg.pools[attributes]
+	if !ok {
+		free = newEmptySlotAllocator()
+		seg.pools[attributes] = free
+	}
+	return free
+}
+
+// the number of attributes a slot has beyond the needed ones, fewer is a better match
+func extraAttributes(attributes, needs SlotAttributes) int {
+	return bits.OnesCount8(uint8(attributes &^ needs))
+}
@@ -0,0 +1,101 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParkingLotKeepsSpecialSlotsForVehiclesNeedingThem(t *testing.T) {
+	type step struct {
+		needs SlotAttributes
+		slot  int
+		err   error
+	}
+	layout := Layout{
+		{Size: SlotSizeMedium, Count: 2, Attributes: SlotAttributeEV},
+		{Size: SlotSizeMedium, Count: 1, Attributes: SlotAttributeEV | SlotAttributeAccessible},
+		{Size: SlotSizeMedium, Count: 1},
+	}
+
+	for policy, steps := range map[SpecialSlotPolicy][]step{
+		SpecialSlotsKept: {
+			{0, 4, nil},
+			{0, 0, ErrNoSlotForVehicleType},
+			{SlotAttributeAccessible, 3, nil},
+			{SlotAttributeEV, 1, nil},
+			{SlotAttributeEV | SlotAttributeAccessible, 0, ErrNoSlotWithAttributes},
+		},
+		SpecialSlotsLastResort: {
+			{0, 4, nil},
+			{0, 1, nil},
+			{SlotAttributeEV, 2, nil},
+			{SlotAttributeEV, 3, nil},
+			{0, 0, ErrParkingLotFull},
+		},
+	} {
+		parkingLot := NewParkingLotWithLayout(layout, WithSpecialSlotPolicy(policy))
+		for i, step := range steps {
+			slot, err := parkingLot.Park(NewVehicleNeeding(fmt.Sprintf("KA-01-HH-%04d", i), "White", VehicleTypeCar, step.needs))
+			if !errors.Is(err, step.err) || slot != step.slot {
+				t.Fatalf("%s, step %d: needing %s, expected slot %d (%v), got %d (%v)", policy, i, step.needs, step.slot, step.err, slot, err)
+			}
+		}
+	}
+}
+
+func TestParkingLotTagSlot(t *testing.T) {
+	parkingLot := NewParkingLot(3)
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a free slot is set aside right away, an occupied one once it is freed
+	for _, slot := range []int{1, 2} {
+		if err := parkingLot.TagSlot(slot, SlotAttributeStaff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-0002", "White")); err != nil || slot != 3 {
+		t.Fatalf("expected the untagged slot 3, got %d (%v)", slot, err)
+	}
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0003", "White")); !errors.Is(err, ErrNoSlotForVehicleType) {
+		t.Fatalf("expected the staff slots to be kept, got %v", err)
+	}
+	if slot, err := parkingLot.Park(NewVehicleNeeding("KA-01-HH-0004", "White", VehicleTypeCar, SlotAttributeStaff)); err != nil || slot != 1 {
+		t.Fatalf("expected the staff slot 1, got %d (%v)", slot, err)
+	}
+
+	if err := parkingLot.TagSlot(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if attributes, _ := parkingLot.GetSlotAttributes(2); attributes != 0 {
+		t.Errorf("expected slot 2 to be untagged, got %s", attributes)
+	}
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-0003", "White")); err != nil || slot != 2 {
+		t.Fatalf("expected the untagged slot 2, got %d (%v)", slot, err)
+	}
+	if available := parkingLot.GetAvailableSlotCount(); available != 0 {
+		t.Errorf("expected a full lot, %d slots available", available)
+	}
+
+	if err := parkingLot.TagSlot(4, SlotAttributeEV); !errors.Is(err, ErrInvalidSlot) {
+		t.Errorf("expected %v, got %v", ErrInvalidSlot, err)
+	}
+}
+
+func TestParseSlotAttributes(t *testing.T) {
+	attributes, err := ParseSlotAttributes("EV,accessible")
+	if err != nil || attributes != SlotAttributeEV|SlotAttributeAccessible || attributes.String() != "accessible,ev" {
+		t.Errorf("expected accessible,ev, got %s (%v)", attributes, err)
+	}
+	if attributes, err := ParseSlotAttributes("none"); err != nil || attributes != 0 {
+		t.Errorf("expected no attributes, got %s (%v)", attributes, err)
+	}
+	if _, err := ParseSlotAttributes("ev,valet"); !errors.Is(err, ErrUnknownSlotAttribute) {
+		t.Errorf("expected %v, got %v", ErrUnknownSlotAttribute, err)
+	}
+}
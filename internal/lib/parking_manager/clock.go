@@ -0,0 +1,44 @@
+package parkingmanager
+
+import (
+	"time"
+)
+
+type (
+	// Clock tells the time vehicles enter and leave, tests swap it for a fake one.
+	Clock interface {
+		Now() time.Time
+	}
+
+	SystemClock struct{}
+)
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Stamps the entry time of the parked vehicles with the given clock, the system clock by default.
+func WithClock(clock Clock) Option {
+	return func(pl *ParkingLot) {
+		pl.clock = clock
+	}
+}
+
+func (pl *ParkingLot) Now() time.Time {
+	return pl.clock.Now()
+}
+
+/*
+Returns a view of the lot telling the time of the given clock, it shares everything else with the lot.
+
+Whoever needs a series of calls to happen at one instant works on a view with a clock stopped at that instant,
+while the lot and its other views go on telling their own time.
+*/
+func (pl *ParkingLot) View(clock Clock) *ParkingLot {
+	return &ParkingLot{lotState: pl.lotState, clock: clock, change: pl.change}
+}
+
+// whether both are the same lot, or views of it
+func (pl *ParkingLot) SameLot(other *ParkingLot) bool {
+	return other != nil && pl.lotState == other.lotState
+}
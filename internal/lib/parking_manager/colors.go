@@ -0,0 +1,63 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrUnknownColor = errors.New("unknown color")
+
+	// spellings of the same colour only, shades such as silver or navy stay colours of their own
+	defaultColorAliases = map[string]string{
+		"grey": "gray",
+	}
+)
+
+type (
+	/*
+		ColorCanonicalizer turns the colour spelled by an operator into the key vehicles are indexed by.
+
+		The key is case folded and aliases are resolved, so White, white and WHITE are one colour
+		and so are grey and gray. With a palette only the colours in it are accepted.
+	*/
+	ColorCanonicalizer struct {
+		aliases map[string]string
+		palette map[string]struct{}
+	}
+)
+
+/*
+Instantiates a colour canonicalizer with the built-in aliases.
+
+An empty palette accepts any colour.
+*/
+func NewColorCanonicalizer(palette ...string) *ColorCanonicalizer {
+	cc := &ColorCanonicalizer{aliases: defaultColorAliases}
+	if len(palette) > 0 {
+		cc.palette = make(map[string]struct{}, len(palette))
+		for _, color := range palette {
+			cc.palette[cc.fold(color)] = struct{}{}
+		}
+	}
+	return cc
+}
+
+func (cc *ColorCanonicalizer) Canonicalize(color string) (string, error) {
+	key := cc.fold(color)
+	if cc.palette != nil {
+		if _, ok := cc.palette[key]; !ok {
+			return "", fmt.Errorf("%w: %s", ErrUnknownColor, color)
+		}
+	}
+	return key, nil
+}
+
+func (cc *ColorCanonicalizer) fold(color string) string {
+	key := strings.ToLower(strings.TrimSpace(color))
+	if alias, ok := cc.aliases[key]; ok {
+		return alias
+	}
+	return key
+}
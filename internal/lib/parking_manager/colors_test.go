@@ -0,0 +1,36 @@
+package parkingmanager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestColorCanonicalizer(t *testing.T) {
+	tests := []struct {
+		palette []string
+		color   string
+		key     string
+		err     error
+	}{
+		{nil, "White", "white", nil},
+		{nil, "  WHITE ", "white", nil},
+		{nil, "Grey", "gray", nil},
+		{nil, "silver", "silver", nil},
+		{nil, "Navy", "navy", nil},
+		{[]string{"White", "Gray"}, "GREY", "gray", nil},
+		{[]string{"White", "grey"}, "gray", "gray", nil},
+		{[]string{"White", "Gray"}, "Silver", "", ErrUnknownColor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			key, err := NewColorCanonicalizer(tt.palette...).Canonicalize(tt.color)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+			if key != tt.key {
+				t.Errorf("expected %q, got %q", tt.key, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// recorded by the owner of the lots, which knows their names
+	EventLotCreated     EventType = "LotCreated"
+	EventLotRestored    EventType = "LotRestored"
+	EventLotSelected    EventType = "LotSelected"
+	EventSnapshotLoaded EventType = "SnapshotLoaded"
+	EventLotDropped     EventType = "LotDropped"
+
+	// recorded by a lot as its state changes
+	EventParked              EventType = "Parked"
+	EventLeft                EventType = "Left"
+	EventReserved            EventType = "Reserved"
+	EventReservationClaimed  EventType = "ReservationClaimed"
+	EventReservationReleased EventType = "ReservationReleased"
+	EventReservationExpired  EventType = "ReservationExpired"
+	EventReservationMoved    EventType = "ReservationMoved" // to the slot of the event, from the one of its reservation
+	EventWaitlisted          EventType = "Waitlisted"
+	EventWaitlistCancelled   EventType = "WaitlistCancelled"
+	EventSlotTagged          EventType = "SlotTagged"
+	EventUndone              EventType = "Undone"
+)
+
+var (
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
+type (
+	EventType string
+
+	/*
+		Event is a change of the state of a lot, the state of a lot is the result of its events applied in order.
+
+		A lot starts with a LotCreated or LotRestored event holding its state at that point, see DeriveParkingLot.
+		Only the fields of its type are set: the slot, the vehicle (as parked, waitlisted or leaving), the reservation,
+		the attributes a slot was tagged with, the event undone, or the state of the lot.
+		An event keeps what it takes to undo it too, e.g. the entry time of a vehicle leaving, see ParkingLot.Revert.
+	*/
+	Event struct {
+		Seq  uint64    `json:"seq"`
+		Type EventType `json:"type"`
+		At   time.Time `json:"at"`
+		Lot  string    `json:"lot,omitempty"`
+		Slot int       `json:"slot,omitempty"`
+		// Vehicle is not inlined like in a ParkedSnapshot, its type would clash with the type of the event.
+		Vehicle   *VehicleSnapshot `json:"vehicle,omitempty"`
+		TicketID  string           `json:"ticket_id,omitempty"`
+		EntryTime *time.Time       `json:"entry_time,omitempty"`
+		// Position is the position in the waitlist of a vehicle queued, cancelled, or parked from the waitlist.
+		Position           int                  `json:"position,omitempty"`
+		Reservation        *ReservationSnapshot `json:"reservation,omitempty"`
+		Attributes         string               `json:"attributes,omitempty"`
+		PreviousAttributes string               `json:"previous_attributes,omitempty"`
+		Undone             *Event               `json:"undone,omitempty"`
+		// StrategyPosition is where the allocation strategy got to with the slot of the event, see LotSnapshot.
+		StrategyPosition *int64 `json:"strategy_position,omitempty"`
+		// StrategyReset puts the allocation strategy back to the start of its sequence, when an undo goes back that far.
+		StrategyReset bool         `json:"strategy_reset,omitempty"`
+		State         *LotSnapshot `json:"state,omitempty"`
+		// Change is the change the event was recorded in, 0 for none, see ParkingLot.Tagged. It only means something to the running service.
+		Change uint64 `json:"-"`
+	}
+
+	// EventLog is the append-only history of the events of one or more lots.
+	EventLog struct {
+		mu     sync.RWMutex
+		events []Event
+		sink   func(event Event)
+		limit  int // how many of the latest events are kept, all when 0, see Bound
+	}
+)
+
+// Instantiates an event log holding the given events already, e.g. read back from a file.
+func NewEventLog(events ...Event) *EventLog {
+	return &EventLog{events: slices.Clone(events)}
+}
+
+// Records the events of the lot to the given log, under the given lot name.
+func WithEventLog(eventLog *EventLog, lotName string) Option {
+	return func(pl *ParkingLot) {
+		pl.eventLog, pl.name = eventLog, lotName
+	}
+}
+
+// Calls the sink with every event appended from now on, in order, e.g. to write the events to a file.
+func (el *EventLog) OnAppend(sink func(event Event)) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	el.sink = sink
+}
+
+/*
+Keeps only the latest limit events from now on, the older ones are dropped as the events are appended.
+
+The states of the lots are not kept either, a bounded log answers the history of the lots but cannot derive them,
+see DeriveParkingLot. The sink still gets the events whole.
+*/
+func (el *EventLog) Bound(limit int) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	el.limit = limit
+	for i := range el.events {
+		el.events[i].State = nil
+	}
+	el.trim()
+}
+
+// Appends the event with the next sequence number and returns it.
+func (el *EventLog) Append(event Event) Event {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	event.Seq = 1
+	if len(el.events) > 0 {
+		event.Seq = el.events[len(el.events)-1].Seq + 1
+	}
+	kept := event
+	if el.limit > 0 {
+		kept.State = nil
+	}
+	el.events = append(el.events, kept)
+	el.trim()
+	if el.sink != nil {
+		el.sink(event)
+	}
+	return event
+}
+
+// drops the events beyond the limit, a half of it at a time so appending stays O(1) on average. The caller holds the lock.
+func (el *EventLog) trim() {
+	if el.limit > 0 && len(el.events) >= el.limit+max(el.limit/2, 1) {
+		el.events = slices.Clone(el.events[len(el.events)-el.limit:])
+	}
+}
+
+// the events kept, the caller holds the lock
+func (el *EventLog) window() []Event {
+	if el.limit > 0 && len(el.events) > el.limit {
+		return el.events[len(el.events)-el.limit:]
+	}
+	return el.events
+}
+
+// the sequence number of the last event, 0 before the first one
+func (el *EventLog) LastSeq() uint64 {
+	el.mu.RLock()
+	defer el.mu.RUnlock()
+
+	if len(el.events) == 0 {
+		return 0
+	}
+	return el.events[len(el.events)-1].Seq
+}
+
+// the events appended after the given sequence number, in order
+func (el *EventLog) Since(seq uint64) []Event {
+	el.mu.RLock()
+	defer el.mu.RUnlock()
+
+	events := el.window()
+	i := sort.Search(len(events), func(i int) bool { return events[i].Seq > seq })
+	return slices.Clone(events[i:])
+}
+
+// the events the filter keeps, in order
+func (el *EventLog) Events(keep func(event Event) bool) []Event {
+	el.mu.RLock()
+	defer el.mu.RUnlock()
+
+	events := make([]Event, 0)
+	for _, event := range el.window() {
+		if keep(event) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// the registration number of the vehicle (or reservation) of the event, empty for none
+func (event Event) RegistrationNo() string {
+	switch {
+	case event.Undone != nil:
+		return event.Undone.RegistrationNo()
+	case event.Vehicle != nil:
+		return event.Vehicle.RegistrationNo
+	case event.Reservation != nil:
+		return event.Reservation.RegistrationNo
+	}
+	return ""
+}
+
+/*
+Derives a lot from its events: the first one is its LotCreated (or LotRestored) event, the others are applied in order.
+
+The options are applied like the ones of RestoreParkingLot, the derived lot records no events until it is returned.
+*/
+func DeriveParkingLot(events []Event, options ...Option) (*ParkingLot, error) {
+	if len(events) == 0 || events[0].State == nil {
+		return nil, fmt.Errorf("%w: a lot starts with its state", ErrInvalidEvent)
+	}
+	pl, err := RestoreParkingLot(events[0].State, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	eventLog := pl.eventLog
+	pl.eventLog = nil
+	for _, event := range events[1:] {
+		if err := pl.apply(event); err != nil {
+			return nil, fmt.Errorf("event %d: %w", event.Seq, err)
+		}
+	}
+	pl.eventLog = eventLog
+	return pl, nil
+}
+
+// applies a change recorded earlier, nobody else can see the lot yet
+func (pl *ParkingLot) apply(event Event) error {
+	seg, hasSlot := findSegment(pl.segments, event.Slot)
+	switch event.Type {
+	case EventParked:
+		if !hasSlot || event.Vehicle == nil {
+			return ErrInvalidEvent
+		}
+		vehicle, err := pl.restoreVehicle(*event.Vehicle)
+		if err != nil {
+			return err
+		}
+		if position := pl.waitlistPosition(vehicle.registrationNumber); position > 0 {
+			pl.waitlist = slices.Delete(pl.waitlist, position-1, position)
+		}
+		seg.pool(seg.attributesOf(event.Slot)).Take(event.Slot)
+		vehicle.entryTime, vehicle.ticketID = event.At, event.TicketID
+		pl.index(vehicle, event.Slot)
+		if err := pl.ticketIssuer.ResumeAfter(event.TicketID); err != nil {
+			return err
+		}
+	case EventLeft:
+		if _, err := pl.leave(event.Slot); err != nil {
+			return err
+		}
+	case EventReserved:
+		if !hasSlot || event.Reservation == nil {
+			return ErrInvalidEvent
+		}
+		if err := pl.bookReservation(*event.Reservation); err != nil {
+			return err
+		}
+	case EventReservationClaimed, EventReservationReleased, EventReservationExpired:
+		reservation, ok := pl.reservations[event.RegistrationNo()]
+		if !ok {
+			return fmt.Errorf("%w: no reservation for %s", ErrInvalidEvent, event.RegistrationNo())
+		}
+		// a claimed slot is taken again by the Parked event which follows
+		pl.releaseReservation(reservation)
+	case EventReservationMoved:
+		if !hasSlot {
+			return ErrInvalidEvent
+		}
+		reservation, ok := pl.reservations[event.RegistrationNo()]
+		if !ok {
+			return fmt.Errorf("%w: no reservation for %s", ErrInvalidEvent, event.RegistrationNo())
+		}
+		// held again the next time the lot syncs its reservations, like a booked one
+		pl.rebookReservation(reservation, event.Slot)
+	case EventWaitlisted:
+		if event.Vehicle == nil {
+			return ErrInvalidEvent
+		}
+		vehicle, err := pl.restoreVehicle(*event.Vehicle)
+		if err != nil {
+			return err
+		}
+		pl.waitlist = append(pl.waitlist, vehicle)
+	case EventWaitlistCancelled:
+		position := pl.waitlistPosition(event.RegistrationNo())
+		if position == 0 {
+			return fmt.Errorf("%w: %s", ErrVehicleNotWaitlisted, event.RegistrationNo())
+		}
+		pl.waitlist = slices.Delete(pl.waitlist, position-1, position)
+	case EventSlotTagged:
+		attributes, err := ParseSlotAttributes(event.Attributes)
+		if !hasSlot || err != nil {
+			return ErrInvalidEvent
+		}
+		pl.tagSlot(seg, event.Slot, attributes)
+	case EventUndone:
+		if event.Undone == nil {
+			return ErrInvalidEvent
+		}
+		if err := pl.revert(*event.Undone); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidEvent, event.Type)
+	}
+
+	if strategy, ok := pl.allocationStrategy.(builtinStrategy); ok {
+		switch {
+		case event.StrategyPosition != nil:
+			strategy.seek(*event.StrategyPosition)
+		case event.StrategyReset:
+			strategy.reset()
+		}
+	}
+	return nil
+}
+
+/*
+Books the slot for the reservation again, the caller holds the lock.
+
+The slot is not held yet whatever the time, the lot holds it the next time it syncs its reservations, see syncReservations.
+*/
+func (pl *ParkingLot) bookReservation(snapshot ReservationSnapshot) error {
+	reservation, err := restoreReservation(snapshot)
+	if err != nil {
+		return err
+	}
+	pl.addReservation(reservation)
+	return nil
+}
+
+// records the event of the lot, the caller holds the lock
+func (pl *ParkingLot) record(event Event) {
+	if pl.eventLog == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = pl.clock.Now()
+	}
+	event.Lot = pl.name
+	event.Change = pl.change
+	pl.eventLog.Append(event)
+}
+
+/*
+Returns a view of the lot tagging the events it records with the given change, it shares everything else with the lot.
+
+Whoever undoes a change picks its events by the tag, the events other views record meanwhile keep theirs.
+*/
+func (pl *ParkingLot) Tagged(change uint64) *ParkingLot {
+	view := *pl
+	view.change = change
+	return &view
+}
+
+// records the allocation of the slot, with where the strategy got to
+func (pl *ParkingLot) recordAllocation(event Event) {
+	event.StrategyPosition = pl.strategyPosition()
+	pl.record(event)
+}
+
+func (vehicle *Vehicle) event(eventType EventType, slot int) Event {
+	snapshot := vehicle.snapshot()
+	return Event{Type: eventType, Slot: slot, Vehicle: &snapshot, TicketID: vehicle.ticketID}
+}
+
+func (reservation *Reservation) event(eventType EventType) Event {
+	snapshot := reservation.snapshot()
+	return Event{Type: eventType, Slot: reservation.Slot, Reservation: &snapshot}
+}
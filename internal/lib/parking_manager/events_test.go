@@ -0,0 +1,206 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDerivedLotMatchesLiveLot(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	eventLog := NewEventLog()
+	strategy, _ := NewAllocationStrategy(AllocationRandom, 7)
+	live := NewParkingLotWithLayout(Layout{
+		{Level: 1, Size: SlotSizeMedium, Count: 3},
+		{Level: 2, Size: SlotSizeMedium, Count: 4},
+	}, WithClock(clock), WithWaitlist(), WithAllocationStrategy(strategy), WithEventLog(eventLog, "default"))
+	eventLog.Append(Event{Type: EventLotCreated, At: clock.now, Lot: "default", State: live.Snapshot()})
+
+	if _, err := live.Reserve("KA-01-HH-0007", VehicleTypeCar, clock.now.Add(time.Hour), clock.now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Reserve("KA-01-HH-0008", VehicleTypeCar, clock.now, clock.now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	slots := make([]int, 0)
+	for _, registrationNo := range []string{"KA-01-HH-0001", "KA-01-HH-0002", "KA-01-HH-0003", "KA-01-HH-0004"} {
+		slot, err := live.Park(NewVehicle(registrationNo, "White"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		slots = append(slots, slot)
+		clock.now = clock.now.Add(5 * time.Minute)
+	}
+	if err := live.TagSlot(slots[1], SlotAttributeEV); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Leave(slots[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reservation of 0008 expires, 0007 claims its own
+	clock.now = clock.now.Add(45 * time.Minute)
+	for _, registrationNo := range []string{"KA-01-HH-0007", "KA-01-HH-0005", "KA-01-HH-0006", "KA-01-HH-0009"} {
+		if _, err := live.Park(NewVehicle(registrationNo, "Red")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var waitlisted *WaitlistedError
+	for _, registrationNo := range []string{"KA-01-HH-0010", "KA-01-HH-0011"} {
+		if _, err := live.Park(NewVehicle(registrationNo, "Blue")); !errors.As(err, &waitlisted) {
+			t.Fatalf("expected %s to be waitlisted, got %v", registrationNo, err)
+		}
+	}
+	if err := live.CancelWaitlist("KA-01-HH-0010"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.Leave(slots[2]); err != nil {
+		t.Fatal(err)
+	}
+	if admitted := live.AdmitWaitlisted(); len(admitted) != 1 {
+		t.Fatalf("expected one vehicle to be admitted, got %v", admitted)
+	}
+	if _, err := live.Leave(slots[3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := live.ParkAt(NewVehicle("KA-01-HH-0012", "Gray"), slots[3]); err != nil {
+		t.Fatal(err)
+	}
+
+	events := eventLog.Events(func(event Event) bool { return true })
+	recorded := map[EventType]int{}
+	for _, event := range events {
+		recorded[event.Type]++
+	}
+	for _, eventType := range []EventType{EventParked, EventLeft, EventReserved, EventReservationClaimed, EventReservationExpired, EventWaitlisted, EventWaitlistCancelled, EventSlotTagged} {
+		if recorded[eventType] == 0 {
+			t.Errorf("expected a %s event, got %v", eventType, recorded)
+		}
+	}
+	derived, err := DeriveParkingLot(events, WithClock(clock), WithWaitlist())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := snapshotJSON(t, derived), snapshotJSON(t, live); got != want {
+		t.Fatalf("derived lot differs:\n%s\n%s", want, got)
+	}
+	if got := len(eventLog.Events(func(event Event) bool { return true })); got != len(events) {
+		t.Fatalf("expected the derivation to record no events, got %d more", got-len(events))
+	}
+
+	// both lots go on the same way, with the same tickets and random slots
+	for _, parkingLot := range []*ParkingLot{live, derived} {
+		for _, slot := range []int{slots[1], slots[3]} {
+			if _, err := parkingLot.Leave(slot); err != nil {
+				t.Fatal(err)
+			}
+		}
+		parkingLot.AdmitWaitlisted()
+	}
+	for _, registrationNo := range []string{"KA-01-HH-0013", "KA-01-HH-0014"} {
+		want, wantErr := live.Park(NewVehicle(registrationNo, "White"))
+		got, gotErr := derived.Park(NewVehicle(registrationNo, "White"))
+		if got != want || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Fatalf("derived lot diverged: got %d (%v), expected %d (%v)", got, gotErr, want, wantErr)
+		}
+	}
+	if got, want := snapshotJSON(t, derived), snapshotJSON(t, live); got != want {
+		t.Fatalf("lots diverged:\n%s\n%s", want, got)
+	}
+}
+
+func TestEventsOfALot(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	eventLog := NewEventLog()
+	parkingLot := NewParkingLot(2, WithClock(clock), WithEventLog(eventLog, "north"))
+
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-1234", "White")); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(time.Hour)
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := parkingLot.TagSlot(2, SlotAttributeEV); err != nil {
+		t.Fatal(err)
+	}
+
+	events := eventLog.Events(func(event Event) bool { return true })
+	want := []string{
+		"1 Parked north 1 KA-01-HH-1234 09:00",
+		"2 Left north 1 KA-01-HH-1234 10:00",
+		"3 SlotTagged north 2  10:00",
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), events)
+	}
+	for i, event := range events {
+		if got := fmt.Sprintf("%d %s %s %d %s %s", event.Seq, event.Type, event.Lot, event.Slot, event.RegistrationNo(), event.At.Format("15:04")); got != want[i] {
+			t.Errorf("expected %q, got %q", want[i], got)
+		}
+	}
+	if events[0].TicketID == "" || events[0].TicketID != events[1].TicketID {
+		t.Errorf("expected the ticket on both events, got %q and %q", events[0].TicketID, events[1].TicketID)
+	}
+
+	if _, err := DeriveParkingLot(events); !errors.Is(err, ErrInvalidEvent) {
+		t.Fatalf("expected %v without the state of the lot, got %v", ErrInvalidEvent, err)
+	}
+}
+
+func TestTaggedViewTagsItsEvents(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	eventLog := NewEventLog()
+	parkingLot := NewParkingLot(3, WithClock(clock), WithEventLog(eventLog, "north"))
+	tagged := parkingLot.Tagged(7).View(clock)
+
+	if _, err := tagged.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0002", "White")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tagged.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the view keeps its tag, the lot and its other views record untagged
+	events := eventLog.Events(func(event Event) bool { return true })
+	want := []uint64{7, 0, 7}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), events)
+	}
+	for i, event := range events {
+		if event.Change != want[i] {
+			t.Errorf("expected event %d tagged %d, got %d", event.Seq, want[i], event.Change)
+		}
+	}
+}
+
+func TestBoundEventLogKeepsTheLatestEvents(t *testing.T) {
+	parkingLot := NewParkingLot(2)
+	eventLog := NewEventLog(Event{Seq: 1, Type: EventLotCreated, Lot: "north", State: parkingLot.Snapshot()})
+	eventLog.Bound(3)
+	sunk := make([]Event, 0)
+	eventLog.OnAppend(func(event Event) { sunk = append(sunk, event) })
+
+	for range 10 {
+		eventLog.Append(Event{Type: EventLotRestored, Lot: "north", State: parkingLot.Snapshot()})
+	}
+	events := eventLog.Events(func(event Event) bool { return true })
+	if len(events) != 3 || events[0].Seq != 9 || eventLog.LastSeq() != 11 {
+		t.Fatalf("expected the events 9 to 11, got %v", events)
+	}
+	if since := eventLog.Since(1); len(since) != 3 {
+		t.Fatalf("expected the 3 events kept, got %v", since)
+	}
+	for _, event := range events {
+		if event.State != nil {
+			t.Fatalf("expected no state to be kept, got %v", event)
+		}
+	}
+	if len(sunk) != 10 || sunk[9].State == nil {
+		t.Fatalf("expected the sink to get the events whole, got %v", sunk)
+	}
+}
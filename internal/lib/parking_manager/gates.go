@@ -0,0 +1,210 @@
+package parkingmanager
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+)
+
+// a queue grown over this many entries more than twice its free slots is rebuilt
+const gateQueueSlack = 64
+
+var (
+	ErrUnknownGate = errors.New("unknown gate")
+	ErrInvalidGate = errors.New("invalid gate")
+)
+
+type (
+	// Gate is an entry of the lot, Distances[i] is how far slot i+1 is from it.
+	Gate struct {
+		Name      string
+		Distances []int
+	}
+
+	/*
+		gate allocates the free slot nearest to an entry, it is the allocation strategy of the vehicles parked from it.
+
+		Every pool of free slots has a queue of its slots by distance to the gate.
+		Slots are pushed when they are released into the pool and only checked once they reach the front,
+		a slot which is no longer free there (parked, reserved or retagged) is dropped then.
+	*/
+	gate struct {
+		distances []int
+		lot       *ParkingLot
+		queues    map[*slotAllocator]*gateQueue
+	}
+
+	gateEntry struct {
+		distance int
+		slot     int
+	}
+
+	// gateHeap is a min-heap of slots by distance then slot number, see container/heap.
+	gateHeap []gateEntry
+
+	gateQueue struct {
+		seg        *segment
+		attributes SlotAttributes
+		entries    gateHeap
+	}
+)
+
+func (h gateHeap) Len() int           { return len(h) }
+func (h gateHeap) Less(i, j int) bool { return h[i].nearerThan(h[j]) }
+func (h gateHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *gateHeap) Push(x any)        { *h = append(*h, x.(gateEntry)) }
+func (h *gateHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+	return entry
+}
+
+// checks the gates fit a lot of the given capacity, gate names are unique and distances not negative
+func ValidateGates(gates []Gate, capacity int) error {
+	names := map[string]bool{}
+	for _, g := range gates {
+		if g.Name == "" || names[g.Name] {
+			return fmt.Errorf("%w: missing or repeated name %q", ErrInvalidGate, g.Name)
+		}
+		names[g.Name] = true
+		if len(g.Distances) != capacity {
+			return fmt.Errorf("%w: %s has %d distances for %d slots", ErrInvalidGate, g.Name, len(g.Distances), capacity)
+		}
+		for i, distance := range g.Distances {
+			if distance < 0 {
+				return fmt.Errorf("%w: %s, slot %d at distance %d", ErrInvalidGate, g.Name, i+1, distance)
+			}
+		}
+	}
+	return nil
+}
+
+// Adds the entry gates vehicles can be parked from, see ParkFromGate. The gates are expected to be validated by the caller.
+func WithGates(gates ...Gate) Option {
+	return func(pl *ParkingLot) {
+		if pl.gates == nil {
+			pl.gates = map[string]*gate{}
+		}
+		for _, g := range gates {
+			pl.gates[g.Name] = newGate(pl, g)
+		}
+	}
+}
+
+// the names of the gates of the lot, in no particular order
+func (pl *ParkingLot) GetGateNames() []string {
+	names := make([]string, 0, len(pl.gates))
+	for name := range pl.gates {
+		names = append(names, name)
+	}
+	return names
+}
+
+/*
+Parks the vehicle at the free slot nearest to the gate, among the slots Park would consider.
+
+The vehicle keeps the gate while waitlisted, a reserved slot is still claimed wherever it is.
+*/
+func (pl *ParkingLot) ParkFromGate(vehicle *Vehicle, gateName string) (int, error) {
+	if _, ok := pl.gates[gateName]; !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownGate, gateName)
+	}
+	vehicle.gate = gateName
+	return pl.Park(vehicle)
+}
+
+// queues the free slots of the lot as they are when the gate is added
+func newGate(pl *ParkingLot, g Gate) *gate {
+	gt := &gate{distances: g.Distances, lot: pl, queues: map[*slotAllocator]*gateQueue{}}
+	for _, seg := range pl.segments {
+		for attributes, pool := range seg.pools {
+			gt.rebuild(gt.queue(seg, attributes, pool), pool)
+		}
+	}
+	return gt
+}
+
+func (gt *gate) Choose(candidates []Candidate) (int, int) {
+	chosen, chosenEntry := -1, gateEntry{}
+	for i, candidate := range candidates {
+		entry, ok := gt.nearest(candidate.pool)
+		if !ok {
+			continue
+		}
+		if chosen < 0 || entry.nearerThan(chosenEntry) {
+			chosen, chosenEntry = i, entry
+		}
+	}
+	return chosen, chosenEntry.slot
+}
+
+// by distance, then by slot number
+func (entry gateEntry) nearerThan(other gateEntry) bool {
+	if entry.distance != other.distance {
+		return entry.distance < other.distance
+	}
+	return entry.slot < other.slot
+}
+
+// the front of the queue of the pool, once the entries of slots no longer free there are dropped
+func (gt *gate) nearest(pool *slotAllocator) (gateEntry, bool) {
+	queue, ok := gt.queues[pool]
+	if !ok {
+		return gateEntry{}, false
+	}
+	for queue.entries.Len() > 0 {
+		entry := queue.entries[0]
+		if gt.lot.isFreeIn(queue.seg, queue.attributes, entry.slot) {
+			return entry, true
+		}
+		heap.Pop(&queue.entries)
+	}
+	return gateEntry{}, false
+}
+
+// queues a slot released into the pool
+func (gt *gate) push(seg *segment, attributes SlotAttributes, pool *slotAllocator, slot int) {
+	queue := gt.queue(seg, attributes, pool)
+	heap.Push(&queue.entries, gateEntry{distance: gt.distances[slot-1], slot: slot})
+
+	// the stale entries behind the front are only dropped by a rebuild
+	if queue.entries.Len() > 2*pool.Len()+gateQueueSlack {
+		gt.rebuild(queue, pool)
+	}
+}
+
+func (gt *gate) queue(seg *segment, attributes SlotAttributes, pool *slotAllocator) *gateQueue {
+	queue, ok := gt.queues[pool]
+	if !ok {
+		queue = &gateQueue{seg: seg, attributes: attributes}
+		gt.queues[pool] = queue
+	}
+	return queue
+}
+
+func (gt *gate) rebuild(queue *gateQueue, pool *slotAllocator) {
+	slots := pool.Slots()
+	queue.entries = make(gateHeap, 0, len(slots))
+	for _, slot := range slots {
+		queue.entries = append(queue.entries, gateEntry{distance: gt.distances[slot-1], slot: slot})
+	}
+	heap.Init(&queue.entries)
+}
+
+// gives a free slot back to the pool of its attributes and to the queues of the gates
+func (pl *ParkingLot) releaseTo(seg *segment, slot int) {
+	attributes := seg.attributesOf(slot)
+	pool := seg.pool(attributes)
+	pool.Release(slot)
+	pl.slotsFreed = true
+	for _, gt := range pl.gates {
+		gt.push(seg, attributes, pool, slot)
+	}
+}
+
+// whether the slot is free in the pool of the attributes
+func (pl *ParkingLot) isFreeIn(seg *segment, attributes SlotAttributes, slot int) bool {
+	return pl.isFree(slot) && seg.attributesOf(slot) == attributes
+}
@@ -0,0 +1,92 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestParkFromGateMatchesScan(t *testing.T) {
+	const capacity = 200
+
+	rnd := rand.New(rand.NewSource(1))
+	gates := []Gate{{Name: "G1"}, {Name: "G2"}}
+	for i := range gates {
+		for range capacity {
+			gates[i].Distances = append(gates[i].Distances, rnd.Intn(50))
+		}
+	}
+	if err := ValidateGates(gates, capacity); err != nil {
+		t.Fatal(err)
+	}
+	parkingLot := NewParkingLot(capacity, WithGates(gates...))
+
+	// the nearest free slot to the gate, by a scan over all of them
+	scan := func(gate Gate) int {
+		nearest := 0
+		for _, slot := range parkingLot.GetAvailableSlots() {
+			if nearest == 0 || gate.Distances[slot-1] < gate.Distances[nearest-1] {
+				nearest = slot
+			}
+		}
+		return nearest
+	}
+
+	for i := range 5000 {
+		occupied := parkingLot.GetOccupiedSlots()
+		if len(occupied) > 0 && rnd.Intn(3) == 0 {
+			for slot := range occupied {
+				if _, err := parkingLot.Leave(slot); err != nil {
+					t.Fatal(err)
+				}
+				break
+			}
+			continue
+		}
+
+		gate := gates[rnd.Intn(len(gates))]
+		want := scan(gate)
+		slot, err := parkingLot.ParkFromGate(NewVehicle(fmt.Sprintf("KA-01-HH-%04d", i), "White"), gate.Name)
+		if want == 0 {
+			if !errors.Is(err, ErrParkingLotFull) {
+				t.Fatalf("step %d: expected a full lot, got %d (%v)", i, slot, err)
+			}
+			continue
+		}
+		if err != nil || slot != want {
+			t.Fatalf("step %d: expected slot %d from %s, got %d (%v)", i, want, gate.Name, slot, err)
+		}
+	}
+
+	// the queues are rebuilt before the released slots pile up
+	for _, gt := range parkingLot.gates {
+		for pool, queue := range gt.queues {
+			if queue.entries.Len() > 2*pool.Len()+gateQueueSlack+1 {
+				t.Errorf("expected at most %d queued slots, got %d", 2*pool.Len()+gateQueueSlack+1, queue.entries.Len())
+			}
+		}
+	}
+}
+
+func TestParkFromGateFollowsRetaggedSlots(t *testing.T) {
+	gate := Gate{Name: "G1", Distances: []int{4, 3, 2, 1}}
+	parkingLot := NewParkingLot(4, WithGates(gate))
+
+	if err := parkingLot.TagSlot(4, SlotAttributeEV); err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := parkingLot.ParkFromGate(NewVehicle("KA-01-HH-0001", "White"), "G1"); err != nil || slot != 3 {
+		t.Fatalf("expected slot 3, the EV slot is kept, got %d (%v)", slot, err)
+	}
+	if slot, err := parkingLot.ParkFromGate(NewVehicleNeeding("KA-01-HH-0002", "White", VehicleTypeCar, SlotAttributeEV), "G1"); err != nil || slot != 4 {
+		t.Fatalf("expected the EV slot 4, got %d (%v)", slot, err)
+	}
+
+	if _, err := parkingLot.ParkFromGate(NewVehicle("KA-01-HH-0003", "White"), "G9"); !errors.Is(err, ErrUnknownGate) {
+		t.Fatalf("expected ErrUnknownGate, got %v", err)
+	}
+	if err := ValidateGates([]Gate{gate}, 5); !errors.Is(err, ErrInvalidGate) {
+		t.Fatalf("expected ErrInvalidGate, got %v", err)
+	}
+}
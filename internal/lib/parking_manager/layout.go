@@ -0,0 +1,198 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	SlotSizeSmall SlotSize = iota
+	SlotSizeMedium
+	SlotSizeLarge
+	SlotSizeXLarge
+)
+
+const (
+	VehicleTypeMotorcycle VehicleType = iota
+	VehicleTypeCar
+	VehicleTypeVan
+	VehicleTypeBus
+)
+
+var (
+	ErrUnknownSlotSize    = errors.New("unknown slot size")
+	ErrUnknownVehicleType = errors.New("unknown vehicle type")
+	ErrInvalidLayout      = errors.New("invalid layout")
+
+	slotSizeNames    = []string{"small", "medium", "large", "xlarge"}
+	vehicleTypeNames = []string{"motorcycle", "car", "van", "bus"}
+)
+
+type (
+	// SlotSize is the size class of a slot, a slot fits any vehicle of its size class or smaller.
+	SlotSize int
+
+	// VehicleType is the category of a vehicle, each one needs a slot of at least its own size class.
+	VehicleType int
+
+	// SlotGroup declares count consecutive slots of the same size, on a level of a multi-level lot.
+	SlotGroup struct {
+		Level      int // 0 for a flat lot
+		Size       SlotSize
+		Count      int
+		Attributes SlotAttributes // none for ordinary slots
+	}
+
+	/*
+		Layout lists the slot groups of a lot.
+
+		Slots are numbered from 1, level by level (lowest level first) and in the order of the groups within a level.
+	*/
+	Layout []SlotGroup
+
+	/*
+		segment is a slot group placed in the lot.
+
+		Its free slots are kept in one allocator per set of attributes,
+		the slots start out in the pool of the attributes of the group and move when they are retagged.
+	*/
+	segment struct {
+		first      int
+		last       int
+		level      int
+		zone       int // the level of a multi-level lot, the position of the group (from 1) in a flat one
+		size       SlotSize
+		attributes SlotAttributes
+		pools      map[SlotAttributes]*slotAllocator
+		retagged   map[int]SlotAttributes // slots whose attributes differ from the group's
+	}
+)
+
+func ParseSlotSize(name string) (SlotSize, error) {
+	for size, sizeName := range slotSizeNames {
+		if strings.EqualFold(name, sizeName) {
+			return SlotSize(size), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownSlotSize, name)
+}
+
+func (size SlotSize) String() string {
+	if size < 0 || int(size) >= len(slotSizeNames) {
+		return fmt.Sprintf("size(%d)", int(size))
+	}
+	return slotSizeNames[size]
+}
+
+func ParseVehicleType(name string) (VehicleType, error) {
+	for vehicleType, typeName := range vehicleTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return VehicleType(vehicleType), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownVehicleType, name)
+}
+
+func (vehicleType VehicleType) String() string {
+	if vehicleType < 0 || int(vehicleType) >= len(vehicleTypeNames) {
+		return fmt.Sprintf("type(%d)", int(vehicleType))
+	}
+	return vehicleTypeNames[vehicleType]
+}
+
+// the smallest slot size the vehicle type fits in
+func (vehicleType VehicleType) SlotSize() SlotSize {
+	return SlotSize(vehicleType)
+}
+
+// a flat lot of capacity car sized slots
+func UniformLayout(capacity int) Layout {
+	return Layout{{Size: SlotSizeMedium, Count: capacity}}
+}
+
+func (layout Layout) Capacity() int {
+	capacity := 0
+	for _, group := range layout {
+		capacity += group.Count
+	}
+	return capacity
+}
+
+func (layout Layout) Validate() error {
+	if len(layout) == 0 {
+		return fmt.Errorf("%w: no slots", ErrInvalidLayout)
+	}
+	leveled := layout.IsMultiLevel()
+	for _, group := range layout {
+		if leveled && group.Level <= 0 || !leveled && group.Level != 0 {
+			return fmt.Errorf("%w: either every slot group is on a level (from 1) or none is", ErrInvalidLayout)
+		}
+		if group.Count <= 0 {
+			return fmt.Errorf("%w: %d %s slots", ErrInvalidLayout, group.Count, group.Size)
+		}
+		if group.Size < SlotSizeSmall || group.Size > SlotSizeXLarge {
+			return fmt.Errorf("%w: %s", ErrUnknownSlotSize, group.Size)
+		}
+	}
+	return nil
+}
+
+func (layout Layout) IsMultiLevel() bool {
+	return len(layout) > 0 && layout[0].Level != 0
+}
+
+// places the groups one after another, starting from slot 1
+func (layout Layout) segments() []*segment {
+	groups := append(Layout(nil), layout...)
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Level < groups[j].Level })
+
+	segments := make([]*segment, 0, len(groups))
+	first := 1
+	for i, group := range groups {
+		last := first + group.Count - 1
+		zone := group.Level
+		if zone == 0 {
+			zone = i + 1
+		}
+		segments = append(segments, &segment{
+			first:      first,
+			last:       last,
+			level:      group.Level,
+			zone:       zone,
+			size:       group.Size,
+			attributes: group.Attributes,
+			pools:      map[SlotAttributes]*slotAllocator{group.Attributes: newSlotAllocator(first, last)},
+		})
+		first = last + 1
+	}
+	return segments
+}
+
+// the number of slots of every zone
+func zoneCapacities(segments []*segment) map[int]int {
+	capacities := map[int]int{}
+	for _, seg := range segments {
+		capacities[seg.zone] += seg.last - seg.first + 1
+	}
+	return capacities
+}
+
+// the number of free slots of the segment, whatever their attributes
+func (seg *segment) freeCount() int {
+	count := 0
+	for _, free := range seg.pools {
+		count += free.Len()
+	}
+	return count
+}
+
+// finds the segment holding the slot, segments are ordered by their first slot
+func findSegment(segments []*segment, slot int) (*segment, bool) {
+	i := sort.Search(len(segments), func(i int) bool { return segments[i].last >= slot })
+	if i == len(segments) || slot < segments[i].first {
+		return nil, false
+	}
+	return segments[i], true
+}
@@ -0,0 +1,164 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	LevelOrderLowestFirst LevelOrder = iota
+	LevelOrderHighestFirst
+)
+
+const minSlotLabelIndexSize = 3
+
+var (
+	ErrInvalidSlot       = errors.New("invalid slot")
+	ErrUnknownLevelOrder = errors.New("unknown level order")
+
+	levelOrderNames = []string{"lowest", "highest"}
+)
+
+type (
+	// LevelOrder tells which level of a multi-level lot is filled first.
+	LevelOrder int
+
+	// levelRange is the contiguous range of slots of a level.
+	levelRange struct {
+		level int
+		first int
+		last  int
+	}
+
+	// LevelOccupancy is the per level breakdown of a multi-level lot.
+	LevelOccupancy struct {
+		Level    int
+		Capacity int
+		Occupied int
+	}
+)
+
+func ParseLevelOrder(name string) (LevelOrder, error) {
+	for order, orderName := range levelOrderNames {
+		if strings.EqualFold(name, orderName) {
+			return LevelOrder(order), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownLevelOrder, name)
+}
+
+func (order LevelOrder) String() string {
+	if order < 0 || int(order) >= len(levelOrderNames) {
+		return fmt.Sprintf("order(%d)", int(order))
+	}
+	return levelOrderNames[order]
+}
+
+// Fills the levels of a multi-level lot in the given order, nearest slot first within a level.
+func WithLevelOrder(order LevelOrder) Option {
+	return func(pl *ParkingLot) {
+		pl.levelOrder = order
+	}
+}
+
+// the level ranges of the segments, empty for a flat lot
+func levelRanges(segments []*segment) []levelRange {
+	levels := make([]levelRange, 0)
+	for _, seg := range segments {
+		if seg.level == 0 {
+			continue
+		}
+		if n := len(levels); n > 0 && levels[n-1].level == seg.level {
+			levels[n-1].last = seg.last
+			continue
+		}
+		levels = append(levels, levelRange{level: seg.level, first: seg.first, last: seg.last})
+	}
+	return levels
+}
+
+func (pl *ParkingLot) IsMultiLevel() bool {
+	return len(pl.levels) > 0
+}
+
+/*
+Returns the identifier of a slot as shown to the operators.
+
+That's the slot number for a flat lot and L<level>-<index within the level> for a multi-level one, e.g. L2-045.
+*/
+func (pl *ParkingLot) SlotLabel(slot int) string {
+	level, ok := pl.findLevel(slot)
+	if !ok {
+		return strconv.Itoa(slot)
+	}
+	return fmt.Sprintf("L%d-%0*d", level.level, pl.slotLabelIndexSize, slot-level.first+1)
+}
+
+// Resolves a slot identifier given by an operator, either a slot number or a label like L2-045.
+func (pl *ParkingLot) ParseSlot(id string) (int, error) {
+	if slot, err := strconv.Atoi(id); err == nil {
+		if slot < 1 || slot > pl.capacity {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidSlot, id)
+		}
+		return slot, nil
+	}
+
+	levelPart, indexPart, ok := strings.Cut(strings.ToUpper(id), "-")
+	if !ok || !strings.HasPrefix(levelPart, "L") {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSlot, id)
+	}
+	levelNo, err := strconv.Atoi(levelPart[1:])
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSlot, id)
+	}
+	index, err := strconv.Atoi(indexPart)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSlot, id)
+	}
+	for _, level := range pl.levels {
+		if level.level == levelNo && index >= 1 && index <= level.last-level.first+1 {
+			return level.first + index - 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrInvalidSlot, id)
+}
+
+// the capacity and occupancy of every level, lowest level first
+func (pl *ParkingLot) GetLevelOccupancy() []LevelOccupancy {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	occupancy := make([]LevelOccupancy, 0, len(pl.levels))
+	for _, level := range pl.levels {
+		capacity, free := level.last-level.first+1, 0
+		for _, seg := range pl.segments {
+			if seg.level == level.level {
+				free += seg.freeCount()
+			}
+		}
+		occupancy = append(occupancy, LevelOccupancy{Level: level.level, Capacity: capacity, Occupied: capacity - free})
+	}
+	return occupancy
+}
+
+func (pl *ParkingLot) findLevel(slot int) (levelRange, bool) {
+	for _, level := range pl.levels {
+		if slot >= level.first && slot <= level.last {
+			return level, true
+		}
+	}
+	return levelRange{}, false
+}
+
+// wide enough for the biggest level, at least 3 digits as in L2-045
+func slotLabelIndexSize(levels []levelRange) int {
+	size := minSlotLabelIndexSize
+	for _, level := range levels {
+		if digits := len(strconv.Itoa(level.last - level.first + 1)); digits > size {
+			size = digits
+		}
+	}
+	return size
+}
@@ -1,39 +1,157 @@
 package parkingmanager
 
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrParkingLotFull       = errors.New("parking lot is full")
+	ErrSlotNotOccupied      = errors.New("slot is not occupied")
+	ErrVehicleAlreadyParked = errors.New("vehicle is already parked")
+	ErrNoSlotForVehicleType = errors.New("no free slot fits the vehicle type")
+	ErrVehicleNotParked     = errors.New("vehicle is not parked")
+	ErrSlotOccupied         = errors.New("slot is occupied")
+	ErrSlotReserved         = errors.New("slot is reserved")
+	ErrSlotTooSmall         = errors.New("slot is too small for the vehicle")
+)
+
 type (
+	// VehicleAlreadyParkedError is returned when parking a registration number which holds a slot already.
+	VehicleAlreadyParkedError struct {
+		RegistrationNo string
+		Slot           int
+	}
+
+	// ParkingLot is a handle on the state of a lot, its views share that state, see View.
 	ParkingLot struct {
-		capacity          int
-		availableSlots    []int
-		occupiedSlots     map[int]*Vehicle
-		vehicleToSlotMap  map[string]int
-		colorToVehicleMap map[string][]Vehicle
+		*lotState
+		clock  Clock  // each view tells its own time
+		change uint64 // the events the view records are tagged with, see Tagged
+	}
+
+	lotState struct {
+		mu                    sync.RWMutex
+		capacity              int
+		segments              []*segment
+		levels                []levelRange
+		levelOrder            LevelOrder
+		slotLabelIndexSize    int
+		occupiedSlots         map[int]*Vehicle
+		vehicleToSlotMap      map[string]int
+		ticketToSlotMap       map[string]int
+		colorToVehicleMap     map[string][]Vehicle
+		registrationValidator RegistrationValidator
+		strictRegistration    bool
+		colorCanonicalizer    *ColorCanonicalizer
+		ticketIssuer          *TicketIssuer
+		reservations          map[string]*Reservation // by registration number
+		slotReservations      map[int][]*Reservation  // by slot, ordered by the start of the window
+		reservedSlots         map[int]*Reservation    // the slots held for their reservation now, see Reservation
+		reservationExpiry     reservationHeap
+		reservationGrace      time.Duration
+		reservationLead       time.Duration
+		waitlistEnabled       bool
+		waitlist              []*Vehicle  // head of the queue first
+		slotsFreed            bool        // a slot went back to a pool since the waitlist was served, see serveWaitlist
+		admitted              []Admission // served from the waitlist, not returned by AdmitWaitlisted yet
+		specialSlotPolicy     SpecialSlotPolicy
+		allocationStrategy    AllocationStrategy
+		zoneCapacity          map[int]int
+		gates                 map[string]*gate
+		eventLog              *EventLog
+		name                  string // the lot is known by in its events, see WithEventLog
 	}
 
+	// Option customises a parking lot at creation.
+	Option func(pl *ParkingLot)
+
 	Vehicle struct {
 		registrationNumber string
-		color              string
+		color              string // as spelled on park, shown by status
+		colorKey           string // canonical colour the vehicle is indexed by
+		vehicleType        VehicleType
+		entryTime          time.Time
+		ticketID           string // issued on park
+		needs              SlotAttributes
+		gate               string // the vehicle is parked from, see ParkFromGate
 	}
 )
 
-func NewParkingLot(capacity int) *ParkingLot {
-	availableSlots := make([]int, capacity)
-	for i := range capacity {
-		availableSlots[i] = i + 1
+// a lot of capacity car sized slots
+func NewParkingLot(capacity int, options ...Option) *ParkingLot {
+	return NewParkingLotWithLayout(UniformLayout(capacity), options...)
+}
+
+// a lot with the slot sizes of the layout, the layout is expected to be validated by the caller
+func NewParkingLotWithLayout(layout Layout, options ...Option) *ParkingLot {
+	segments := layout.segments()
+	levels := levelRanges(segments)
+	pl := &ParkingLot{lotState: &lotState{
+		capacity:           layout.Capacity(),
+		segments:           segments,
+		levels:             levels,
+		slotLabelIndexSize: slotLabelIndexSize(levels),
+		occupiedSlots:      map[int]*Vehicle{},
+		vehicleToSlotMap:   map[string]int{},
+		ticketToSlotMap:    map[string]int{},
+		colorToVehicleMap:  map[string][]Vehicle{},
+		colorCanonicalizer: NewColorCanonicalizer(),
+		ticketIssuer:       NewTicketIssuer(),
+		reservations:       map[string]*Reservation{},
+		slotReservations:   map[int][]*Reservation{},
+		reservedSlots:      map[int]*Reservation{},
+		reservationGrace:   DefaultReservationGrace,
+		reservationLead:    DefaultReservationLead,
+		allocationStrategy: nearestStrategy{},
+		zoneCapacity:       zoneCapacities(segments),
+	}, clock: SystemClock{}}
+	for _, option := range options {
+		option(pl)
 	}
+	return pl
+}
+
+/*
+Normalizes every registration number parked or looked up with the given validator.
 
-	return &ParkingLot{
-		capacity:          capacity,
-		availableSlots:    availableSlots,
-		occupiedSlots:     map[int]*Vehicle{},
-		vehicleToSlotMap:  map[string]int{},
-		colorToVehicleMap: map[string][]Vehicle{},
+In strict mode a registration number the validator rejects cannot be parked.
+*/
+func WithRegistrationValidator(validator RegistrationValidator, strict bool) Option {
+	return func(pl *ParkingLot) {
+		pl.registrationValidator = validator
+		pl.strictRegistration = strict
 	}
 }
 
+// Indexes vehicles by the colours of the given canonicalizer, the default one only folds case and resolves aliases.
+func WithColorCanonicalizer(colorCanonicalizer *ColorCanonicalizer) Option {
+	return func(pl *ParkingLot) {
+		pl.colorCanonicalizer = colorCanonicalizer
+	}
+}
+
+func (err *VehicleAlreadyParkedError) Error() string {
+	return fmt.Sprintf("vehicle %s is already parked at slot %d", err.RegistrationNo, err.Slot)
+}
+func (err *VehicleAlreadyParkedError) Unwrap() error {
+	return ErrVehicleAlreadyParked
+}
+
+// a car
 func NewVehicle(registrationNo string, color string) *Vehicle {
+	return NewVehicleOfType(registrationNo, color, VehicleTypeCar)
+}
+
+func NewVehicleOfType(registrationNo string, color string, vehicleType VehicleType) *Vehicle {
 	return &Vehicle{
 		registrationNumber: registrationNo,
 		color:              color,
+		vehicleType:        vehicleType,
 	}
 }
 
@@ -43,62 +161,433 @@ func (vehicle *Vehicle) GetRegistrationNo() string {
 func (vehicle *Vehicle) GetColor() string {
 	return vehicle.color
 }
-
-func (pl *ParkingLot) GetAvailableSlots() []int {
-	return pl.availableSlots
+func (vehicle *Vehicle) GetType() VehicleType {
+	return vehicle.vehicleType
 }
-func (pl *ParkingLot) GetOccupiedSlots() map[int]*Vehicle {
-	return pl.occupiedSlots
+func (vehicle *Vehicle) GetEntryTime() time.Time {
+	return vehicle.entryTime
 }
-func (pl *ParkingLot) GetVehicleToSlotMapping() map[string]int {
-	return pl.vehicleToSlotMap
+
+// how long the vehicle has been parked at the given time
+func (vehicle *Vehicle) GetParkedDuration(now time.Time) time.Duration {
+	return now.Sub(vehicle.entryTime)
 }
-func (pl *ParkingLot) GetColorToVehicleMapping() map[string][]Vehicle {
-	return pl.colorToVehicleMap
+
+/*
+Parks the vehicle at the nearest available slot of the smallest size it fits in and returns that slot.
+A vehicle with a reservation gets its reserved slot.
+
+Allocating the slot and updating all the indexes happens atomically,
+so it is safe to park (and leave) from many goroutines at once.
+*/
+func (pl *ParkingLot) Park(vehicle *Vehicle) (int, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	if err := pl.admit(vehicle); err != nil {
+		return 0, err
+	}
+	slot, claimed := pl.claimReservation(vehicle)
+	if !claimed {
+		var err error
+		if slot, err = pl.allocate(vehicle.vehicleType, vehicle.needs, vehicle.gate); err != nil {
+			if err == ErrParkingLotFull && pl.waitlistEnabled {
+				pl.waitlist = append(pl.waitlist, vehicle)
+				event := vehicle.event(EventWaitlisted, 0)
+				event.Position = len(pl.waitlist)
+				pl.record(event)
+				return 0, &WaitlistedError{RegistrationNo: vehicle.registrationNumber, Position: len(pl.waitlist)}
+			}
+			return 0, err
+		}
+	}
+
+	pl.place(vehicle, slot)
+	return slot, nil
 }
 
-func (pl *ParkingLot) UpdateAvailableSlots(latestAvailableSlots []int) {
-	pl.availableSlots = latestAvailableSlots
+/*
+Parks the vehicle at the given free slot, as chosen by an operator.
+
+The slot has to fit the vehicle type and have the attributes the vehicle needs, a tagged slot may be chosen for any vehicle.
+A slot reserved for another vehicle cannot be taken, a vehicle with a reservation elsewhere gives that slot up.
+Nothing changes when the slot cannot be taken.
+*/
+func (pl *ParkingLot) ParkAt(vehicle *Vehicle, slot int) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	seg, ok := findSegment(pl.segments, slot)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrInvalidSlot, slot)
+	}
+	if err := pl.admit(vehicle); err != nil {
+		return err
+	}
+	if _, occupied := pl.occupiedSlots[slot]; occupied {
+		return fmt.Errorf("%w: %d", ErrSlotOccupied, slot)
+	}
+	if reservation, reserved := pl.reservedSlots[slot]; reserved && reservation.RegistrationNo != vehicle.registrationNumber {
+		return fmt.Errorf("%w: %d", ErrSlotReserved, slot)
+	}
+	if vehicle.vehicleType.SlotSize() > seg.size {
+		return fmt.Errorf("%w: %d is %s", ErrSlotTooSmall, slot, seg.size)
+	}
+	attributes := seg.attributesOf(slot)
+	if !attributes.Has(vehicle.needs) {
+		return fmt.Errorf("%w: %s", ErrNoSlotWithAttributes, vehicle.needs)
+	}
+
+	if reservation, ok := pl.reservations[vehicle.registrationNumber]; ok {
+		if reservation.Slot == slot {
+			if !pl.dropReservation(reservation) {
+				seg.pool(attributes).Take(slot)
+			}
+			pl.record(reservation.event(EventReservationClaimed))
+			pl.place(vehicle, slot)
+			return nil
+		}
+		pl.releaseReservation(reservation)
+		pl.record(reservation.event(EventReservationReleased))
+	}
+	seg.pool(attributes).Take(slot)
+	pl.place(vehicle, slot)
+	return nil
 }
-func (pl *ParkingLot) UpdateOccupiedSlot(slot int, vehicle *Vehicle) {
-	pl.occupiedSlots[slot] = vehicle
+
+/*
+Frees the given slot and returns the vehicle which was parked there.
+
+Releasing the slot and updating all the indexes happens atomically.
+*/
+func (pl *ParkingLot) Leave(slot int) (*Vehicle, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	return pl.leave(slot)
 }
-func (pl *ParkingLot) UpdateSlotByRegistrationNo(registrationNo string, slot int) {
-	pl.vehicleToSlotMap[registrationNo] = slot
+
+// frees the slot of the vehicle with the registration number, atomically like Leave
+func (pl *ParkingLot) LeaveByRegistrationNo(registrationNo string) (*Vehicle, int, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	registrationNo = pl.normalizeRegistrationNo(registrationNo)
+	slot, ok := pl.vehicleToSlotMap[registrationNo]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrVehicleNotParked, registrationNo)
+	}
+	vehicle, err := pl.leave(slot)
+	return vehicle, slot, err
 }
-func (pl *ParkingLot) UpdateVehiclesByColor(color string, vehicle *Vehicle) {
-	pl.colorToVehicleMap[color] = append(pl.colorToVehicleMap[color], *vehicle)
+
+func (pl *ParkingLot) GetCapacity() int {
+	return pl.capacity
 }
 
-func (pl *ParkingLot) RemoveSlotFromOccupiedSlots(slot int) {
-	delete(pl.GetOccupiedSlots(), slot)
+// returns a copy in ascending order, so the caller can iterate over it while other goroutines park/leave
+func (pl *ParkingLot) GetAvailableSlots() []int {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	slots := make([]int, 0)
+	for _, seg := range pl.segments {
+		for _, free := range seg.pools {
+			slots = append(slots, free.Slots()...)
+		}
+	}
+	sort.Ints(slots)
+	return slots
 }
-func (pl *ParkingLot) RemoveRegistrationNoFromOccupiedSlots(registrationNo string) {
-	delete(pl.vehicleToSlotMap, registrationNo)
+
+func (pl *ParkingLot) GetAvailableSlotCount() int {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	return pl.availableSlotCount()
 }
-func (pl *ParkingLot) RemoveVehicleFromColorToVehicleMapping(vehicle *Vehicle) {
-	for color, vehicles := range pl.colorToVehicleMap {
-		for i, v := range vehicles {
-			if v.registrationNumber == vehicle.GetRegistrationNo() {
-				pl.colorToVehicleMap[color] = append(vehicles[:i], vehicles[i+1:]...)
-				break
-			}
-		}
+
+func (pl *ParkingLot) GetSlotSize(slot int) (SlotSize, bool) {
+	seg, ok := findSegment(pl.segments, slot)
+	if !ok {
+		return 0, false
+	}
+	return seg.size, true
+}
+
+// returns a copy, so the caller can iterate over it while other goroutines park/leave
+func (pl *ParkingLot) GetOccupiedSlots() map[int]Vehicle {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	occupiedSlots := make(map[int]Vehicle, len(pl.occupiedSlots))
+	for slot, vehicle := range pl.occupiedSlots {
+		occupiedSlots[slot] = *vehicle
 	}
+	return occupiedSlots
 }
 
 func (pl *ParkingLot) GetVehiclesByColor(color string) ([]Vehicle, bool) {
-	vehicles, ok := pl.colorToVehicleMap[color]
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	colorKey, err := pl.colorCanonicalizer.Canonicalize(color)
+	if err != nil {
+		return nil, false
+	}
+	vehicles, ok := pl.colorToVehicleMap[colorKey]
 	if !ok {
 		return nil, false
 	}
-	return vehicles, true
+	return append([]Vehicle(nil), vehicles...), true
 }
 
 func (pl *ParkingLot) GetSlotByRegistrationNo(registrationNo string) (int, bool) {
-	slot, ok := pl.vehicleToSlotMap[registrationNo]
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	slot, ok := pl.vehicleToSlotMap[pl.normalizeRegistrationNo(registrationNo)]
 	if !ok {
 		return -1, false
 	}
 	return slot, true
 }
+
+// returns a copy of the parked vehicle along with its slot
+func (pl *ParkingLot) GetVehicleByRegistrationNo(registrationNo string) (Vehicle, int, bool) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	slot, ok := pl.vehicleToSlotMap[pl.normalizeRegistrationNo(registrationNo)]
+	if !ok {
+		return Vehicle{}, -1, false
+	}
+	return *pl.occupiedSlots[slot], slot, true
+}
+
+/*
+Picks the nearest free slot among the smallest slot size the vehicle type fits in,
+moving up a size only when every smaller compatible slot is taken.
+In a multi-level lot the levels are filled in the level order.
+
+A vehicle with needs gets a slot having them, the one with the fewest other attributes first.
+A vehicle without needs gets an untagged slot, a tagged one only as a last resort if the special slot policy allows it.
+*/
+func (pl *ParkingLot) allocate(vehicleType VehicleType, needs SlotAttributes, gateName string) (int, error) {
+	strategy := pl.allocationStrategy
+	if gt, ok := pl.gates[gateName]; ok {
+		strategy = gt
+	}
+
+	if needs != 0 {
+		if slot, ok := pl.allocateFrom(vehicleType, needs, strategy, func(attributes SlotAttributes) bool { return attributes.Has(needs) }); ok {
+			return slot, nil
+		}
+	} else {
+		if slot, ok := pl.allocateFrom(vehicleType, 0, strategy, func(attributes SlotAttributes) bool { return attributes == 0 }); ok {
+			return slot, nil
+		}
+		if pl.specialSlotPolicy == SpecialSlotsLastResort {
+			if slot, ok := pl.allocateFrom(vehicleType, 0, strategy, func(SlotAttributes) bool { return true }); ok {
+				return slot, nil
+			}
+		}
+	}
+
+	if pl.availableSlotCount() == 0 {
+		return 0, ErrParkingLotFull
+	}
+	if needs != 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNoSlotWithAttributes, needs)
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNoSlotForVehicleType, vehicleType)
+}
+
+/*
+Allocates a free slot among the pools with accepted attributes, see allocate.
+
+The candidates are the pools of the smallest slot size with a free slot,
+narrowed down to the pools with the fewest attributes the vehicle does not need, the strategy chooses among them.
+*/
+func (pl *ParkingLot) allocateFrom(vehicleType VehicleType, needs SlotAttributes, strategy AllocationStrategy, accept func(attributes SlotAttributes) bool) (int, bool) {
+	for size := vehicleType.SlotSize(); size <= SlotSizeXLarge; size++ {
+		candidates, bestFit := make([]Candidate, 0), 0
+		for _, seg := range pl.segments {
+			if seg.size != size {
+				continue
+			}
+			for attributes, free := range seg.pools {
+				if !accept(attributes) || free.Len() == 0 {
+					continue
+				}
+				fit := extraAttributes(attributes, needs)
+				if len(candidates) > 0 && fit > bestFit {
+					continue
+				}
+				if len(candidates) > 0 && fit < bestFit {
+					candidates = candidates[:0]
+				}
+				candidates, bestFit = append(candidates, pl.candidate(seg, free)), fit
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		chosen, slot := strategy.Choose(candidates)
+		candidates[chosen].pool.Take(slot)
+		return slot, true
+	}
+	return 0, false
+}
+
+func (pl *ParkingLot) candidate(seg *segment, pool *slotAllocator) Candidate {
+	rank := seg.level
+	if pl.levelOrder == LevelOrderHighestFirst {
+		rank = -seg.level
+	}
+	zoneFree := 0
+	for _, other := range pl.segments {
+		if other.zone == seg.zone {
+			zoneFree += other.freeCount()
+		}
+	}
+	return Candidate{
+		Level:        seg.level,
+		LevelRank:    rank,
+		Zone:         seg.zone,
+		ZoneFree:     zoneFree,
+		ZoneCapacity: pl.zoneCapacity[seg.zone],
+		pool:         pool,
+	}
+}
+
+func (pl *ParkingLot) availableSlotCount() int {
+	count := 0
+	for _, seg := range pl.segments {
+		count += seg.freeCount()
+	}
+	return count
+}
+
+// puts the vehicle at the allocated slot, issues its ticket and indexes it, the caller holds the lock
+func (pl *ParkingLot) place(vehicle *Vehicle, slot int) {
+	pl.recordAllocation(pl.stamp(vehicle, slot))
+}
+
+// stamps, tickets and indexes the vehicle put at the slot, returns its Parked event for the caller to record
+func (pl *ParkingLot) stamp(vehicle *Vehicle, slot int) Event {
+	vehicle.entryTime = pl.clock.Now()
+	vehicle.ticketID = pl.ticketIssuer.Issue(vehicle.entryTime)
+	pl.index(vehicle, slot)
+
+	event := vehicle.event(EventParked, slot)
+	event.At = vehicle.entryTime
+	return event
+}
+
+/*
+Adds the vehicle, stamped and ticketed already, to every index.
+
+The colour index is kept in the order of the tickets, which is the order of parking,
+so a vehicle put back by an undo gets its place back too.
+*/
+func (pl *ParkingLot) index(vehicle *Vehicle, slot int) {
+	pl.occupiedSlots[slot] = vehicle
+	pl.vehicleToSlotMap[vehicle.registrationNumber] = slot
+	pl.ticketToSlotMap[vehicle.ticketID] = slot
+	vehicles := pl.colorToVehicleMap[vehicle.colorKey]
+	i := sort.Search(len(vehicles), func(i int) bool { return vehicles[i].ticketID > vehicle.ticketID })
+	pl.colorToVehicleMap[vehicle.colorKey] = slices.Insert(vehicles, i, *vehicle)
+}
+
+/*
+Checks the vehicle can be parked and canonicalizes it, the caller holds the lock.
+
+The vehicle is left as it was when it is refused. The reservations are brought up to now on the way,
+see syncReservations, the waitlisted vehicles get their slots first, then the vehicle finds the rest free.
+*/
+func (pl *ParkingLot) admit(vehicle *Vehicle) error {
+	registrationNo, err := pl.checkRegistrationNo(vehicle.registrationNumber)
+	if err != nil {
+		return err
+	}
+
+	// a registration number can hold one slot only, otherwise its first slot is orphaned
+	if slot, exists := pl.vehicleToSlotMap[registrationNo]; exists {
+		return &VehicleAlreadyParkedError{RegistrationNo: registrationNo, Slot: slot}
+	}
+	if position := pl.waitlistPosition(registrationNo); position > 0 {
+		return &WaitlistedError{RegistrationNo: registrationNo, Position: position}
+	}
+
+	colorKey, err := pl.colorCanonicalizer.Canonicalize(vehicle.color)
+	if err != nil {
+		return err
+	}
+	vehicle.registrationNumber, vehicle.colorKey = registrationNo, colorKey
+
+	if pl.reservationExpiry.Len() > 0 {
+		pl.syncReservations(pl.clock.Now())
+		pl.serveWaitlist()
+	}
+	return nil
+}
+
+// frees the slot and drops the vehicle from every index, the caller holds the lock
+func (pl *ParkingLot) leave(slot int) (*Vehicle, error) {
+	vehicle, exists := pl.occupiedSlots[slot]
+	if !exists {
+		return nil, ErrSlotNotOccupied
+	}
+
+	delete(pl.occupiedSlots, slot)
+	delete(pl.vehicleToSlotMap, vehicle.registrationNumber)
+	delete(pl.ticketToSlotMap, vehicle.ticketID)
+	pl.removeVehicleFromColorToVehicleMapping(vehicle)
+	pl.releaseSlot(slot)
+
+	event, entryTime := vehicle.event(EventLeft, slot), vehicle.entryTime
+	event.EntryTime = &entryTime
+	pl.record(event)
+	return vehicle, nil
+}
+
+// gives the slot back to the allocator of its segment
+func (pl *ParkingLot) releaseSlot(slot int) {
+	if seg, ok := findSegment(pl.segments, slot); ok {
+		pl.releaseTo(seg, slot)
+	}
+}
+
+// normalizes the registration number, in strict mode it has to be valid too
+func (pl *ParkingLot) checkRegistrationNo(registrationNo string) (string, error) {
+	registrationNo = pl.normalizeRegistrationNo(registrationNo)
+	if pl.strictRegistration && pl.registrationValidator != nil {
+		if err := pl.registrationValidator.Validate(registrationNo); err != nil {
+			return registrationNo, err
+		}
+	}
+	return registrationNo, nil
+}
+
+func (pl *ParkingLot) normalizeRegistrationNo(registrationNo string) string {
+	if pl.registrationValidator == nil {
+		return registrationNo
+	}
+	return pl.registrationValidator.Normalize(registrationNo)
+}
+
+func (pl *ParkingLot) removeVehicleFromColorToVehicleMapping(vehicle *Vehicle) {
+	vehicles := pl.colorToVehicleMap[vehicle.colorKey]
+	for i, v := range vehicles {
+		if v.registrationNumber == vehicle.registrationNumber {
+			pl.colorToVehicleMap[vehicle.colorKey] = append(vehicles[:i], vehicles[i+1:]...)
+			break
+		}
+	}
+}
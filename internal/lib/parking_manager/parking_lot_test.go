@@ -0,0 +1,282 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run with -race: many gates park and leave at once, no slot may ever be handed out twice.
+func TestParkingLotConcurrentParkAndLeave(t *testing.T) {
+	const (
+		capacity   = 50
+		gates      = 32
+		iterations = 500
+	)
+
+	parkingLot := NewParkingLot(capacity)
+
+	var (
+		wg     sync.WaitGroup
+		owners sync.Map // slot -> registration number of the vehicle holding it
+	)
+	for gate := range gates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range iterations {
+				vehicle := NewVehicle(fmt.Sprintf("KA-%02d-HH-%04d", gate, i), "White")
+				slot, err := parkingLot.Park(vehicle)
+				if err == ErrParkingLotFull {
+					continue
+				}
+				if err != nil {
+					t.Errorf("unexpected error on park: %v", err)
+					return
+				}
+				if slot < 1 || slot > capacity {
+					t.Errorf("slot %d out of range", slot)
+					return
+				}
+				if owner, loaded := owners.LoadOrStore(slot, vehicle.GetRegistrationNo()); loaded {
+					t.Errorf("slot %d allocated to %s while still held by %s", slot, vehicle.GetRegistrationNo(), owner)
+					return
+				}
+
+				if got, ok := parkingLot.GetSlotByRegistrationNo(vehicle.GetRegistrationNo()); !ok || got != slot {
+					t.Errorf("registration index out of sync for %s: got %d, want %d", vehicle.GetRegistrationNo(), got, slot)
+				}
+
+				owners.Delete(slot)
+				left, err := parkingLot.Leave(slot)
+				if err != nil {
+					t.Errorf("unexpected error on leave: %v", err)
+					return
+				}
+				if left.GetRegistrationNo() != vehicle.GetRegistrationNo() {
+					t.Errorf("slot %d released %s, want %s", slot, left.GetRegistrationNo(), vehicle.GetRegistrationNo())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if occupied := parkingLot.GetOccupiedSlots(); len(occupied) != 0 {
+		t.Errorf("expected an empty lot, %d slots still occupied", len(occupied))
+	}
+
+	availableSlots := parkingLot.GetAvailableSlots()
+	if len(availableSlots) != capacity {
+		t.Fatalf("expected %d available slots, got %d", capacity, len(availableSlots))
+	}
+	for i, slot := range availableSlots {
+		if slot != i+1 {
+			t.Fatalf("available slots out of order: %v", availableSlots)
+		}
+	}
+}
+
+func TestParkingLotLeaveUnoccupiedSlot(t *testing.T) {
+	parkingLot := NewParkingLot(2)
+	if _, err := parkingLot.Leave(1); err != ErrSlotNotOccupied {
+		t.Errorf("expected %v, got %v", ErrSlotNotOccupied, err)
+	}
+}
+
+func TestParkingLotRejectsVehicleAlreadyParked(t *testing.T) {
+	parkingLot := NewParkingLot(3)
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-1234", "White")); err != nil {
+		t.Fatalf("unexpected error on park: %v", err)
+	}
+
+	_, err := parkingLot.Park(NewVehicle("KA-01-HH-1234", "Red"))
+	var alreadyParked *VehicleAlreadyParkedError
+	if !errors.As(err, &alreadyParked) || !errors.Is(err, ErrVehicleAlreadyParked) {
+		t.Fatalf("expected %v, got %v", ErrVehicleAlreadyParked, err)
+	}
+	if alreadyParked.Slot != 1 {
+		t.Errorf("expected the vehicle to be reported at slot 1, got %d", alreadyParked.Slot)
+	}
+
+	if available := parkingLot.GetAvailableSlotCount(); available != 2 {
+		t.Errorf("rejected park must not hold a slot, %d slots available", available)
+	}
+	if vehicles, _ := parkingLot.GetVehiclesByColor("Red"); len(vehicles) != 0 {
+		t.Errorf("rejected park must not be indexed by color, got %v", vehicles)
+	}
+}
+
+func TestParkingLotAllocatesSmallestCompatibleSlot(t *testing.T) {
+	parkingLot := NewParkingLotWithLayout(Layout{
+		{Size: SlotSizeLarge, Count: 1},
+		{Size: SlotSizeSmall, Count: 1},
+		{Size: SlotSizeMedium, Count: 2},
+	})
+
+	steps := []struct {
+		vehicleType VehicleType
+		slot        int
+		err         error
+	}{
+		{VehicleTypeCar, 3, nil},
+		{VehicleTypeMotorcycle, 2, nil},
+		{VehicleTypeMotorcycle, 4, nil},
+		{VehicleTypeBus, 0, ErrNoSlotForVehicleType},
+		{VehicleTypeCar, 1, nil},
+		{VehicleTypeVan, 0, ErrParkingLotFull},
+	}
+	for i, step := range steps {
+		slot, err := parkingLot.Park(NewVehicleOfType(fmt.Sprintf("KA-01-HH-%04d", i), "White", step.vehicleType))
+		if !errors.Is(err, step.err) || slot != step.slot {
+			t.Fatalf("step %d: parking a %s, expected slot %d (%v), got %d (%v)", i, step.vehicleType, step.slot, step.err, slot, err)
+		}
+	}
+
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := parkingLot.Park(NewVehicleOfType("KA-01-HH-9999", "White", VehicleTypeVan)); err != nil || slot != 1 {
+		t.Errorf("expected the van at slot 1, got %d (%v)", slot, err)
+	}
+}
+
+func TestParkingLotSlotLabels(t *testing.T) {
+	parkingLot := NewParkingLotWithLayout(Layout{
+		{Level: 2, Size: SlotSizeMedium, Count: 1200},
+		{Level: 1, Size: SlotSizeMedium, Count: 10},
+	})
+
+	for _, tt := range []struct {
+		slot  int
+		label string
+	}{{1, "L1-0001"}, {10, "L1-0010"}, {11, "L2-0001"}, {1210, "L2-1200"}} {
+		if label := parkingLot.SlotLabel(tt.slot); label != tt.label {
+			t.Errorf("expected slot %d to be labelled %s, got %s", tt.slot, tt.label, label)
+		}
+		if slot, err := parkingLot.ParseSlot(tt.label); err != nil || slot != tt.slot {
+			t.Errorf("expected %s to be slot %d, got %d (%v)", tt.label, tt.slot, slot, err)
+		}
+	}
+
+	for _, id := range []string{"0", "1211", "L3-001", "L1-011", "L1-x", "X1-001"} {
+		if _, err := parkingLot.ParseSlot(id); !errors.Is(err, ErrInvalidSlot) {
+			t.Errorf("expected %s to be invalid, got %v", id, err)
+		}
+	}
+}
+
+func TestParkingLotLeaveByRegistrationNo(t *testing.T) {
+	parkingLot := NewParkingLot(3, WithRegistrationValidator(IndianRegistrationFormat{}, false))
+	for _, registrationNo := range []string{"KA-01-HH-1234", "KA-01-HH-9999"} {
+		if _, err := parkingLot.Park(NewVehicle(registrationNo, "White")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vehicle, slot, err := parkingLot.LeaveByRegistrationNo("ka01hh1234")
+	if err != nil || slot != 1 || vehicle.GetRegistrationNo() != "KA-01-HH-1234" {
+		t.Fatalf("expected KA-01-HH-1234 to leave slot 1, got %d (%v)", slot, err)
+	}
+	if _, _, err := parkingLot.LeaveByRegistrationNo("KA-01-HH-1234"); !errors.Is(err, ErrVehicleNotParked) {
+		t.Errorf("expected %v, got %v", ErrVehicleNotParked, err)
+	}
+
+	if vehicles, _ := parkingLot.GetVehiclesByColor("White"); len(vehicles) != 1 || vehicles[0].GetRegistrationNo() != "KA-01-HH-9999" {
+		t.Errorf("expected only KA-01-HH-9999 to be indexed by color, got %v", vehicles)
+	}
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-4444", "Red")); err != nil || slot != 1 {
+		t.Errorf("expected the freed slot 1 to be reused, got %d (%v)", slot, err)
+	}
+}
+
+func TestParkingLotParkAt(t *testing.T) {
+	layout := Layout{{Size: SlotSizeSmall, Count: 1}, {Size: SlotSizeMedium, Count: 4}}
+	parkingLot := NewParkingLotWithLayout(layout)
+
+	if err := parkingLot.ParkAt(NewVehicle("KA-01-HH-0001", "White"), 4); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		vehicle *Vehicle
+		slot    int
+		err     error
+	}{
+		{NewVehicle("KA-01-HH-0002", "White"), 0, ErrInvalidSlot},
+		{NewVehicle("KA-01-HH-0002", "White"), 6, ErrInvalidSlot},
+		{NewVehicle("KA-01-HH-0002", "White"), 4, ErrSlotOccupied},
+		{NewVehicle("KA-01-HH-0002", "White"), 1, ErrSlotTooSmall},
+		{NewVehicleNeeding("KA-01-HH-0002", "White", VehicleTypeCar, SlotAttributeEV), 2, ErrNoSlotWithAttributes},
+		{NewVehicle("KA-01-HH-0001", "White"), 2, ErrVehicleAlreadyParked},
+	} {
+		if err := parkingLot.ParkAt(tt.vehicle, tt.slot); !errors.Is(err, tt.err) {
+			t.Errorf("parking %s at %d: expected %v, got %v", tt.vehicle.GetRegistrationNo(), tt.slot, tt.err, err)
+		}
+	}
+
+	// the slots around the claimed one are still allocated in order
+	if slots := parkingLot.GetAvailableSlots(); fmt.Sprint(slots) != "[1 2 3 5]" {
+		t.Fatalf("expected free slots [1 2 3 5], got %v", slots)
+	}
+	for _, want := range []int{2, 3, 5} {
+		if slot, err := parkingLot.Park(NewVehicle(fmt.Sprintf("KA-01-HH-%04d", want+10), "White")); err != nil || slot != want {
+			t.Fatalf("expected slot %d, got %d (%v)", want, slot, err)
+		}
+	}
+	if _, err := parkingLot.Leave(4); err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-0020", "White")); err != nil || slot != 4 {
+		t.Fatalf("expected the freed slot 4 back, got %d (%v)", slot, err)
+	}
+}
+
+func TestParkingLotParkAtReservedSlot(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(3, WithClock(clock))
+	slot, err := parkingLot.Reserve("KA-01-HH-0001", VehicleTypeCar, clock.now, clock.now.Add(time.Hour))
+	if err != nil || slot != 1 {
+		t.Fatalf("expected slot 1 reserved, got %d (%v)", slot, err)
+	}
+
+	if err := parkingLot.ParkAt(NewVehicle("KA-01-HH-0002", "White"), 1); !errors.Is(err, ErrSlotReserved) {
+		t.Fatalf("expected %v, got %v", ErrSlotReserved, err)
+	}
+
+	// the vehicle with the reservation parks elsewhere, its reserved slot is given up
+	if err := parkingLot.ParkAt(NewVehicle("KA-01-HH-0001", "White"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if reservations := parkingLot.GetReservations(); len(reservations) != 0 {
+		t.Fatalf("expected no reservations, got %v", reservations)
+	}
+	if slots := parkingLot.GetAvailableSlots(); fmt.Sprint(slots) != "[1 2]" {
+		t.Fatalf("expected free slots [1 2], got %v", slots)
+	}
+}
+
+func TestParkingLotViewTellsItsOwnTime(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(3, WithClock(clock))
+	view := parkingLot.View(&manualClock{now: clock.now.Add(-time.Hour)})
+	if !view.SameLot(parkingLot) || parkingLot.SameLot(NewParkingLot(3)) {
+		t.Fatal("expected the view to be the same lot, and only it")
+	}
+
+	if _, err := view.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0002", "White")); err != nil {
+		t.Fatal(err)
+	}
+
+	// both park into the one lot, each at its own time
+	for registrationNo, want := range map[string]time.Time{"KA-01-HH-0001": clock.now.Add(-time.Hour), "KA-01-HH-0002": clock.now} {
+		vehicle, _, ok := parkingLot.GetVehicleByRegistrationNo(registrationNo)
+		if !ok || !vehicle.GetEntryTime().Equal(want) {
+			t.Fatalf("expected %s entered at %v, got %v", registrationNo, want, vehicle.GetEntryTime())
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	RegistrationFormatIndian  = "in"
+	RegistrationFormatGeneric = "generic"
+)
+
+var (
+	ErrInvalidRegistrationNo     = errors.New("invalid registration number")
+	ErrUnknownRegistrationFormat = errors.New("unknown registration format")
+
+	indianRegistrationPattern  = regexp.MustCompile(`^([A-Z]{2})([0-9]{1,2})([A-Z]{0,3})([0-9]{1,4})$`)
+	genericRegistrationPattern = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+
+	registrationFormats = map[string]RegistrationValidator{
+		RegistrationFormatIndian:  IndianRegistrationFormat{},
+		RegistrationFormatGeneric: GenericRegistrationFormat{},
+	}
+)
+
+type (
+	/*
+		RegistrationValidator knows the shape of the registration numbers of a country.
+
+		Normalize must accept anything and return the spelling used to index the vehicle,
+		so that "ka 01 hh 1234" and "KA-01-HH-1234" are the same vehicle.
+		Validate tells whether a normalized registration number is well formed.
+	*/
+	RegistrationValidator interface {
+		Normalize(registrationNo string) string
+		Validate(registrationNo string) error
+	}
+
+	/*
+		Indian registration numbers, normalized to KA-01-HH-1234.
+
+		Without a series the district runs into the number, KA1234 could be KA-01-0234 or KA-12-0034.
+		Such a number is only compacted then, unless a separator or its length tells where the district ends.
+	*/
+	IndianRegistrationFormat struct{}
+
+	// Any letters and digits, normalized to upper case without spaces or dashes.
+	GenericRegistrationFormat struct{}
+)
+
+func LookupRegistrationFormat(name string) (RegistrationValidator, error) {
+	validator, ok := registrationFormats[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRegistrationFormat, name)
+	}
+	return validator, nil
+}
+
+func (IndianRegistrationFormat) Normalize(registrationNo string) string {
+	compact := compactRegistrationNo(registrationNo)
+	parts := indianRegistrationPattern.FindStringSubmatch(compact)
+	if parts == nil {
+		// keep the dashes of something we don't understand, only fold the case
+		return strings.ToUpper(strings.Join(strings.Fields(registrationNo), ""))
+	}
+
+	if parts[3] == "" {
+		digits := parts[2] + parts[4]
+		districtDigits, ok := splitDistrict(registrationNo, digits)
+		if !ok {
+			return compact
+		}
+		parts[2], parts[4] = digits[:districtDigits], digits[districtDigits:]
+	}
+
+	district, _ := strconv.Atoi(parts[2])
+	number, _ := strconv.Atoi(parts[4])
+	if parts[3] == "" {
+		return fmt.Sprintf("%s-%02d-%04d", parts[1], district, number)
+	}
+	return fmt.Sprintf("%s-%02d-%s-%04d", parts[1], district, parts[3], number)
+}
+
+func (IndianRegistrationFormat) Validate(registrationNo string) error {
+	if !indianRegistrationPattern.MatchString(compactRegistrationNo(registrationNo)) {
+		return fmt.Errorf("%w: %s", ErrInvalidRegistrationNo, registrationNo)
+	}
+	return nil
+}
+
+func (GenericRegistrationFormat) Normalize(registrationNo string) string {
+	return compactRegistrationNo(registrationNo)
+}
+func (GenericRegistrationFormat) Validate(registrationNo string) error {
+	if !genericRegistrationPattern.MatchString(compactRegistrationNo(registrationNo)) {
+		return fmt.Errorf("%w: %s", ErrInvalidRegistrationNo, registrationNo)
+	}
+	return nil
+}
+
+/*
+Tells how many of the digits of a registration number without a series belong to the district.
+
+The last separator within the digits marks the end of the district, otherwise only the length does:
+two digits or six are split one way only.
+*/
+func splitDistrict(registrationNo, digits string) (int, bool) {
+	fields := strings.FieldsFunc(registrationNo, isRegistrationSeparator)
+	if last := fields[len(fields)-1]; len(last) < len(digits) {
+		districtDigits := len(digits) - len(last)
+		return districtDigits, districtDigits <= 2 && len(last) <= 4
+	}
+
+	splits, districtDigits := 0, 0
+	for district := 1; district <= 2; district++ {
+		if number := len(digits) - district; number >= 1 && number <= 4 {
+			splits, districtDigits = splits+1, district
+		}
+	}
+	return districtDigits, splits == 1
+}
+
+// upper case, without any spaces or dashes
+func compactRegistrationNo(registrationNo string) string {
+	return strings.Map(func(r rune) rune {
+		if isRegistrationSeparator(r) {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(registrationNo))
+}
+
+func isRegistrationSeparator(r rune) bool {
+	return r == '-' || r == ' ' || r == '\t'
+}
@@ -0,0 +1,76 @@
+package parkingmanager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistrationFormats(t *testing.T) {
+	tests := []struct {
+		format         string
+		registrationNo string
+		normalized     string
+		valid          bool
+	}{
+		{RegistrationFormatIndian, "KA-01-HH-1234", "KA-01-HH-1234", true},
+		{RegistrationFormatIndian, "ka 01 hh 1234", "KA-01-HH-1234", true},
+		{RegistrationFormatIndian, "KA1HH12", "KA-01-HH-0012", true},
+		{RegistrationFormatIndian, "DL-3C-1234", "DL-03-C-1234", true},
+		{RegistrationFormatIndian, "MH-12-1234", "MH-12-1234", true},
+		{RegistrationFormatIndian, "MH121234", "MH-12-1234", true},
+		{RegistrationFormatIndian, "ka 1 234", "KA-01-0234", true},
+		{RegistrationFormatIndian, "KA12 034", "KA-12-0034", true},
+		// the district could be 1 or 12, KA1234 and KA12034 must not become the same vehicle
+		{RegistrationFormatIndian, "ka1234", "KA1234", true},
+		{RegistrationFormatIndian, "KA12034", "KA12034", true},
+		{RegistrationFormatIndian, "invalid_11", "INVALID_11", false},
+		{RegistrationFormatIndian, "K-01-HH-1234", "K-01-HH-1234", false},
+		{RegistrationFormatGeneric, "ab-123 cd", "AB123CD", true},
+		{RegistrationFormatGeneric, "AB*123", "AB*123", false},
+		{RegistrationFormatGeneric, "ABCDEFGHIJK", "ABCDEFGHIJK", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.registrationNo, func(t *testing.T) {
+			validator, err := LookupRegistrationFormat(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			normalized := validator.Normalize(tt.registrationNo)
+			if normalized != tt.normalized {
+				t.Errorf("expected %s, got %s", tt.normalized, normalized)
+			}
+			if err := validator.Validate(normalized); (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v, got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestLookupUnknownRegistrationFormat(t *testing.T) {
+	if _, err := LookupRegistrationFormat("mars"); !errors.Is(err, ErrUnknownRegistrationFormat) {
+		t.Errorf("expected %v, got %v", ErrUnknownRegistrationFormat, err)
+	}
+}
+
+func TestParkingLotLeavesRefusedVehicleAsGiven(t *testing.T) {
+	validator, err := LookupRegistrationFormat(RegistrationFormatIndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parkingLot := NewParkingLot(2, WithRegistrationValidator(validator, true))
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-1234", "White")); err != nil {
+		t.Fatalf("unexpected error on park: %v", err)
+	}
+
+	for registrationNo, want := range map[string]error{"ka 01 hh 1234": ErrVehicleAlreadyParked, "invalid_11": ErrInvalidRegistrationNo} {
+		vehicle := NewVehicle(registrationNo, "Red")
+		if _, err := parkingLot.Park(vehicle); !errors.Is(err, want) {
+			t.Fatalf("expected %v, got %v", want, err)
+		}
+		if vehicle.GetRegistrationNo() != registrationNo {
+			t.Errorf("expected the refused vehicle to keep %s, got %s", registrationNo, vehicle.GetRegistrationNo())
+		}
+	}
+}
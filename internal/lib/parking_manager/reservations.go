@@ -0,0 +1,392 @@
+package parkingmanager
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultReservationGrace = 15 * time.Minute
+	DefaultReservationLead  = 15 * time.Minute
+)
+
+var (
+	ErrInvalidReservation     = errors.New("invalid reservation")
+	ErrVehicleAlreadyReserved = errors.New("vehicle already has a reservation")
+	ErrNoSlotForWindow        = errors.New("no slot is free of reservations during the window")
+)
+
+type (
+	/*
+		Reservation books a slot for a vehicle expected in the window From..To.
+
+		A slot takes any number of reservations whose windows, lead time included, do not overlap.
+		It is given to other vehicles as usual until HoldsFrom, the lead time before the window starts,
+		from then on it is held: taken out of the normal allocation once it is free.
+		A slot still occupied then is swapped for another free slot fitting the vehicle, if there is one, see syncReservations.
+		It is claimed by parking the vehicle, a no-show gives the slot back once ExpiresAt has passed,
+		that is the grace period after the start of the window (or the end of the window, whichever comes first).
+	*/
+	Reservation struct {
+		RegistrationNo string
+		VehicleType    VehicleType
+		Slot           int
+		From           time.Time
+		To             time.Time
+		HoldsFrom      time.Time
+		ExpiresAt      time.Time
+		Held           bool // the slot is held for the vehicle now
+	}
+
+	// reservationHeap is a min-heap of reservations by expiry, see container/heap.
+	reservationHeap []*Reservation
+)
+
+func (h reservationHeap) Len() int           { return len(h) }
+func (h reservationHeap) Less(i, j int) bool { return h[i].ExpiresAt.Before(h[j].ExpiresAt) }
+func (h reservationHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *reservationHeap) Push(x any)        { *h = append(*h, x.(*Reservation)) }
+func (h *reservationHeap) Pop() any {
+	old := *h
+	n := len(old)
+	reservation := old[n-1]
+	*h = old[:n-1]
+	return reservation
+}
+
+// Holds a reserved slot the lead time before its window starts, DefaultReservationLead by default.
+func WithReservationLead(lead time.Duration) Option {
+	return func(pl *ParkingLot) {
+		pl.reservationLead = lead
+	}
+}
+
+// Gives a no-show's slot back the grace period after the start of its window, DefaultReservationGrace by default.
+func WithReservationGrace(grace time.Duration) Option {
+	return func(pl *ParkingLot) {
+		pl.reservationGrace = grace
+	}
+}
+
+/*
+Reserves a slot for the vehicle during the window from..to and returns that slot.
+
+A window held from now on takes a free slot picked like Park would pick it, a later one the nearest slot fitting the vehicle,
+whoever is parked there meanwhile. Either way the slot has no other reservation overlapping the window.
+The slot is held until the vehicle parks or the reservation expires, see Reservation.
+*/
+func (pl *ParkingLot) Reserve(registrationNo string, vehicleType VehicleType, from, to time.Time) (int, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	if !to.After(from) {
+		return 0, fmt.Errorf("%w: the window ends before it starts", ErrInvalidReservation)
+	}
+	now := pl.clock.Now()
+	pl.syncReservations(now)
+	// the waitlisted vehicles were there first
+	pl.serveWaitlist()
+	if !to.After(now) {
+		return 0, fmt.Errorf("%w: the window is over", ErrInvalidReservation)
+	}
+
+	registrationNo, err := pl.checkRegistrationNo(registrationNo)
+	if err != nil {
+		return 0, err
+	}
+	if slot, exists := pl.vehicleToSlotMap[registrationNo]; exists {
+		return 0, &VehicleAlreadyParkedError{RegistrationNo: registrationNo, Slot: slot}
+	}
+	if reservation, exists := pl.reservations[registrationNo]; exists {
+		return 0, fmt.Errorf("%w: %s at slot %d", ErrVehicleAlreadyReserved, registrationNo, reservation.Slot)
+	}
+
+	// a window which has started already gives the vehicle the whole grace period from now
+	expiresAt := from
+	if now.After(expiresAt) {
+		expiresAt = now
+	}
+	expiresAt = expiresAt.Add(pl.reservationGrace)
+	if expiresAt.After(to) {
+		expiresAt = to
+	}
+
+	reservation := &Reservation{
+		RegistrationNo: registrationNo,
+		VehicleType:    vehicleType,
+		From:           from,
+		To:             to,
+		HoldsFrom:      from.Add(-pl.reservationLead),
+		ExpiresAt:      expiresAt,
+	}
+	held := !reservation.HoldsFrom.After(now)
+	var slot int
+	if held {
+		slot, err = pl.allocateAround(reservation)
+	} else {
+		slot, err = pl.bookableSlot(reservation)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	reservation.Slot = slot
+	pl.addReservation(reservation)
+	if held {
+		// allocateAround took the slot already
+		reservation.Held = true
+		pl.reservedSlots[slot] = reservation
+	}
+	pl.recordAllocation(reservation.event(EventReserved))
+	return slot, nil
+}
+
+// the pending reservations ordered by slot and window, brought up to now first, see syncReservations
+func (pl *ParkingLot) GetReservations() []Reservation {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if pl.reservationExpiry.Len() > 0 {
+		pl.syncReservations(pl.clock.Now())
+	}
+	reservations := make([]Reservation, 0, len(pl.reservations))
+	for _, reservation := range pl.reservations {
+		reservations = append(reservations, *reservation)
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		if reservations[i].Slot != reservations[j].Slot {
+			return reservations[i].Slot < reservations[j].Slot
+		}
+		return reservations[i].From.Before(reservations[j].From)
+	})
+	return reservations
+}
+
+/*
+Brings the reservations up to now, the caller holds the lock.
+
+The reservations which expired release their slots first, then the ones whose hold started take theirs if they are free.
+The ones whose slot is still occupied move to another slot, see moveReservation, the earliest window first.
+Without one they take their slot once it is free again, the next time the reservations are synced.
+*/
+func (pl *ParkingLot) syncReservations(now time.Time) {
+	for pl.reservationExpiry.Len() > 0 && !pl.reservationExpiry[0].ExpiresAt.After(now) {
+		reservation := heap.Pop(&pl.reservationExpiry).(*Reservation)
+		// claimed reservations are left in the heap, skip them
+		if pl.reservations[reservation.RegistrationNo] != reservation {
+			continue
+		}
+		pl.releaseReservation(reservation)
+		pl.record(reservation.event(EventReservationExpired))
+	}
+
+	occupied := make([]*Reservation, 0)
+	for _, reservation := range pl.reservations {
+		if reservation.Held || reservation.HoldsFrom.After(now) {
+			continue
+		}
+		if !pl.isFree(reservation.Slot) {
+			occupied = append(occupied, reservation)
+			continue
+		}
+		seg, _ := findSegment(pl.segments, reservation.Slot)
+		seg.pool(seg.attributesOf(reservation.Slot)).Take(reservation.Slot)
+		reservation.Held = true
+		pl.reservedSlots[reservation.Slot] = reservation
+	}
+
+	sort.Slice(occupied, func(i, j int) bool {
+		if !occupied[i].From.Equal(occupied[j].From) {
+			return occupied[i].From.Before(occupied[j].From)
+		}
+		return occupied[i].Slot < occupied[j].Slot
+	})
+	for _, reservation := range occupied {
+		pl.moveReservation(reservation)
+	}
+}
+
+/*
+Moves a reservation due to be held whose slot is occupied to a free slot, which it holds, the caller holds the lock.
+
+The slot is allocated like for a window held from now on, see allocateAround. Without one the reservation stays put.
+*/
+func (pl *ParkingLot) moveReservation(reservation *Reservation) {
+	slot, err := pl.allocateAround(reservation)
+	if err != nil {
+		return
+	}
+	event := reservation.event(EventReservationMoved)
+	event.Slot = slot
+	pl.rebookReservation(reservation, slot)
+	// allocateAround took the slot already
+	reservation.Held = true
+	pl.reservedSlots[slot] = reservation
+	pl.recordAllocation(event)
+}
+
+/*
+Allocates a free slot for a window held from now on, the caller holds the lock.
+
+The free slots booked for an overlapping window are kept out of the allocation meanwhile.
+*/
+func (pl *ParkingLot) allocateAround(reservation *Reservation) (int, error) {
+	booked := make([]int, 0)
+	for slot := range pl.slotReservations {
+		if pl.isFree(slot) && pl.overlapsReservation(slot, reservation) {
+			seg, _ := findSegment(pl.segments, slot)
+			seg.pool(seg.attributesOf(slot)).Take(slot)
+			booked = append(booked, slot)
+		}
+	}
+	defer func() {
+		for _, slot := range booked {
+			seg, _ := findSegment(pl.segments, slot)
+			seg.pool(seg.attributesOf(slot)).Release(slot)
+		}
+	}()
+
+	slot, err := pl.allocate(reservation.VehicleType, 0, "")
+	if errors.Is(err, ErrParkingLotFull) && len(booked) > 0 {
+		return 0, fmt.Errorf("%w: %s", ErrNoSlotForWindow, reservation.VehicleType)
+	}
+	return slot, err
+}
+
+/*
+Picks the slot for a window held later, the caller holds the lock.
+
+It is the nearest slot of the smallest size fitting the vehicle type without an overlapping reservation,
+an untagged one unless the special slot policy gives tagged slots as a last resort. Nothing is taken yet.
+*/
+func (pl *ParkingLot) bookableSlot(reservation *Reservation) (int, error) {
+	accepts := []func(SlotAttributes) bool{func(attributes SlotAttributes) bool { return attributes == 0 }}
+	if pl.specialSlotPolicy == SpecialSlotsLastResort {
+		accepts = append(accepts, func(SlotAttributes) bool { return true })
+	}
+	fits := false
+	for _, accept := range accepts {
+		for size := reservation.VehicleType.SlotSize(); size <= SlotSizeXLarge; size++ {
+			for _, seg := range pl.segments {
+				if seg.size != size {
+					continue
+				}
+				for slot := seg.first; slot <= seg.last; slot++ {
+					if !accept(seg.attributesOf(slot)) {
+						continue
+					}
+					fits = true
+					if !pl.overlapsReservation(slot, reservation) {
+						return slot, nil
+					}
+				}
+			}
+		}
+	}
+	if !fits {
+		return 0, fmt.Errorf("%w: %s", ErrNoSlotForVehicleType, reservation.VehicleType)
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNoSlotForWindow, reservation.VehicleType)
+}
+
+// whether another reservation of the slot overlaps the window of the reservation, lead times included
+func (pl *ParkingLot) overlapsReservation(slot int, reservation *Reservation) bool {
+	for _, other := range pl.slotReservations[slot] {
+		if other.HoldsFrom.Before(reservation.To) && reservation.HoldsFrom.Before(other.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether the slot is neither occupied nor held for a reservation
+func (pl *ParkingLot) isFree(slot int) bool {
+	_, occupied := pl.occupiedSlots[slot]
+	_, reserved := pl.reservedSlots[slot]
+	return !occupied && !reserved
+}
+
+/*
+Hands the reserved slot over to the vehicle, the caller holds the lock.
+
+A slot not held yet is handed over if it is free. A vehicle which does not fit the reserved slot
+(a van in place of the car it was reserved for), or finds it occupied, gives the reservation up and is allocated like any other.
+*/
+func (pl *ParkingLot) claimReservation(vehicle *Vehicle) (int, bool) {
+	reservation, ok := pl.reservations[vehicle.registrationNumber]
+	if !ok {
+		return 0, false
+	}
+
+	seg, ok := findSegment(pl.segments, reservation.Slot)
+	if ok && vehicle.vehicleType.SlotSize() <= seg.size && (reservation.Held || pl.isFree(reservation.Slot)) {
+		if !pl.dropReservation(reservation) {
+			seg.pool(seg.attributesOf(reservation.Slot)).Take(reservation.Slot)
+		}
+		pl.record(reservation.event(EventReservationClaimed))
+		return reservation.Slot, true
+	}
+	pl.releaseReservation(reservation)
+	pl.record(reservation.event(EventReservationReleased))
+	return 0, false
+}
+
+// books the slot for the reservation, it is held once syncReservations finds it due
+func (pl *ParkingLot) addReservation(reservation *Reservation) {
+	pl.reservations[reservation.RegistrationNo] = reservation
+	pl.bookSlot(reservation)
+	heap.Push(&pl.reservationExpiry, reservation)
+}
+
+// books another slot for the reservation, giving back the slot it held, if any
+func (pl *ParkingLot) rebookReservation(reservation *Reservation, slot int) {
+	if reservation.Held {
+		delete(pl.reservedSlots, reservation.Slot)
+		reservation.Held = false
+		pl.releaseSlot(reservation.Slot)
+	}
+	pl.unbookSlot(reservation)
+	reservation.Slot = slot
+	pl.bookSlot(reservation)
+}
+
+// adds the reservation to the ones of its slot
+func (pl *ParkingLot) bookSlot(reservation *Reservation) {
+	booked := pl.slotReservations[reservation.Slot]
+	i := sort.Search(len(booked), func(i int) bool { return reservation.From.Before(booked[i].From) })
+	pl.slotReservations[reservation.Slot] = slices.Insert(booked, i, reservation)
+}
+
+// removes the reservation from the ones of its slot
+func (pl *ParkingLot) unbookSlot(reservation *Reservation) {
+	booked := slices.DeleteFunc(pl.slotReservations[reservation.Slot], func(other *Reservation) bool { return other == reservation })
+	if len(booked) == 0 {
+		delete(pl.slotReservations, reservation.Slot)
+	} else {
+		pl.slotReservations[reservation.Slot] = booked
+	}
+}
+
+// drops the reservation, gives its slot back if it was held
+func (pl *ParkingLot) releaseReservation(reservation *Reservation) {
+	if pl.dropReservation(reservation) {
+		pl.releaseSlot(reservation.Slot)
+	}
+}
+
+// forgets the reservation, returns whether its slot was held. The slot is left taken then.
+func (pl *ParkingLot) dropReservation(reservation *Reservation) bool {
+	delete(pl.reservations, reservation.RegistrationNo)
+	pl.unbookSlot(reservation)
+	held := reservation.Held
+	if held {
+		delete(pl.reservedSlots, reservation.Slot)
+		reservation.Held = false
+	}
+	return held
+}
@@ -0,0 +1,215 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// manualClock only moves when the test says so.
+type manualClock struct {
+	now time.Time
+}
+
+func (mc *manualClock) Now() time.Time {
+	return mc.now
+}
+
+func TestParkingLotReservationIsClaimedOnPark(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(2, WithClock(clock))
+
+	// the window starts within the lead time, the slot is held right away
+	slot, err := parkingLot.Reserve("KA-01-HH-1234", VehicleTypeCar, clock.now.Add(10*time.Minute), clock.now.Add(3*time.Hour))
+	if err != nil || slot != 1 {
+		t.Fatalf("expected slot 1 to be reserved, got %d (%v)", slot, err)
+	}
+	if _, err := parkingLot.Reserve("KA-01-HH-1234", VehicleTypeCar, clock.now.Add(time.Hour), clock.now.Add(2*time.Hour)); !errors.Is(err, ErrVehicleAlreadyReserved) {
+		t.Errorf("expected %v, got %v", ErrVehicleAlreadyReserved, err)
+	}
+
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-9999", "White")); err != nil || slot != 2 {
+		t.Fatalf("expected the reserved slot to be skipped, got %d (%v)", slot, err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-8888", "White")); err != ErrParkingLotFull {
+		t.Fatalf("expected %v, got %v", ErrParkingLotFull, err)
+	}
+
+	clock.now = clock.now.Add(20 * time.Minute)
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-1234", "Red")); err != nil || slot != 1 {
+		t.Fatalf("expected the reserved slot 1 to be claimed, got %d (%v)", slot, err)
+	}
+	if reservations := parkingLot.GetReservations(); len(reservations) != 0 {
+		t.Errorf("a claimed reservation must be gone, got %v", reservations)
+	}
+}
+
+func TestParkingLotReservationExpires(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(1, WithClock(clock), WithReservationGrace(10*time.Minute))
+
+	if _, err := parkingLot.Reserve("KA-01-HH-1234", VehicleTypeCar, clock.now.Add(time.Hour), clock.now.Add(3*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = clock.now.Add(69 * time.Minute)
+	if reservations := parkingLot.GetReservations(); len(reservations) != 1 || !reservations[0].ExpiresAt.Equal(clock.now.Add(time.Minute)) {
+		t.Fatalf("expected the reservation to be held for the grace period, got %v", reservations)
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-9999", "White")); err != nil || slot != 1 {
+		t.Fatalf("expected the slot of the no-show to be free, got %d (%v)", slot, err)
+	}
+	if reservations := parkingLot.GetReservations(); len(reservations) != 0 {
+		t.Errorf("expected the reservation to be expired, got %v", reservations)
+	}
+}
+
+func TestParkingLotReservationWindow(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(2, WithClock(clock))
+
+	for _, window := range [][2]time.Duration{{time.Hour, time.Hour}, {2 * time.Hour, time.Hour}, {-2 * time.Hour, -time.Hour}} {
+		if _, err := parkingLot.Reserve("KA-01-HH-1234", VehicleTypeCar, clock.now.Add(window[0]), clock.now.Add(window[1])); !errors.Is(err, ErrInvalidReservation) {
+			t.Errorf("window %v: expected %v, got %v", window, ErrInvalidReservation, err)
+		}
+	}
+	if available := parkingLot.GetAvailableSlotCount(); available != 2 {
+		t.Errorf("rejected reservations must not hold a slot, %d slots available", available)
+	}
+}
+
+func TestParkingLotReservationHoldsTheSlotAroundItsWindow(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(1, WithClock(clock), WithWaitlist(), WithReservationLead(15*time.Minute))
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.November, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	if slot, err := parkingLot.Reserve("KA-01-HH-1234", VehicleTypeCar, at(10, 0), at(12, 0)); err != nil || slot != 1 {
+		t.Fatalf("expected slot 1 to be reserved, got %d (%v)", slot, err)
+	}
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-9999", "White")); err != nil || slot != 1 {
+		t.Fatalf("expected the slot to be free before the window, got %d (%v)", slot, err)
+	}
+	if slot, err := parkingLot.Reserve("KA-01-HH-5555", VehicleTypeCar, at(12, 15), at(13, 0)); err != nil || slot != 1 {
+		t.Fatalf("expected the next window to share slot 1, got %d (%v)", slot, err)
+	}
+	// the lead time of the next window overlaps the first one
+	if _, err := parkingLot.Reserve("KA-01-HH-7777", VehicleTypeCar, at(12, 0), at(13, 0)); !errors.Is(err, ErrNoSlotForWindow) {
+		t.Fatalf("expected %v, got %v", ErrNoSlotForWindow, err)
+	}
+
+	// the hold is due, the slot is held once the vehicle parked there leaves
+	clock.now = at(9, 50)
+	if reservations := parkingLot.GetReservations(); len(reservations) != 2 || reservations[0].Held {
+		t.Fatalf("expected an occupied slot not to be held, got %v", reservations)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-8888", "Blue")); !errors.Is(err, ErrWaitlisted) {
+		t.Fatalf("expected %v, got %v", ErrWaitlisted, err)
+	}
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if admissions := parkingLot.AdmitWaitlisted(); len(admissions) != 0 {
+		t.Fatalf("expected the held slot not to be given to the waitlist, got %v", admissions)
+	}
+	if reservations := parkingLot.GetReservations(); !reservations[0].Held || reservations[1].Held {
+		t.Fatalf("expected only the first reservation to hold the slot, got %v", reservations)
+	}
+
+	clock.now = at(10, 5)
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-1234", "Red")); err != nil || slot != 1 {
+		t.Fatalf("expected the reserved slot 1 to be claimed, got %d (%v)", slot, err)
+	}
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if admissions := parkingLot.AdmitWaitlisted(); len(admissions) != 1 {
+		t.Fatalf("expected the waitlisted vehicle to be admitted before the next hold, got %v", admissions)
+	}
+}
+
+func TestParkingLotReservationMovesOffAnOccupiedSlot(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	eventLog := NewEventLog()
+	parkingLot := NewParkingLot(4, WithClock(clock), WithReservationLead(15*time.Minute), WithEventLog(eventLog, "default"))
+	eventLog.Append(Event{Type: EventLotCreated, At: clock.now, Lot: "default", State: parkingLot.Snapshot()})
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.November, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	for i, window := range [][2]time.Time{{at(10, 0), at(12, 0)}, {at(10, 30), at(12, 0)}, {at(11, 0), at(13, 0)}} {
+		if slot, err := parkingLot.Reserve(fmt.Sprintf("KA-01-HH-100%d", i+1), VehicleTypeCar, window[0], window[1]); err != nil || slot != i+1 {
+			t.Fatalf("expected slot %d to be reserved, got %d (%v)", i+1, slot, err)
+		}
+	}
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil || slot != 1 {
+		t.Fatalf("expected slot 1 to be free before the window, got %d (%v)", slot, err)
+	}
+
+	// the hold is due with slot 1 occupied, the free slots 2 and 3 are booked for overlapping windows
+	clock.now = at(9, 50)
+	reservations := parkingLot.GetReservations()
+	if len(reservations) != 3 || reservations[2].RegistrationNo != "KA-01-HH-1001" || reservations[2].Slot != 4 || !reservations[2].Held {
+		t.Fatalf("expected the reservation to hold slot 4 instead, got %v", reservations)
+	}
+	for _, want := range []int{2, 3} {
+		if slot, err := parkingLot.Park(NewVehicle(fmt.Sprintf("KA-01-HH-000%d", want), "Blue")); err != nil || slot != want {
+			t.Fatalf("expected slot %d, got %d (%v)", want, slot, err)
+		}
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0004", "Blue")); err != ErrParkingLotFull {
+		t.Fatalf("expected %v, got %v", ErrParkingLotFull, err)
+	}
+
+	// a lot derived from the events has the reservation moved too
+	events := eventLog.Events(func(event Event) bool { return event.Type == EventReservationMoved })
+	if len(events) != 1 || events[0].Slot != 4 || events[0].Reservation.Slot != 1 {
+		t.Fatalf("expected the move from slot 1 to slot 4 to be recorded, got %v", events)
+	}
+	derived, err := DeriveParkingLot(eventLog.Events(func(event Event) bool { return true }), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := snapshotJSON(t, derived), snapshotJSON(t, parkingLot); got != want {
+		t.Fatalf("derived lot differs:\n%s\n%s", want, got)
+	}
+
+	clock.now = at(10, 5)
+	if slot, err := parkingLot.Park(NewVehicle("KA-01-HH-1001", "Red")); err != nil || slot != 4 {
+		t.Fatalf("expected the held slot 4 to be claimed, got %d (%v)", slot, err)
+	}
+}
+
+func TestParkingLotRevertsAMovedReservation(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	eventLog := NewEventLog()
+	parkingLot := NewParkingLot(2, WithClock(clock), WithReservationLead(15*time.Minute), WithEventLog(eventLog, "default"))
+
+	if _, err := parkingLot.Reserve("KA-01-HH-1001", VehicleTypeCar, clock.now.Add(time.Hour), clock.now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(50 * time.Minute)
+	parkingLot.GetReservations()
+
+	moved := eventLog.Since(eventLog.LastSeq() - 1)
+	if len(moved) != 1 || moved[0].Type != EventReservationMoved {
+		t.Fatalf("expected a %s event, got %v", EventReservationMoved, moved)
+	}
+	if err := parkingLot.Revert(moved, nil); err != nil {
+		t.Fatal(err)
+	}
+	// back on the occupied slot 1, slot 2 is free again
+	if reservation := parkingLot.reservations["KA-01-HH-1001"]; reservation.Slot != 1 || reservation.Held {
+		t.Fatalf("expected the reservation to wait for slot 1 again, got %v", reservation)
+	}
+	if slots := parkingLot.GetAvailableSlots(); fmt.Sprint(slots) != "[2]" {
+		t.Fatalf("expected free slots [2], got %v", slots)
+	}
+}
@@ -0,0 +1,174 @@
+package parkingmanager
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+/*
+Undoes the events the lot recorded, latest first, then puts the allocation strategy back to the given position,
+see StrategyPosition (nil is the start of its sequence).
+
+The events are the ones of the latest change of the lot, e.g. those of a command, nothing else changed the lot since.
+A vehicle parked is taken away again, queued at its old position when it came from the waitlist,
+a vehicle which left is put back at its slot with its ticket and entry time, ahead of the vehicles parked after it.
+Every event undone is recorded as an Undone event, so a lot derived from its events is undone too.
+*/
+func (pl *ParkingLot) Revert(events []Event, strategyPosition *int64) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	eventLog := pl.eventLog
+	pl.eventLog = nil
+	undone := make([]Event, 0, len(events))
+	var err error
+	for i := len(events) - 1; i >= 0 && err == nil; i-- {
+		if err = pl.revert(events[i]); err == nil {
+			event := events[i]
+			undone = append(undone, Event{Type: EventUndone, Slot: event.Slot, Undone: &event})
+		}
+	}
+	if strategy, ok := pl.allocationStrategy.(builtinStrategy); ok && err == nil && len(undone) > 0 {
+		last := &undone[len(undone)-1]
+		if strategyPosition != nil {
+			strategy.seek(*strategyPosition)
+			last.StrategyPosition = strategyPosition
+		} else if _, started := strategy.position(); started {
+			strategy.reset()
+			last.StrategyReset = true
+		}
+	}
+	pl.eventLog = eventLog
+
+	for _, event := range undone {
+		pl.record(event)
+	}
+	return err
+}
+
+/*
+Applies the events undone by Revert again, in order, and records them again (a redo).
+
+The vehicles get the slots, tickets and entry times they had, the allocation strategy the position it had.
+*/
+func (pl *ParkingLot) Reapply(events []Event) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	eventLog := pl.eventLog
+	pl.eventLog = nil
+	applied := 0
+	var err error
+	for _, event := range events {
+		if err = pl.apply(event); err != nil {
+			break
+		}
+		applied++
+	}
+	pl.eventLog = eventLog
+
+	for _, event := range events[:applied] {
+		// a vehicle is parked since its entry time, the rest happens now
+		if event.Type != EventParked {
+			event.At = time.Time{}
+		}
+		pl.record(event)
+	}
+	return err
+}
+
+// where the allocation strategy got to, nil when it has not started its sequence or has none (see LotSnapshot)
+func (pl *ParkingLot) StrategyPosition() *int64 {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	return pl.strategyPosition()
+}
+
+// see StrategyPosition, the caller holds the lock
+func (pl *ParkingLot) strategyPosition() *int64 {
+	if strategy, ok := pl.allocationStrategy.(builtinStrategy); ok {
+		if position, ok := strategy.position(); ok {
+			return &position
+		}
+	}
+	return nil
+}
+
+// undoes an event, the caller holds the lock and keeps the event from being recorded
+func (pl *ParkingLot) revert(event Event) error {
+	seg, hasSlot := findSegment(pl.segments, event.Slot)
+	switch event.Type {
+	case EventParked:
+		vehicle, ok := pl.occupiedSlots[event.Slot]
+		if !ok || vehicle.ticketID != event.TicketID {
+			return fmt.Errorf("%w: slot %d does not hold ticket %s", ErrInvalidEvent, event.Slot, event.TicketID)
+		}
+		if _, err := pl.leave(event.Slot); err != nil {
+			return err
+		}
+		if event.Position > 0 {
+			vehicle.entryTime, vehicle.ticketID = time.Time{}, ""
+			pl.waitlist = slices.Insert(pl.waitlist, min(event.Position-1, len(pl.waitlist)), vehicle)
+		}
+	case EventLeft:
+		if !hasSlot || event.Vehicle == nil || event.EntryTime == nil {
+			return ErrInvalidEvent
+		}
+		if _, occupied := pl.occupiedSlots[event.Slot]; occupied {
+			return fmt.Errorf("%w: %d", ErrSlotOccupied, event.Slot)
+		}
+		vehicle, err := pl.restoreVehicle(*event.Vehicle)
+		if err != nil {
+			return err
+		}
+		seg.pool(seg.attributesOf(event.Slot)).Take(event.Slot)
+		vehicle.entryTime, vehicle.ticketID = *event.EntryTime, event.TicketID
+		pl.index(vehicle, event.Slot)
+	case EventReserved:
+		reservation, ok := pl.reservations[event.RegistrationNo()]
+		if !ok {
+			return fmt.Errorf("%w: no reservation for %s", ErrInvalidEvent, event.RegistrationNo())
+		}
+		pl.releaseReservation(reservation)
+	case EventReservationClaimed, EventReservationReleased, EventReservationExpired:
+		// the vehicle which claimed the slot is gone already, the events are undone latest first
+		if !hasSlot || event.Reservation == nil {
+			return ErrInvalidEvent
+		}
+		if err := pl.bookReservation(*event.Reservation); err != nil {
+			return err
+		}
+	case EventReservationMoved:
+		reservation, ok := pl.reservations[event.RegistrationNo()]
+		if !ok || event.Reservation == nil {
+			return fmt.Errorf("%w: no reservation for %s", ErrInvalidEvent, event.RegistrationNo())
+		}
+		pl.rebookReservation(reservation, event.Reservation.Slot)
+	case EventWaitlisted:
+		position := pl.waitlistPosition(event.RegistrationNo())
+		if position == 0 {
+			return fmt.Errorf("%w: %s", ErrVehicleNotWaitlisted, event.RegistrationNo())
+		}
+		pl.waitlist = slices.Delete(pl.waitlist, position-1, position)
+	case EventWaitlistCancelled:
+		if event.Vehicle == nil || event.Position == 0 {
+			return ErrInvalidEvent
+		}
+		vehicle, err := pl.restoreVehicle(*event.Vehicle)
+		if err != nil {
+			return err
+		}
+		pl.waitlist = slices.Insert(pl.waitlist, min(event.Position-1, len(pl.waitlist)), vehicle)
+	case EventSlotTagged:
+		attributes, err := ParseSlotAttributes(event.PreviousAttributes)
+		if !hasSlot || err != nil {
+			return ErrInvalidEvent
+		}
+		pl.tagSlot(seg, event.Slot, attributes)
+	default:
+		return fmt.Errorf("%w: %s cannot be undone", ErrInvalidEvent, event.Type)
+	}
+	return nil
+}
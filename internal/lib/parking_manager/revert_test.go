@@ -0,0 +1,141 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// the colours of the lot with their vehicles in index order
+func colorIndex(parkingLot *ParkingLot) string {
+	index := ""
+	for _, color := range []string{"WHITE", "RED", "BLUE"} {
+		vehicles, _ := parkingLot.GetVehiclesByColor(color)
+		index += fmt.Sprintf("%s%v ", color, vehicles)
+	}
+	return index
+}
+
+// makes the change, then undoes and redoes it twice: the lot has to be as it was before, then after the change
+func checkReversible(t *testing.T, parkingLot *ParkingLot, eventLog *EventLog, change func() error) {
+	t.Helper()
+	before, beforeIndex := snapshotJSON(t, parkingLot), colorIndex(parkingLot)
+	position := parkingLot.StrategyPosition()
+	seq := uint64(len(eventLog.Events(func(event Event) bool { return true })))
+	if err := change(); err != nil {
+		t.Fatal(err)
+	}
+	events := eventLog.Events(func(event Event) bool { return event.Seq > seq })
+	after, afterIndex := snapshotJSON(t, parkingLot), colorIndex(parkingLot)
+
+	for range 2 {
+		if err := parkingLot.Revert(events, position); err != nil {
+			t.Fatal(err)
+		}
+		if got := snapshotJSON(t, parkingLot); got != before {
+			t.Fatalf("lot not restored by the undo:\n%s\n%s", before, got)
+		}
+		if got := colorIndex(parkingLot); got != beforeIndex {
+			t.Fatalf("colour index not restored by the undo:\n%s\n%s", beforeIndex, got)
+		}
+		if err := parkingLot.Reapply(events); err != nil {
+			t.Fatal(err)
+		}
+		if got := snapshotJSON(t, parkingLot); got != after {
+			t.Fatalf("lot not restored by the redo:\n%s\n%s", after, got)
+		}
+		if got := colorIndex(parkingLot); got != afterIndex {
+			t.Fatalf("colour index not restored by the redo:\n%s\n%s", afterIndex, got)
+		}
+	}
+}
+
+func TestRevertAndReapplyChanges(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	eventLog := NewEventLog()
+	strategy, _ := NewAllocationStrategy(AllocationRandom, 7)
+	parkingLot := NewParkingLotWithLayout(Layout{
+		{Level: 1, Size: SlotSizeMedium, Count: 3},
+		{Level: 2, Size: SlotSizeMedium, Count: 3},
+	}, WithClock(clock), WithWaitlist(), WithAllocationStrategy(strategy), WithEventLog(eventLog, "default"))
+	eventLog.Append(Event{Type: EventLotCreated, Lot: "default", State: parkingLot.Snapshot()})
+
+	park := func(registrationNo, color string) func() error {
+		return func() error {
+			clock.now = clock.now.Add(time.Minute)
+			_, err := parkingLot.Park(NewVehicle(registrationNo, color))
+			var waitlisted *WaitlistedError
+			if errors.As(err, &waitlisted) {
+				return nil
+			}
+			return err
+		}
+	}
+	leave := func(registrationNo string) func() error {
+		return func() error {
+			clock.now = clock.now.Add(time.Minute)
+			slot, _ := parkingLot.GetSlotByRegistrationNo(registrationNo)
+			if _, err := parkingLot.Leave(slot); err != nil {
+				return err
+			}
+			parkingLot.AdmitWaitlisted()
+			return nil
+		}
+	}
+
+	for _, change := range []func() error{
+		park("KA-01-HH-0001", "White"),
+		park("KA-01-HH-0002", "Red"),
+		park("KA-01-HH-0003", "White"),
+		func() error {
+			_, err := parkingLot.Reserve("KA-01-HH-0004", VehicleTypeCar, clock.now.Add(10*time.Minute), clock.now.Add(2*time.Hour))
+			return err
+		},
+		park("KA-01-HH-0005", "White"),
+		func() error { return parkingLot.TagSlot(1, SlotAttributeEV) },
+		// a vehicle in the middle of the colour index leaves
+		leave("KA-01-HH-0003"),
+		park("KA-01-HH-0006", "Blue"),
+		park("KA-01-HH-0007", "White"),
+		park("KA-01-HH-0008", "White"),
+		park("KA-01-HH-0009", "Red"),
+		func() error { return parkingLot.CancelWaitlist("KA-01-HH-0008") },
+		// the first vehicle queued is admitted to the slot freed
+		leave("KA-01-HH-0001"),
+		// the reservation is claimed
+		func() error {
+			clock.now = clock.now.Add(5 * time.Minute)
+			return parkingLot.ParkAt(NewVehicle("KA-01-HH-0004", "Blue"), parkingLot.GetReservations()[0].Slot)
+		},
+	} {
+		checkReversible(t, parkingLot, eventLog, change)
+	}
+
+	// the undone and redone changes are in the events too
+	derived, err := DeriveParkingLot(eventLog.Events(func(event Event) bool { return true }), WithClock(clock), WithWaitlist())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := snapshotJSON(t, derived), snapshotJSON(t, parkingLot); got != want {
+		t.Fatalf("derived lot differs:\n%s\n%s", want, got)
+	}
+	if got, want := colorIndex(derived), colorIndex(parkingLot); got != want {
+		t.Fatalf("derived colour index differs:\n%s\n%s", want, got)
+	}
+}
+
+func TestRevertRefusesEventsNotMatchingTheLot(t *testing.T) {
+	eventLog := NewEventLog()
+	parkingLot := NewParkingLot(2, WithEventLog(eventLog, "default"))
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil {
+		t.Fatal(err)
+	}
+	events := eventLog.Events(func(event Event) bool { return true })
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := parkingLot.Revert(events, nil); !errors.Is(err, ErrInvalidEvent) {
+		t.Fatalf("expected %v, got %v", ErrInvalidEvent, err)
+	}
+}
@@ -0,0 +1,285 @@
+package parkingmanager
+
+import (
+	"sort"
+)
+
+type (
+	/*
+		slotSet is an ordered set of slot numbers which counts the slots below any slot, all in O(log n).
+
+		It is a treap: a binary search tree by slot, a heap by a priority hashed from the slot, each node knowing its size.
+	*/
+	slotSet struct {
+		root *slotNode
+	}
+
+	slotNode struct {
+		slot        int
+		priority    uint64
+		size        int
+		left, right *slotNode
+	}
+
+	/*
+		slotAllocator hands out the nearest (lowest numbered) free slot of the range first..last.
+
+		Slots from next to last have never been handed out, they are free without being stored anywhere,
+		so a fresh lot costs the same memory whatever its capacity.
+		Only the released slots are kept, in order, so either end and the n-th free slot are found in O(log n).
+		A specific free slot can be taken out of turn: a released one is removed, one of the range is marked as taken (claimed)
+		and dropped once it reaches an end of the range. Allocating and releasing a slot stay O(log n).
+	*/
+	slotAllocator struct {
+		next     int
+		last     int
+		released slotSet // free slots out of the range
+		claimed  slotSet // slots of the range taken out of turn
+	}
+)
+
+func newSlotAllocator(first, last int) *slotAllocator {
+	return &slotAllocator{next: first, last: last}
+}
+
+// an allocator without any free slot, slots are added to it by Release
+func newEmptySlotAllocator() *slotAllocator {
+	return &slotAllocator{next: 1, last: 0}
+}
+
+// returns the slot Allocate would hand out, without allocating it
+func (sa *slotAllocator) Peek() (int, bool) {
+	sa.dropClaimed()
+
+	lowest, fromSet := sa.released.min()
+	fromRange := sa.next <= sa.last
+	switch {
+	case fromSet && (!fromRange || lowest < sa.next):
+		return lowest, true
+	case fromRange:
+		return sa.next, true
+	}
+	return 0, false
+}
+
+// Returns the highest free slot, without allocating it: the end of the range or a released slot above it.
+func (sa *slotAllocator) PeekLast() (int, bool) {
+	sa.dropClaimed()
+
+	highest, fromSet := sa.released.max()
+	fromRange := sa.next <= sa.last
+	switch {
+	case fromSet && (!fromRange || highest > sa.last):
+		return highest, true
+	case fromRange:
+		return sa.last, true
+	}
+	return 0, false
+}
+
+// Returns the free slot with n free slots below it, without allocating it. n is below Len.
+func (sa *slotAllocator) Nth(n int) int {
+	lowest, _ := sa.Peek()
+	highest, _ := sa.PeekLast()
+	// the lowest slot with more than n free slots up to it
+	return lowest + sort.Search(highest-lowest, func(i int) bool { return sa.countUpTo(lowest+i) > n })
+}
+
+func (sa *slotAllocator) Allocate() (int, bool) {
+	slot, ok := sa.Peek()
+	if ok {
+		sa.Take(slot)
+	}
+	return slot, ok
+}
+
+func (sa *slotAllocator) Release(slot int) {
+	// a slot taken out of turn is still in place, it only has to be unmarked
+	if sa.claimed.remove(slot) {
+		return
+	}
+	sa.released.insert(slot)
+}
+
+// takes the given slot, which the caller knows to be free in this allocator, out of turn unless it is at an end of the range
+func (sa *slotAllocator) Take(slot int) {
+	switch {
+	case sa.released.remove(slot):
+	case slot == sa.next:
+		sa.next++
+	case slot == sa.last:
+		sa.last--
+	default:
+		sa.claimed.insert(slot)
+	}
+}
+
+func (sa *slotAllocator) Len() int {
+	length := sa.released.len() - sa.claimed.len()
+	if sa.next <= sa.last {
+		length += sa.last - sa.next + 1
+	}
+	return length
+}
+
+// returns the free slots in ascending order
+func (sa *slotAllocator) Slots() []int {
+	slots := make([]int, 0, sa.Len())
+	sa.released.each(func(slot int) {
+		slots = append(slots, slot)
+	})
+	for slot := sa.next; slot <= sa.last; slot++ {
+		if !sa.claimed.has(slot) {
+			slots = append(slots, slot)
+		}
+	}
+	// released slots are below the range, unless its end was taken
+	sort.Ints(slots)
+	return slots
+}
+
+// the number of free slots up to the given one
+func (sa *slotAllocator) countUpTo(slot int) int {
+	count := sa.released.rank(slot+1) - sa.claimed.rank(slot+1)
+	if upTo := min(slot, sa.last); upTo >= sa.next {
+		count += upTo - sa.next + 1
+	}
+	return count
+}
+
+// drops the slots taken out of turn from both ends of the range
+func (sa *slotAllocator) dropClaimed() {
+	for sa.next <= sa.last && sa.claimed.remove(sa.next) {
+		sa.next++
+	}
+	for sa.next <= sa.last && sa.claimed.remove(sa.last) {
+		sa.last--
+	}
+}
+
+func (ss *slotSet) len() int {
+	return ss.root.len()
+}
+
+func (ss *slotSet) has(slot int) bool {
+	node := ss.root
+	for node != nil && node.slot != slot {
+		if slot < node.slot {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return node != nil
+}
+
+func (ss *slotSet) insert(slot int) {
+	below, above := splitSlots(ss.root, slot)
+	ss.root = mergeSlots(mergeSlots(below, &slotNode{slot: slot, priority: slotPriority(slot), size: 1}), above)
+}
+
+// removes the slot, returns whether it was in the set
+func (ss *slotSet) remove(slot int) bool {
+	below, rest := splitSlots(ss.root, slot)
+	found, above := splitSlots(rest, slot+1)
+	ss.root = mergeSlots(below, above)
+	return found != nil
+}
+
+func (ss *slotSet) min() (int, bool) {
+	node := ss.root
+	if node == nil {
+		return 0, false
+	}
+	for node.left != nil {
+		node = node.left
+	}
+	return node.slot, true
+}
+
+func (ss *slotSet) max() (int, bool) {
+	node := ss.root
+	if node == nil {
+		return 0, false
+	}
+	for node.right != nil {
+		node = node.right
+	}
+	return node.slot, true
+}
+
+// the number of slots below the given one
+func (ss *slotSet) rank(slot int) int {
+	count := 0
+	for node := ss.root; node != nil; {
+		if node.slot < slot {
+			count += node.left.len() + 1
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	return count
+}
+
+// calls visit with every slot, in ascending order
+func (ss *slotSet) each(visit func(slot int)) {
+	var walk func(node *slotNode)
+	walk = func(node *slotNode) {
+		if node != nil {
+			walk(node.left)
+			visit(node.slot)
+			walk(node.right)
+		}
+	}
+	walk(ss.root)
+}
+
+func (node *slotNode) len() int {
+	if node == nil {
+		return 0
+	}
+	return node.size
+}
+
+// splits the tree into the slots below the given one and the others
+func splitSlots(node *slotNode, slot int) (*slotNode, *slotNode) {
+	if node == nil {
+		return nil, nil
+	}
+	if node.slot < slot {
+		below, above := splitSlots(node.right, slot)
+		node.right = below
+		node.size = node.left.len() + node.right.len() + 1
+		return node, above
+	}
+	below, above := splitSlots(node.left, slot)
+	node.left = above
+	node.size = node.left.len() + node.right.len() + 1
+	return below, node
+}
+
+// joins two trees, the slots of the first one are below the ones of the second one
+func mergeSlots(below, above *slotNode) *slotNode {
+	switch {
+	case below == nil:
+		return above
+	case above == nil:
+		return below
+	case below.priority > above.priority:
+		below.right = mergeSlots(below.right, above)
+		below.size = below.left.len() + below.right.len() + 1
+		return below
+	}
+	above.left = mergeSlots(below, above.left)
+	above.size = above.left.len() + above.right.len() + 1
+	return above
+}
+
+// a priority spreading the slots evenly, the same for a slot every time (splitmix64), so the tree is balanced the same way
+func slotPriority(slot int) uint64 {
+	z := uint64(slot) + 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
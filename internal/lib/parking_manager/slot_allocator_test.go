@@ -0,0 +1,297 @@
+package parkingmanager
+
+import (
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+const benchmarkCapacity = 20000
+
+type allocator interface {
+	Allocate() (int, bool)
+	Release(slot int)
+}
+
+// sliceAllocator is the previous allocator: pop the head of a sorted slice, splice the slot back on release.
+type sliceAllocator struct {
+	free []int
+}
+
+func newSliceAllocator(capacity int) *sliceAllocator {
+	free := make([]int, capacity)
+	for i := range capacity {
+		free[i] = i + 1
+	}
+	return &sliceAllocator{free: free}
+}
+
+func (sa *sliceAllocator) Allocate() (int, bool) {
+	if len(sa.free) == 0 {
+		return 0, false
+	}
+	slot := sa.free[0]
+	sa.free = sa.free[1:]
+	return slot, true
+}
+
+func (sa *sliceAllocator) Release(slot int) {
+	i := 0
+	for i < len(sa.free) && sa.free[i] < slot {
+		i++
+	}
+	sa.free = append(sa.free[:i], append([]int{slot}, sa.free[i:]...)...)
+}
+
+func TestSlotAllocatorHandsOutNearestSlot(t *testing.T) {
+	sa := newSlotAllocator(1, 5)
+	for want := 1; want <= 5; want++ {
+		if slot, ok := sa.Allocate(); !ok || slot != want {
+			t.Fatalf("expected slot %d, got %d (ok=%v)", want, slot, ok)
+		}
+	}
+	if _, ok := sa.Allocate(); ok {
+		t.Fatal("expected a full allocator")
+	}
+
+	sa.Release(4)
+	sa.Release(2)
+	for _, want := range []int{2, 4} {
+		if slot, _ := sa.Allocate(); slot != want {
+			t.Fatalf("expected slot %d, got %d", want, slot)
+		}
+	}
+}
+
+func TestSlotAllocatorDoesNotPrepopulateSlots(t *testing.T) {
+	const capacity = 10_000_000
+
+	allocs := testing.AllocsPerRun(10, func() {
+		sa := newSlotAllocator(1, capacity)
+		sa.Allocate()
+	})
+	if allocs > 1 {
+		t.Errorf("expected a constant number of allocations, got %v", allocs)
+	}
+
+	sa := newSlotAllocator(1, capacity)
+	if sa.Len() != capacity {
+		t.Errorf("expected %d free slots, got %d", capacity, sa.Len())
+	}
+	if _, ok := sa.Allocate(); !ok || sa.Len() != capacity-1 {
+		t.Errorf("expected %d free slots after allocating, got %d", capacity-1, sa.Len())
+	}
+
+	// a slot is picked by its position without listing the free slots
+	sa.Take(capacity / 2)
+	if allocs := testing.AllocsPerRun(10, func() { sa.Nth(capacity - 3) }); allocs > 0 {
+		t.Errorf("expected no allocations to pick a slot, got %v", allocs)
+	}
+	if slot := sa.Nth(capacity/2 - 2); slot != capacity/2+1 {
+		t.Errorf("expected slot %d, got %d", capacity/2+1, slot)
+	}
+}
+
+func TestSlotAllocatorMatchesSliceAllocator(t *testing.T) {
+	const capacity = 500
+
+	sa, sliceAllocator := newSlotAllocator(1, capacity), newSliceAllocator(capacity)
+	for range capacity {
+		sa.Allocate()
+		sliceAllocator.Allocate()
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for range 10000 {
+		if rnd.Intn(2) == 0 {
+			slot := rnd.Intn(capacity) + 1
+			if !contains(sliceAllocator.free, slot) {
+				sa.Release(slot)
+				sliceAllocator.Release(slot)
+			}
+			continue
+		}
+
+		got, gotOk := sa.Allocate()
+		want, wantOk := sliceAllocator.Allocate()
+		if got != want || gotOk != wantOk {
+			t.Fatalf("allocators diverged: slotAllocator gave %d (%v), slice gave %d (%v)", got, gotOk, want, wantOk)
+		}
+	}
+}
+
+func TestSlotAllocatorTakesSlotsOutOfTurn(t *testing.T) {
+	sa := newSlotAllocator(1, 6)
+	sa.Allocate()
+	sa.Allocate()
+	sa.Release(1)
+
+	// one released slot, two from the range
+	sa.Take(1)
+	sa.Take(3)
+	sa.Take(5)
+	if sa.Len() != 2 {
+		t.Fatalf("expected 2 free slots, got %d", sa.Len())
+	}
+	if slots := sa.Slots(); len(slots) != 2 || slots[0] != 4 || slots[1] != 6 {
+		t.Fatalf("expected free slots [4 6], got %v", slots)
+	}
+
+	// a taken slot given back is free again where it was
+	sa.Release(5)
+	for _, want := range []int{4, 5, 6} {
+		if slot, ok := sa.Allocate(); !ok || slot != want {
+			t.Fatalf("expected slot %d, got %d (ok=%v)", want, slot, ok)
+		}
+	}
+	if _, ok := sa.Allocate(); ok {
+		t.Fatal("expected a full allocator")
+	}
+
+	sa.Release(3)
+	if slot, ok := sa.Allocate(); !ok || slot != 3 {
+		t.Fatalf("expected slot 3 back, got %d (ok=%v)", slot, ok)
+	}
+}
+
+// takes, allocates, releases, peeks at and picks random slots, comparing the free slots with a plain set
+func TestSlotAllocatorMatchesSetOfFreeSlots(t *testing.T) {
+	const capacity = 50
+
+	sa, free := newSlotAllocator(1, capacity), map[int]bool{}
+	for slot := 1; slot <= capacity; slot++ {
+		free[slot] = true
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := range 20000 {
+		slot := rnd.Intn(capacity) + 1
+		switch rnd.Intn(5) {
+		case 0:
+			if free[slot] {
+				sa.Take(slot)
+				delete(free, slot)
+			}
+		case 1:
+			got, ok := sa.Allocate()
+			want, wantOk := lowest(free)
+			if got != want || ok != wantOk {
+				t.Fatalf("step %d: Allocate gave %d (%v), expected %d (%v)", i, got, ok, want, wantOk)
+			}
+			delete(free, got)
+		case 2:
+			if !free[slot] {
+				sa.Release(slot)
+				free[slot] = true
+			}
+		case 3:
+			got, ok := sa.PeekLast()
+			want, wantOk := highest(free)
+			if got != want || ok != wantOk {
+				t.Fatalf("step %d: PeekLast gave %d (%v), expected %d (%v)", i, got, ok, want, wantOk)
+			}
+		case 4:
+			if len(free) == 0 {
+				continue
+			}
+			n := rnd.Intn(len(free))
+			if got, want := sa.Nth(n), slices.Sorted(maps.Keys(free))[n]; got != want {
+				t.Fatalf("step %d: Nth(%d) gave %d, expected %d", i, n, got, want)
+			}
+		}
+		if sa.Len() != len(free) {
+			t.Fatalf("step %d: expected %d free slots, got %d", i, len(free), sa.Len())
+		}
+	}
+}
+
+func TestSlotAllocatorPeeksLastReleasedAboveRange(t *testing.T) {
+	sa := newSlotAllocator(1, 5)
+	for _, slot := range []int{5, 4} {
+		last, _ := sa.PeekLast()
+		sa.Take(last)
+		if last != slot {
+			t.Fatalf("expected slot %d, got %d", slot, last)
+		}
+	}
+
+	sa.Release(5)
+	if slot, ok := sa.PeekLast(); !ok || slot != 5 {
+		t.Fatalf("expected slot 5 back, got %d (ok=%v)", slot, ok)
+	}
+}
+
+func lowest(slots map[int]bool) (int, bool) {
+	if len(slots) == 0 {
+		return 0, false
+	}
+	return slices.Min(slices.Collect(maps.Keys(slots))), true
+}
+
+func highest(slots map[int]bool) (int, bool) {
+	if len(slots) == 0 {
+		return 0, false
+	}
+	return slices.Max(slices.Collect(maps.Keys(slots))), true
+}
+
+func contains(slots []int, slot int) bool {
+	for _, s := range slots {
+		if s == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// fills the lot, then keeps freeing a random slot and parking into it again
+func benchmarkLeaveAndPark(b *testing.B, newAllocator func(capacity int) allocator) {
+	a := newAllocator(benchmarkCapacity)
+	for range benchmarkCapacity {
+		a.Allocate()
+	}
+	rnd := rand.New(rand.NewSource(1))
+
+	b.ResetTimer()
+	for range b.N {
+		a.Release(rnd.Intn(benchmarkCapacity) + 1)
+		a.Allocate()
+	}
+}
+
+// frees half of the lot, then parks into all of it again
+func benchmarkChurn(b *testing.B, newAllocator func(capacity int) allocator) {
+	a := newAllocator(benchmarkCapacity)
+	for range benchmarkCapacity {
+		a.Allocate()
+	}
+	rnd := rand.New(rand.NewSource(1))
+	slots := rnd.Perm(benchmarkCapacity)[:benchmarkCapacity/2]
+
+	b.ResetTimer()
+	for range b.N {
+		for _, slot := range slots {
+			a.Release(slot + 1)
+		}
+		for range slots {
+			a.Allocate()
+		}
+	}
+}
+
+func BenchmarkSliceAllocatorLeaveAndPark(b *testing.B) {
+	benchmarkLeaveAndPark(b, func(capacity int) allocator { return newSliceAllocator(capacity) })
+}
+
+func BenchmarkSlotAllocatorLeaveAndPark(b *testing.B) {
+	benchmarkLeaveAndPark(b, func(capacity int) allocator { return newSlotAllocator(1, capacity) })
+}
+
+func BenchmarkSliceAllocatorChurn(b *testing.B) {
+	benchmarkChurn(b, func(capacity int) allocator { return newSliceAllocator(capacity) })
+}
+
+func BenchmarkSlotAllocatorChurn(b *testing.B) {
+	benchmarkChurn(b, func(capacity int) allocator { return newSlotAllocator(1, capacity) })
+}
@@ -0,0 +1,346 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+type (
+	/*
+		LotSnapshot is the state of a parking lot, as saved to (and restored from) a state file.
+
+		It holds what the lot was created with (its slot groups, level order, allocation strategy and gates),
+		the slots retagged since, the parked vehicles, the pending reservations and the waitlist.
+		Sizes, vehicle types and attributes are stored by name, times in RFC 3339.
+		The settings of the lot service (registration format, colours, tariff, policies, clock) are not part of it,
+		a restored lot gets the ones in effect.
+	*/
+	LotSnapshot struct {
+		Groups     []GroupSnapshot `json:"groups"`
+		LevelOrder string          `json:"level_order"`
+		// Strategy is empty for a strategy which is not built in, the restored lot allocates the nearest slot then.
+		Strategy string `json:"strategy,omitempty"`
+		Seed     int64  `json:"seed,omitempty"`
+		// StrategyPosition is where the strategy is in its sequence: the values random has drawn, the level rank round-robin used last.
+		StrategyPosition *int64                `json:"strategy_position,omitempty"`
+		Gates            map[string][]int      `json:"gates,omitempty"`
+		Tags             map[int]string        `json:"tags,omitempty"` // attributes of the slots retagged since creation
+		Vehicles         []ParkedSnapshot      `json:"vehicles"`       // in the order they were parked
+		Reservations     []ReservationSnapshot `json:"reservations,omitempty"`
+		Waitlist         []VehicleSnapshot     `json:"waitlist,omitempty"` // head of the queue first
+	}
+
+	GroupSnapshot struct {
+		Level      int    `json:"level,omitempty"`
+		Size       string `json:"size"`
+		Count      int    `json:"count"`
+		Attributes string `json:"attributes,omitempty"`
+	}
+
+	// VehicleSnapshot is a vehicle as given to park, as it waits on the waitlist.
+	VehicleSnapshot struct {
+		RegistrationNo string `json:"registration_no"`
+		Color          string `json:"color"`
+		Type           string `json:"type"`
+		Needs          string `json:"needs,omitempty"`
+		Gate           string `json:"gate,omitempty"`
+	}
+
+	// ParkedSnapshot is a parked vehicle, its fields are inlined in JSON.
+	ParkedSnapshot struct {
+		Slot int `json:"slot"`
+		VehicleSnapshot
+		EntryTime time.Time `json:"entry_time"`
+		TicketID  string    `json:"ticket_id"`
+	}
+
+	ReservationSnapshot struct {
+		Slot           int       `json:"slot"`
+		RegistrationNo string    `json:"registration_no"`
+		Type           string    `json:"type"`
+		From           time.Time `json:"from"`
+		To             time.Time `json:"to"`
+		HoldsFrom      time.Time `json:"holds_from"` // zero in older snapshots, their slots are held right away
+		ExpiresAt      time.Time `json:"expires_at"`
+	}
+)
+
+// returns the state of the lot, consistent as of the call
+func (pl *ParkingLot) Snapshot() *LotSnapshot {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	snapshot := &LotSnapshot{
+		Groups:     make([]GroupSnapshot, 0, len(pl.segments)),
+		LevelOrder: pl.levelOrder.String(),
+		Vehicles:   make([]ParkedSnapshot, 0, len(pl.occupiedSlots)),
+	}
+	if strategy, ok := pl.allocationStrategy.(builtinStrategy); ok {
+		snapshot.Strategy, snapshot.Seed = strategy.nameAndSeed()
+		if position, ok := strategy.position(); ok {
+			snapshot.StrategyPosition = &position
+		}
+	}
+	for name, gt := range pl.gates {
+		if snapshot.Gates == nil {
+			snapshot.Gates = map[string][]int{}
+		}
+		snapshot.Gates[name] = append([]int(nil), gt.distances...)
+	}
+
+	for _, seg := range pl.segments {
+		snapshot.Groups = append(snapshot.Groups, GroupSnapshot{
+			Level:      seg.level,
+			Size:       seg.size.String(),
+			Count:      seg.last - seg.first + 1,
+			Attributes: attributeNames(seg.attributes),
+		})
+		for slot, attributes := range seg.retagged {
+			if snapshot.Tags == nil {
+				snapshot.Tags = map[int]string{}
+			}
+			snapshot.Tags[slot] = attributes.String()
+		}
+	}
+
+	for slot, vehicle := range pl.occupiedSlots {
+		snapshot.Vehicles = append(snapshot.Vehicles, ParkedSnapshot{
+			Slot:            slot,
+			VehicleSnapshot: vehicle.snapshot(),
+			EntryTime:       vehicle.entryTime,
+			TicketID:        vehicle.ticketID,
+		})
+	}
+	// tickets are issued in order, so they give the order the vehicles were parked in (and are indexed by colour)
+	sort.Slice(snapshot.Vehicles, func(i, j int) bool { return snapshot.Vehicles[i].TicketID < snapshot.Vehicles[j].TicketID })
+
+	// by slot, then by window
+	for _, slot := range slices.Sorted(maps.Keys(pl.slotReservations)) {
+		for _, reservation := range pl.slotReservations[slot] {
+			snapshot.Reservations = append(snapshot.Reservations, reservation.snapshot())
+		}
+	}
+
+	for _, vehicle := range pl.waitlist {
+		snapshot.Waitlist = append(snapshot.Waitlist, vehicle.snapshot())
+	}
+	return snapshot
+}
+
+/*
+Recreates a parking lot from its snapshot.
+
+The options are the settings of the lot service, as given to NewParkingLotWithLayout,
+the ones the lot was created with come from the snapshot.
+A snapshot which does not add up (a slot out of range or taken twice, a vehicle parked twice...) is refused.
+*/
+func RestoreParkingLot(snapshot *LotSnapshot, options ...Option) (*ParkingLot, error) {
+	layout, err := snapshot.layout()
+	if err != nil {
+		return nil, err
+	}
+	levelOrder, err := ParseLevelOrder(snapshot.LevelOrder)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	options = append(options, WithLevelOrder(levelOrder))
+	if snapshot.Strategy != "" {
+		strategy, err := NewAllocationStrategy(snapshot.Strategy, snapshot.Seed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		if snapshot.StrategyPosition != nil {
+			strategy.(builtinStrategy).seek(*snapshot.StrategyPosition)
+		}
+		options = append(options, WithAllocationStrategy(strategy))
+	}
+	if len(snapshot.Gates) > 0 {
+		gates := make([]Gate, 0, len(snapshot.Gates))
+		for name, distances := range snapshot.Gates {
+			gates = append(gates, Gate{Name: name, Distances: distances})
+		}
+		if err := ValidateGates(gates, layout.Capacity()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		options = append(options, WithGates(gates...))
+	}
+
+	// the state restored is not a change, it is recorded by whoever restores the lot
+	pl := NewParkingLotWithLayout(layout, options...)
+	eventLog := pl.eventLog
+	pl.eventLog = nil
+	if err := pl.restore(snapshot); err != nil {
+		return nil, err
+	}
+	pl.eventLog = eventLog
+	return pl, nil
+}
+
+func (snapshot *LotSnapshot) layout() (Layout, error) {
+	layout := make(Layout, 0, len(snapshot.Groups))
+	for _, group := range snapshot.Groups {
+		size, err := ParseSlotSize(group.Size)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		attributes, err := ParseSlotAttributes(group.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		layout = append(layout, SlotGroup{Level: group.Level, Size: size, Count: group.Count, Attributes: attributes})
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return layout, nil
+}
+
+// fills a new lot with the state of the snapshot, nobody else can see the lot yet
+func (pl *ParkingLot) restore(snapshot *LotSnapshot) error {
+	for slot, names := range snapshot.Tags {
+		seg, ok := findSegment(pl.segments, slot)
+		if !ok {
+			return fmt.Errorf("%w: tagged slot %d", ErrInvalidSnapshot, slot)
+		}
+		attributes, err := ParseSlotAttributes(names)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		pl.tagSlot(seg, slot, attributes)
+	}
+
+	// the slots are taken in ascending order, so the allocators only move their front
+	taken := map[int]bool{}
+	for _, vehicle := range snapshot.Vehicles {
+		if taken[vehicle.Slot] {
+			return fmt.Errorf("%w: slot %d taken twice", ErrInvalidSnapshot, vehicle.Slot)
+		}
+		taken[vehicle.Slot] = true
+	}
+	slots := make([]int, 0, len(taken))
+	for slot := range taken {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	for _, slot := range slots {
+		seg, ok := findSegment(pl.segments, slot)
+		if !ok {
+			return fmt.Errorf("%w: slot %d out of range", ErrInvalidSnapshot, slot)
+		}
+		seg.pool(seg.attributesOf(slot)).Take(slot)
+	}
+
+	for _, parked := range snapshot.Vehicles {
+		vehicle, err := pl.restoreVehicle(parked.VehicleSnapshot)
+		if err != nil {
+			return err
+		}
+		if _, exists := pl.vehicleToSlotMap[vehicle.registrationNumber]; exists {
+			return fmt.Errorf("%w: vehicle %s parked twice", ErrInvalidSnapshot, vehicle.registrationNumber)
+		}
+		if seg, _ := findSegment(pl.segments, parked.Slot); vehicle.vehicleType.SlotSize() > seg.size {
+			return fmt.Errorf("%w: a %s at %s slot %d", ErrInvalidSnapshot, vehicle.vehicleType, seg.size, parked.Slot)
+		}
+		vehicle.entryTime, vehicle.ticketID = parked.EntryTime, parked.TicketID
+		pl.index(vehicle, parked.Slot)
+	}
+
+	for _, reservationSnapshot := range snapshot.Reservations {
+		reservation, err := restoreReservation(reservationSnapshot)
+		if err != nil {
+			return err
+		}
+		if _, exists := pl.reservations[reservation.RegistrationNo]; exists {
+			return fmt.Errorf("%w: vehicle %s reserved twice", ErrInvalidSnapshot, reservation.RegistrationNo)
+		}
+		if _, ok := findSegment(pl.segments, reservation.Slot); !ok {
+			return fmt.Errorf("%w: reserved slot %d out of range", ErrInvalidSnapshot, reservation.Slot)
+		}
+		if pl.overlapsReservation(reservation.Slot, reservation) {
+			return fmt.Errorf("%w: slot %d reserved for overlapping windows", ErrInvalidSnapshot, reservation.Slot)
+		}
+		// the slots are held the next time the lot syncs its reservations
+		pl.addReservation(reservation)
+	}
+
+	for _, vehicleSnapshot := range snapshot.Waitlist {
+		vehicle, err := pl.restoreVehicle(vehicleSnapshot)
+		if err != nil {
+			return err
+		}
+		pl.waitlist = append(pl.waitlist, vehicle)
+	}
+	return nil
+}
+
+func (pl *ParkingLot) restoreVehicle(snapshot VehicleSnapshot) (*Vehicle, error) {
+	vehicleType, err := ParseVehicleType(snapshot.Type)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	needs, err := ParseSlotAttributes(snapshot.Needs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	colorKey, err := pl.colorCanonicalizer.Canonicalize(snapshot.Color)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	vehicle := NewVehicleNeeding(snapshot.RegistrationNo, snapshot.Color, vehicleType, needs)
+	vehicle.colorKey, vehicle.gate = colorKey, snapshot.Gate
+	return vehicle, nil
+}
+
+func restoreReservation(snapshot ReservationSnapshot) (*Reservation, error) {
+	vehicleType, err := ParseVehicleType(snapshot.Type)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return &Reservation{
+		RegistrationNo: snapshot.RegistrationNo,
+		VehicleType:    vehicleType,
+		Slot:           snapshot.Slot,
+		From:           snapshot.From,
+		To:             snapshot.To,
+		HoldsFrom:      snapshot.HoldsFrom,
+		ExpiresAt:      snapshot.ExpiresAt,
+	}, nil
+}
+
+func (reservation *Reservation) snapshot() ReservationSnapshot {
+	return ReservationSnapshot{
+		Slot:           reservation.Slot,
+		RegistrationNo: reservation.RegistrationNo,
+		Type:           reservation.VehicleType.String(),
+		From:           reservation.From,
+		To:             reservation.To,
+		HoldsFrom:      reservation.HoldsFrom,
+		ExpiresAt:      reservation.ExpiresAt,
+	}
+}
+
+func (vehicle *Vehicle) snapshot() VehicleSnapshot {
+	return VehicleSnapshot{
+		RegistrationNo: vehicle.registrationNumber,
+		Color:          vehicle.color,
+		Type:           vehicle.vehicleType.String(),
+		Needs:          attributeNames(vehicle.needs),
+		Gate:           vehicle.gate,
+	}
+}
+
+// the names of the attributes, empty rather than "none" for no attribute
+func attributeNames(attributes SlotAttributes) string {
+	if attributes == 0 {
+		return ""
+	}
+	return attributes.String()
+}
@@ -0,0 +1,213 @@
+package parkingmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// a lot using most of what a snapshot holds
+func newSnapshotTestLot(t *testing.T, clock Clock, options ...Option) *ParkingLot {
+	t.Helper()
+	strategy, _ := NewAllocationStrategy(AllocationFarthest, 0)
+	layout := Layout{
+		{Level: 1, Size: SlotSizeSmall, Count: 2},
+		{Level: 1, Size: SlotSizeMedium, Count: 3, Attributes: SlotAttributeEV},
+		{Level: 2, Size: SlotSizeMedium, Count: 4},
+	}
+	options = append([]Option{
+		WithClock(clock),
+		WithWaitlist(),
+		WithSpecialSlotPolicy(SpecialSlotsLastResort),
+		WithLevelOrder(LevelOrderHighestFirst),
+		WithAllocationStrategy(strategy),
+		WithGates(Gate{Name: "G1", Distances: []int{9, 8, 7, 6, 5, 4, 3, 2, 1}}),
+	}, options...)
+	parkingLot := NewParkingLotWithLayout(layout, options...)
+	if err := parkingLot.TagSlot(6, SlotAttributeAccessible); err != nil {
+		t.Fatal(err)
+	}
+	return parkingLot
+}
+
+func snapshotJSON(t *testing.T, parkingLot *ParkingLot) string {
+	t.Helper()
+	content, err := json.Marshal(parkingLot.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	original := newSnapshotTestLot(t, clock)
+
+	vehicles := []*Vehicle{
+		NewVehicle("KA-01-HH-0001", "White"),
+		NewVehicleOfType("KA-01-HH-0002", "Red", VehicleTypeMotorcycle),
+		NewVehicle("KA-01-HH-0003", "white"),
+		NewVehicleNeeding("KA-01-HH-0004", "Blue", VehicleTypeCar, SlotAttributeEV),
+		NewVehicle("KA-01-HH-0005", "White"),
+	}
+	slots := make([]int, len(vehicles))
+	for i, vehicle := range vehicles {
+		var err error
+		if slots[i], err = original.Park(vehicle); err != nil {
+			t.Fatal(err)
+		}
+		clock.now = clock.now.Add(time.Minute)
+	}
+	if _, err := original.ParkFromGate(NewVehicle("KA-01-HH-0006", "Gray"), "G1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := original.Leave(slots[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := original.Reserve("KA-01-HH-0007", VehicleTypeCar, clock.now, clock.now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for _, vehicle := range []*Vehicle{
+		NewVehicle("KA-01-HH-0008", "Black"),
+		NewVehicle("KA-01-HH-0009", "Black"),
+		NewVehicleOfType("KA-01-HH-0010", "Black", VehicleTypeMotorcycle),
+	} {
+		if _, err := original.Park(vehicle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var waitlisted *WaitlistedError
+	if _, err := original.Park(NewVehicleNeeding("KA-01-HH-0099", "Green", VehicleTypeCar, SlotAttributeEV)); !errors.As(err, &waitlisted) {
+		t.Fatalf("expected the vehicle to be waitlisted, got %v", err)
+	}
+
+	content := snapshotJSON(t, original)
+	var snapshot LotSnapshot
+	if err := json.Unmarshal([]byte(content), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	issuer := NewTicketIssuer()
+	if err := issuer.ResumeAfter(snapshot.Vehicles[len(snapshot.Vehicles)-1].TicketID); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := RestoreParkingLot(&snapshot, WithClock(clock), WithTicketIssuer(issuer), WithWaitlist(), WithSpecialSlotPolicy(SpecialSlotsLastResort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := snapshotJSON(t, restored); got != content {
+		t.Fatalf("snapshots differ after a round trip:\n%s\n%s", content, got)
+	}
+
+	// the indexes are rebuilt, the colour index in the order of parking
+	for _, parkingLot := range []*ParkingLot{original, restored} {
+		white, _ := parkingLot.GetVehiclesByColor("WHITE")
+		if len(white) != 2 || white[0].GetRegistrationNo() != "KA-01-HH-0001" || white[1].GetRegistrationNo() != "KA-01-HH-0005" {
+			t.Fatalf("expected the white vehicles in the order they were parked, got %v", white)
+		}
+	}
+	vehicle, slot, ok := restored.GetVehicleByTicket(vehicles[3].GetTicketID())
+	if !ok || vehicle.GetRegistrationNo() != "KA-01-HH-0004" || !vehicle.GetEntryTime().Equal(vehicles[3].GetEntryTime()) {
+		t.Fatalf("expected the ticket of KA-01-HH-0004, got %v at %d (%v)", vehicle, slot, ok)
+	}
+
+	// both lots go on the same way
+	for _, step := range []func(parkingLot *ParkingLot) (int, error){
+		func(parkingLot *ParkingLot) (int, error) { _, err := parkingLot.Leave(3); return 0, err },
+		func(parkingLot *ParkingLot) (int, error) { return len(parkingLot.AdmitWaitlisted()), nil },
+		func(parkingLot *ParkingLot) (int, error) { _, err := parkingLot.Leave(4); return 0, err },
+		func(parkingLot *ParkingLot) (int, error) { return len(parkingLot.AdmitWaitlisted()), nil },
+		func(parkingLot *ParkingLot) (int, error) { _, err := parkingLot.Leave(7); return 0, err },
+		func(parkingLot *ParkingLot) (int, error) { _, err := parkingLot.Leave(8); return 0, err },
+		func(parkingLot *ParkingLot) (int, error) {
+			return parkingLot.ParkFromGate(NewVehicle("KA-01-HH-0100", "White"), "G1")
+		},
+		func(parkingLot *ParkingLot) (int, error) {
+			return parkingLot.Park(NewVehicle("KA-01-HH-0007", "White"))
+		},
+		func(parkingLot *ParkingLot) (int, error) {
+			return parkingLot.Park(NewVehicle("KA-01-HH-0101", "White"))
+		},
+	} {
+		want, wantErr := step(original)
+		got, gotErr := step(restored)
+		if got != want || fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+			t.Fatalf("restored lot diverged: got %d (%v), expected %d (%v)", got, gotErr, want, wantErr)
+		}
+	}
+	if got, want := snapshotJSON(t, restored), snapshotJSON(t, original); got != want {
+		t.Fatalf("lots diverged:\n%s\n%s", want, got)
+	}
+}
+
+func TestSnapshotKeepsStrategyPosition(t *testing.T) {
+	for _, name := range []string{AllocationRandom, AllocationRoundRobin} {
+		strategy, _ := NewAllocationStrategy(name, 7)
+		original := NewParkingLotWithLayout(Layout{
+			{Level: 1, Size: SlotSizeMedium, Count: 4},
+			{Level: 2, Size: SlotSizeMedium, Count: 4},
+			{Level: 3, Size: SlotSizeMedium, Count: 4},
+		}, WithAllocationStrategy(strategy))
+		parkCars(t, original, 4)
+
+		restored, err := RestoreParkingLot(original.Snapshot())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := parkCars(t, original, 6), parkCars(t, restored, 6); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: expected the restored lot to go on with %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestRestoreRefusesInconsistentSnapshots(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(3, WithClock(clock))
+	for _, registrationNo := range []string{"KA-01-HH-0001", "KA-01-HH-0002"} {
+		if _, err := parkingLot.Park(NewVehicle(registrationNo, "White")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, corrupt := range map[string]func(snapshot *LotSnapshot){
+		"slot taken twice":    func(snapshot *LotSnapshot) { snapshot.Vehicles[1].Slot = 1 },
+		"slot out of range":   func(snapshot *LotSnapshot) { snapshot.Vehicles[1].Slot = 4 },
+		"vehicle twice":       func(snapshot *LotSnapshot) { snapshot.Vehicles[1].RegistrationNo = "KA-01-HH-0001" },
+		"unknown size":        func(snapshot *LotSnapshot) { snapshot.Groups[0].Size = "huge" },
+		"unknown type":        func(snapshot *LotSnapshot) { snapshot.Vehicles[0].Type = "tractor" },
+		"vehicle too big":     func(snapshot *LotSnapshot) { snapshot.Vehicles[0].Type = "bus" },
+		"unknown level order": func(snapshot *LotSnapshot) { snapshot.LevelOrder = "sideways" },
+	} {
+		snapshot := parkingLot.Snapshot()
+		corrupt(snapshot)
+		if _, err := RestoreParkingLot(snapshot); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidSnapshot, err)
+		}
+	}
+}
+
+func TestTicketIssuerResumesAfterLastTicket(t *testing.T) {
+	at := time.Date(2024, 11, 1, 9, 0, 0, 0, time.UTC)
+	issuer := NewTicketIssuer()
+	if last := issuer.LastIssued(); last != "" {
+		t.Fatalf("expected no ticket, got %s", last)
+	}
+	if err := issuer.ResumeAfter("T20241101090000-0041"); err != nil {
+		t.Fatal(err)
+	}
+	if ticket := issuer.Issue(at); ticket != "T20241101090000-0042" {
+		t.Fatalf("expected T20241101090000-0042, got %s", ticket)
+	}
+
+	// never back to tickets issued already
+	if err := issuer.ResumeAfter("T20241101085959-0007"); err != nil {
+		t.Fatal(err)
+	}
+	if last := issuer.LastIssued(); last != "T20241101090000-0042" {
+		t.Fatalf("expected T20241101090000-0042, got %s", last)
+	}
+	if err := issuer.ResumeAfter("20241101-1"); !errors.Is(err, ErrInvalidTicket) {
+		t.Fatalf("expected %v, got %v", ErrInvalidTicket, err)
+	}
+}
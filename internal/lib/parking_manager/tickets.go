@@ -0,0 +1,128 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ticketStampLayout = "20060102150405"
+	maxTicketSequence = 9999
+)
+
+var (
+	ErrUnknownTicket = errors.New("unknown ticket")
+	ErrInvalidTicket = errors.New("invalid ticket")
+)
+
+type (
+	/*
+		TicketIssuer hands out the ticket IDs of the parked vehicles, e.g. T20241101090000-0001.
+
+		An ID is the entry time to the second followed by a sequence number within that second,
+		so IDs sort in the order they were issued and never repeat, even if the clock goes back.
+		One issuer can be shared by several lots to keep their tickets apart.
+	*/
+	TicketIssuer struct {
+		mu       sync.Mutex
+		stamp    time.Time
+		sequence int
+	}
+)
+
+func NewTicketIssuer() *TicketIssuer {
+	return &TicketIssuer{}
+}
+
+func (issuer *TicketIssuer) Issue(at time.Time) string {
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+
+	at = at.UTC().Truncate(time.Second)
+	switch {
+	case at.After(issuer.stamp):
+		issuer.stamp, issuer.sequence = at, 1
+	case issuer.sequence < maxTicketSequence:
+		issuer.sequence++
+	default:
+		// the second is used up, borrow the next one
+		issuer.stamp, issuer.sequence = issuer.stamp.Add(time.Second), 1
+	}
+	return fmt.Sprintf("T%s-%04d", issuer.stamp.Format(ticketStampLayout), issuer.sequence)
+}
+
+// the last ticket issued, empty when none was
+func (issuer *TicketIssuer) LastIssued() string {
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+
+	if issuer.sequence == 0 {
+		return ""
+	}
+	return fmt.Sprintf("T%s-%04d", issuer.stamp.Format(ticketStampLayout), issuer.sequence)
+}
+
+// carries on after the given ticket, e.g. from a restored state, unless the issuer is past it already
+func (issuer *TicketIssuer) ResumeAfter(ticketID string) error {
+	if ticketID == "" {
+		return nil
+	}
+	stampPart, sequencePart, ok := strings.Cut(strings.TrimPrefix(ticketID, "T"), "-")
+	stamp, err := time.Parse(ticketStampLayout, stampPart)
+	if !ok || err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTicket, ticketID)
+	}
+	sequence, err := strconv.Atoi(sequencePart)
+	if err != nil || sequence < 1 || sequence > maxTicketSequence {
+		return fmt.Errorf("%w: %s", ErrInvalidTicket, ticketID)
+	}
+
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+
+	if stamp.After(issuer.stamp) || stamp.Equal(issuer.stamp) && sequence > issuer.sequence {
+		issuer.stamp, issuer.sequence = stamp, sequence
+	}
+	return nil
+}
+
+// Issues the tickets of the lot with the given issuer, every lot has its own issuer by default.
+func WithTicketIssuer(issuer *TicketIssuer) Option {
+	return func(pl *ParkingLot) {
+		pl.ticketIssuer = issuer
+	}
+}
+
+func (vehicle *Vehicle) GetTicketID() string {
+	return vehicle.ticketID
+}
+
+// returns a copy of the vehicle holding the ticket along with its slot
+func (pl *ParkingLot) GetVehicleByTicket(ticketID string) (Vehicle, int, bool) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	slot, ok := pl.ticketToSlotMap[ticketID]
+	if !ok {
+		return Vehicle{}, -1, false
+	}
+	return *pl.occupiedSlots[slot], slot, true
+}
+
+// frees the slot of the vehicle holding the ticket, atomically like Leave
+func (pl *ParkingLot) LeaveByTicket(ticketID string) (*Vehicle, int, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	defer pl.serveWaitlist()
+
+	slot, ok := pl.ticketToSlotMap[ticketID]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", ErrUnknownTicket, ticketID)
+	}
+	vehicle, err := pl.leave(slot)
+	return vehicle, slot, err
+}
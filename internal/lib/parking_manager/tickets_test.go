@@ -0,0 +1,64 @@
+package parkingmanager
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTicketIssuerIsSortableAndUnique(t *testing.T) {
+	issuer := NewTicketIssuer()
+	morning := time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)
+
+	tickets := []string{
+		issuer.Issue(morning),
+		issuer.Issue(morning.Add(500 * time.Millisecond)),
+		issuer.Issue(morning.Add(time.Minute)),
+		issuer.Issue(morning.Add(-time.Hour)), // the clock went back
+	}
+	expected := []string{"T20241101090000-0001", "T20241101090000-0002", "T20241101090100-0001", "T20241101090100-0002"}
+	for i := range expected {
+		if tickets[i] != expected[i] {
+			t.Errorf("ticket %d: expected %s, got %s", i, expected[i], tickets[i])
+		}
+	}
+
+	seen := map[string]bool{}
+	for range maxTicketSequence + 10 {
+		ticket := issuer.Issue(morning)
+		if seen[ticket] {
+			t.Fatalf("ticket %s issued twice", ticket)
+		}
+		seen[ticket] = true
+		tickets = append(tickets, ticket)
+	}
+	if !sort.StringsAreSorted(tickets) {
+		t.Error("tickets are not sorted in the order they were issued")
+	}
+}
+
+func TestParkingLotLeaveByTicket(t *testing.T) {
+	parkingLot := NewParkingLot(2)
+	vehicle := NewVehicle("KA-01-HH-1234", "White")
+	slot, err := parkingLot.Park(vehicle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parked, ticketSlot, ok := parkingLot.GetVehicleByTicket(vehicle.GetTicketID())
+	if !ok || ticketSlot != slot || parked.GetRegistrationNo() != "KA-01-HH-1234" {
+		t.Fatalf("expected the ticket to find the vehicle at slot %d, got %d (%v)", slot, ticketSlot, ok)
+	}
+
+	left, leftSlot, err := parkingLot.LeaveByTicket(vehicle.GetTicketID())
+	if err != nil || leftSlot != slot || left.GetRegistrationNo() != "KA-01-HH-1234" {
+		t.Fatalf("expected the vehicle to leave slot %d, got %d (%v)", slot, leftSlot, err)
+	}
+	if _, _, err := parkingLot.LeaveByTicket(vehicle.GetTicketID()); !errors.Is(err, ErrUnknownTicket) {
+		t.Errorf("expected %v, got %v", ErrUnknownTicket, err)
+	}
+	if _, ok := parkingLot.GetSlotByRegistrationNo("KA-01-HH-1234"); ok {
+		t.Error("leave by ticket must drop the registration number")
+	}
+}
@@ -0,0 +1,138 @@
+package parkingmanager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrWaitlisted           = errors.New("vehicle is waitlisted")
+	ErrVehicleNotWaitlisted = errors.New("vehicle is not waitlisted")
+)
+
+type (
+	// WaitlistedError is returned by Park when the lot is full and the vehicle has been queued instead.
+	WaitlistedError struct {
+		RegistrationNo string
+		Position       int // from 1
+	}
+
+	// Admission is a waitlisted vehicle which got a slot.
+	Admission struct {
+		Vehicle Vehicle
+		Slot    int
+	}
+)
+
+/*
+Queues the vehicles which find the lot full, first come first served.
+
+The queued vehicles are parked by AdmitWaitlisted once slots are freed.
+*/
+func WithWaitlist() Option {
+	return func(pl *ParkingLot) {
+		pl.waitlistEnabled = true
+	}
+}
+
+func (err *WaitlistedError) Error() string {
+	return fmt.Sprintf("vehicle %s is waitlisted at position %d", err.RegistrationNo, err.Position)
+}
+func (err *WaitlistedError) Unwrap() error {
+	return ErrWaitlisted
+}
+
+/*
+Parks the waitlisted vehicles the free slots can take, in the order they were queued,
+and returns them with the ones served since the last call.
+
+The lot serves the queue itself whenever a change gives a slot back (a leave, an expired or released reservation,
+a slot tagged), so a vehicle parked after them never takes their slot. Callers report the admissions from here.
+*/
+func (pl *ParkingLot) AdmitWaitlisted() []Admission {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	admissions := append(pl.admitted, pl.admitWaitlisted()...)
+	pl.admitted, pl.slotsFreed = nil, false
+	return admissions
+}
+
+// serves the waitlist once a slot went back to a pool, the caller holds the lock. Undo and redo put back lots which were served already.
+func (pl *ParkingLot) serveWaitlist() {
+	if !pl.slotsFreed {
+		return
+	}
+	pl.slotsFreed = false
+	if len(pl.waitlist) > 0 {
+		pl.admitted = append(pl.admitted, pl.admitWaitlisted()...)
+	}
+}
+
+// see AdmitWaitlisted, the caller holds the lock. The slots due for a reservation are held before the queue is served.
+func (pl *ParkingLot) admitWaitlisted() []Admission {
+	if len(pl.waitlist) > 0 && pl.reservationExpiry.Len() > 0 {
+		pl.syncReservations(pl.clock.Now())
+	}
+	admissions := make([]Admission, 0)
+	waiting := pl.waitlist[:0]
+	for i, vehicle := range pl.waitlist {
+		slot, err := pl.allocate(vehicle.vehicleType, vehicle.needs, vehicle.gate)
+		if errors.Is(err, ErrParkingLotFull) {
+			waiting = append(waiting, pl.waitlist[i:]...)
+			break
+		}
+		if err != nil {
+			waiting = append(waiting, vehicle)
+			continue
+		}
+		// the position it was admitted from, an undo queues it there again
+		event := pl.stamp(vehicle, slot)
+		event.Position = len(waiting) + 1
+		pl.recordAllocation(event)
+		admissions = append(admissions, Admission{Vehicle: *vehicle, Slot: slot})
+	}
+	clear(pl.waitlist[len(waiting):])
+	pl.waitlist = waiting
+	return admissions
+}
+
+// returns copies of the waitlisted vehicles, head of the queue first
+func (pl *ParkingLot) GetWaitlist() []Vehicle {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+
+	waitlist := make([]Vehicle, 0, len(pl.waitlist))
+	for _, vehicle := range pl.waitlist {
+		waitlist = append(waitlist, *vehicle)
+	}
+	return waitlist
+}
+
+// takes the vehicle off the waitlist, the vehicles behind it move up
+func (pl *ParkingLot) CancelWaitlist(registrationNo string) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	registrationNo = pl.normalizeRegistrationNo(registrationNo)
+	position := pl.waitlistPosition(registrationNo)
+	if position == 0 {
+		return fmt.Errorf("%w: %s", ErrVehicleNotWaitlisted, registrationNo)
+	}
+	event := pl.waitlist[position-1].event(EventWaitlistCancelled, 0)
+	event.Position = position
+	pl.record(event)
+	pl.waitlist = slices.Delete(pl.waitlist, position-1, position)
+	return nil
+}
+
+// the position of the vehicle in the waitlist from 1, 0 when it is not waitlisted
+func (pl *ParkingLot) waitlistPosition(registrationNo string) int {
+	for i, vehicle := range pl.waitlist {
+		if vehicle.registrationNumber == registrationNo {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package parkingmanager
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParkingLotWaitlistIsServedInOrder(t *testing.T) {
+	parkingLot := NewParkingLotWithLayout(Layout{{Size: SlotSizeMedium, Count: 1}, {Size: SlotSizeXLarge, Count: 1}}, WithWaitlist())
+	for _, vehicle := range []*Vehicle{NewVehicle("KA-01-HH-0001", "White"), NewVehicleOfType("KA-01-HH-0002", "White", VehicleTypeBus)} {
+		if _, err := parkingLot.Park(vehicle); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queued := []*Vehicle{
+		NewVehicleOfType("KA-01-HH-0003", "Red", VehicleTypeBus),
+		NewVehicle("KA-01-HH-0004", "Red"),
+		NewVehicle("KA-01-HH-0005", "Red"),
+	}
+	for i, vehicle := range queued {
+		_, err := parkingLot.Park(vehicle)
+		var waitlisted *WaitlistedError
+		if !errors.As(err, &waitlisted) || waitlisted.Position != i+1 {
+			t.Fatalf("expected %s to be waitlisted at position %d, got %v", vehicle.GetRegistrationNo(), i+1, err)
+		}
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0004", "Red")); !errors.Is(err, ErrWaitlisted) {
+		t.Errorf("a waitlisted vehicle must keep its position, got %v", err)
+	}
+
+	// the bus at the head does not fit the freed car slot, the car behind it gets the slot
+	if _, err := parkingLot.Leave(1); err != nil {
+		t.Fatal(err)
+	}
+	admissions := parkingLot.AdmitWaitlisted()
+	if len(admissions) != 1 || admissions[0].Slot != 1 || admissions[0].Vehicle.GetRegistrationNo() != "KA-01-HH-0004" {
+		t.Fatalf("expected KA-01-HH-0004 to be admitted at slot 1, got %v", admissions)
+	}
+
+	if err := parkingLot.CancelWaitlist("KA-01-HH-0005"); err != nil {
+		t.Fatal(err)
+	}
+	if err := parkingLot.CancelWaitlist("KA-01-HH-0005"); !errors.Is(err, ErrVehicleNotWaitlisted) {
+		t.Errorf("expected %v, got %v", ErrVehicleNotWaitlisted, err)
+	}
+
+	if _, err := parkingLot.Leave(2); err != nil {
+		t.Fatal(err)
+	}
+	admissions = parkingLot.AdmitWaitlisted()
+	if len(admissions) != 1 || admissions[0].Slot != 2 || admissions[0].Vehicle.GetRegistrationNo() != "KA-01-HH-0003" {
+		t.Fatalf("expected KA-01-HH-0003 to be admitted at slot 2, got %v", admissions)
+	}
+	if waitlist := parkingLot.GetWaitlist(); len(waitlist) != 0 {
+		t.Errorf("expected an empty waitlist, got %v", waitlist)
+	}
+}
+
+func TestParkingLotWithoutWaitlistTurnsVehiclesAway(t *testing.T) {
+	parkingLot := NewParkingLot(1)
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0001", "White")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0002", "White")); err != ErrParkingLotFull {
+		t.Errorf("expected %v, got %v", ErrParkingLotFull, err)
+	}
+	if waitlist := parkingLot.GetWaitlist(); len(waitlist) != 0 {
+		t.Errorf("expected an empty waitlist, got %v", waitlist)
+	}
+}
+
+func TestParkingLotWaitlistIsServedBeforeLaterVehicles(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)}
+	parkingLot := NewParkingLot(1, WithClock(clock), WithWaitlist(), WithReservationGrace(10*time.Minute))
+	if _, err := parkingLot.Reserve("KA-01-HH-1234", VehicleTypeCar, clock.now, clock.now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parkingLot.Park(NewVehicle("KA-01-HH-0001", "White")); !errors.Is(err, ErrWaitlisted) {
+		t.Fatalf("expected %v, got %v", ErrWaitlisted, err)
+	}
+
+	// the no-show's slot goes to the waitlisted vehicle, not to the one parking as it expires
+	clock.now = clock.now.Add(10 * time.Minute)
+	_, err := parkingLot.Park(NewVehicle("KA-01-HH-0002", "White"))
+	var waitlisted *WaitlistedError
+	if !errors.As(err, &waitlisted) || waitlisted.Position != 1 {
+		t.Fatalf("expected KA-01-HH-0002 to be waitlisted at position 1, got %v", err)
+	}
+	admissions := parkingLot.AdmitWaitlisted()
+	if len(admissions) != 1 || admissions[0].Slot != 1 || admissions[0].Vehicle.GetRegistrationNo() != "KA-01-HH-0001" {
+		t.Fatalf("expected KA-01-HH-0001 to be admitted at slot 1, got %v", admissions)
+	}
+	if admissions := parkingLot.AdmitWaitlisted(); len(admissions) != 0 {
+		t.Errorf("admissions are returned once, got %v", admissions)
+	}
+}
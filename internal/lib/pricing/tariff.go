@@ -0,0 +1,157 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+const DefaultRateName = "default"
+
+var (
+	ErrInvalidTariff = errors.New("invalid tariff")
+)
+
+type (
+	/*
+		Tariff prices the time a vehicle spends in the lot.
+
+		The first (started) hour costs a flat amount, every further started hour costs the hourly amount,
+		or the night hourly amount when the hour starts within the night window.
+		Each 24 hours from the entry are capped at the daily cap.
+		Rates are per vehicle type, a type without its own rate pays the default one.
+	*/
+	Tariff struct {
+		Night Night           `json:"night"`
+		Rates map[string]Rate `json:"rates"`
+	}
+
+	Rate struct {
+		FirstHour   float64 `json:"first_hour"`
+		Hourly      float64 `json:"hourly"`
+		NightHourly float64 `json:"night_hourly"` // 0 charges the hourly amount at night too
+		DailyCap    float64 `json:"daily_cap"`    // 0 means no cap
+	}
+
+	// Night is the window night rates apply in, as HH:MM, it may wrap around midnight e.g. 22:00 to 06:00.
+	Night struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}
+)
+
+func DefaultTariff() *Tariff {
+	return &Tariff{
+		Night: Night{Start: "22:00", End: "06:00"},
+		Rates: map[string]Rate{
+			DefaultRateName: {FirstHour: 20, Hourly: 10, NightHourly: 5, DailyCap: 150},
+			"motorcycle":    {FirstHour: 10, Hourly: 5, NightHourly: 2, DailyCap: 60},
+			"van":           {FirstHour: 30, Hourly: 15, NightHourly: 8, DailyCap: 220},
+			"bus":           {FirstHour: 50, Hourly: 25, NightHourly: 12, DailyCap: 400},
+		},
+	}
+}
+
+// reads a tariff from a JSON file, see DefaultTariff for the shape of it
+func LoadTariff(fileName string) (*Tariff, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tariff: %v", err)
+	}
+
+	tariff := &Tariff{}
+	if err := json.Unmarshal(content, tariff); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTariff, err)
+	}
+	return tariff, tariff.Validate()
+}
+
+func (tariff *Tariff) Validate() error {
+	if _, ok := tariff.Rates[DefaultRateName]; !ok {
+		return fmt.Errorf("%w: missing the %q rate", ErrInvalidTariff, DefaultRateName)
+	}
+	for name, rate := range tariff.Rates {
+		if rate.FirstHour < 0 || rate.Hourly < 0 || rate.NightHourly < 0 || rate.DailyCap < 0 {
+			return fmt.Errorf("%w: negative amount in the %q rate", ErrInvalidTariff, name)
+		}
+	}
+	if _, _, err := tariff.Night.minutes(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// the rate of the vehicle type, the default one when the type has none
+func (tariff *Tariff) Rate(vehicleType string) Rate {
+	if rate, ok := tariff.Rates[strings.ToLower(vehicleType)]; ok {
+		return rate
+	}
+	return tariff.Rates[DefaultRateName]
+}
+
+// the fee for a vehicle of the type which entered at entry and leaves at exit
+func (tariff *Tariff) Fee(vehicleType string, entry, exit time.Time) float64 {
+	rate := tariff.Rate(vehicleType)
+	nightStart, nightEnd, _ := tariff.Night.minutes()
+
+	hours := int(math.Ceil(exit.Sub(entry).Hours()))
+	if hours < 1 {
+		hours = 1
+	}
+
+	fee, dayFee := 0.0, 0.0
+	for hour := range hours {
+		// a new 24 hours period starts, settle the previous one
+		if hour > 0 && hour%24 == 0 {
+			fee += capped(dayFee, rate.DailyCap)
+			dayFee = 0
+		}
+
+		start := entry.Add(time.Duration(hour) * time.Hour)
+		switch {
+		case hour == 0:
+			dayFee += rate.FirstHour
+		case rate.NightHourly > 0 && isNight(start, nightStart, nightEnd):
+			dayFee += rate.NightHourly
+		default:
+			dayFee += rate.Hourly
+		}
+	}
+	fee += capped(dayFee, rate.DailyCap)
+	return math.Round(fee*100) / 100
+}
+
+// start and end of the window as minutes into the day
+func (night Night) minutes() (int, int, error) {
+	if night.Start == "" && night.End == "" {
+		return 0, 0, nil
+	}
+	start, err := time.Parse("15:04", night.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: night start %q", ErrInvalidTariff, night.Start)
+	}
+	end, err := time.Parse("15:04", night.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: night end %q", ErrInvalidTariff, night.End)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+func isNight(t time.Time, start, end int) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func capped(amount, limit float64) float64 {
+	if limit > 0 && amount > limit {
+		return limit
+	}
+	return amount
+}
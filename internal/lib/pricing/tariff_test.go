@@ -0,0 +1,70 @@
+package pricing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTariffFee(t *testing.T) {
+	tariff := DefaultTariff()
+	morning := time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		vehicleType string
+		entry       time.Time
+		parkedFor   time.Duration
+		fee         float64
+	}{
+		{"no time at all pays the first hour", "car", morning, 0, 20},
+		{"first hour is flat", "car", morning, 59 * time.Minute, 20},
+		{"every started hour after the first", "car", morning, 61 * time.Minute, 30},
+		{"three and a half hours", "car", morning, 3*time.Hour + 30*time.Minute, 50},
+		{"types without a rate pay the default one", "truck", morning, 2 * time.Hour, 30},
+		{"per vehicle type rates", "motorcycle", morning, 2 * time.Hour, 15},
+		{"hours starting at night pay the night rate", "car", time.Date(2024, time.November, 1, 21, 0, 0, 0, time.UTC), 4 * time.Hour, 20 + 5 + 5 + 5},
+		{"night wraps around midnight", "car", time.Date(2024, time.November, 1, 4, 0, 0, 0, time.UTC), 4 * time.Hour, 20 + 5 + 10 + 10},
+		{"a day is capped", "car", morning, 23 * time.Hour, 150},
+		// the first 24 hours pay the cap of 150, the 25th starts the next day at the hourly rate of 10
+		{"every day is capped on its own", "car", morning, 25 * time.Hour, 160},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fee := tariff.Fee(tt.vehicleType, tt.entry, tt.entry.Add(tt.parkedFor)); fee != tt.fee {
+				t.Errorf("expected %.2f, got %.2f", tt.fee, fee)
+			}
+		})
+	}
+}
+
+func TestLoadTariff(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	os.WriteFile(valid, []byte(`{"rates": {"default": {"first_hour": 5, "hourly": 2}}}`), 0o644)
+	tariff, err := LoadTariff(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	morning := time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC)
+	if fee := tariff.Fee("car", morning, morning.Add(3*time.Hour)); fee != 9 {
+		t.Errorf("expected 9.00, got %.2f", fee)
+	}
+
+	for name, content := range map[string]string{
+		"no_default.json": `{"rates": {"car": {"first_hour": 5}}}`,
+		"negative.json":   `{"rates": {"default": {"first_hour": -5}}}`,
+		"night.json":      `{"night": {"start": "10pm", "end": "06:00"}, "rates": {"default": {}}}`,
+		"broken.json":     `{"rates": `,
+	} {
+		fileName := filepath.Join(dir, name)
+		os.WriteFile(fileName, []byte(content), 0o644)
+		if _, err := LoadTariff(fileName); !errors.Is(err, ErrInvalidTariff) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidTariff, err)
+		}
+	}
+}
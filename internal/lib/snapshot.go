@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+)
+
+// SnapshotVersion is the version of the snapshot format written, bumped on any incompatible change.
+const SnapshotVersion = 1
+
+var (
+	ErrUnsupportedSnapshot = errors.New("unsupported snapshot version")
+)
+
+type (
+	/*
+		sessionSnapshot is the content of a snapshot file, the state of every lot of a lot service.
+
+		{
+		  "version": 1,
+		  "active_lot": "default",
+		  "last_ticket": "T20241101090000-0002",
+		  "journal_seq": 42,
+		  "lots": {"default": <pm.LotSnapshot>}
+		}
+
+		last_ticket keeps the tickets issued after a restore from repeating the ones issued before,
+		journal_seq is the last journal record the lots include, the ones up to it are not replayed.
+	*/
+	sessionSnapshot struct {
+		Version    int                        `json:"version"`
+		ActiveLot  string                     `json:"active_lot"`
+		LastTicket string                     `json:"last_ticket,omitempty"`
+		JournalSeq uint64                     `json:"journal_seq,omitempty"`
+		Lots       map[string]*pm.LotSnapshot `json:"lots"`
+	}
+)
+
+/*
+Writes the state of all the lots to the file, as JSON.
+
+The file is replaced at once (written aside, then renamed), so a crash while saving leaves the previous snapshot.
+*/
+func (ls *LotService) SaveSnapshot(fileName string) error {
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	return ls.saveSnapshot(fileName, ls.journalSeq)
+}
+
+func (ls *LotService) saveSnapshot(fileName string, journalSeq uint64) error {
+	ls.mu.RLock()
+	snapshot := sessionSnapshot{
+		Version:    SnapshotVersion,
+		ActiveLot:  ls.activeLot,
+		LastTicket: ls.tickets.LastIssued(),
+		JournalSeq: journalSeq,
+		Lots:       make(map[string]*pm.LotSnapshot, len(ls.lots)),
+	}
+	for name, parkingLot := range ls.lots {
+		snapshot.Lots[name] = parkingLot.Snapshot()
+	}
+	ls.mu.RUnlock()
+
+	content, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), fileName)
+}
+
+/*
+Replaces all the lots by the ones saved to the file, see SaveSnapshot.
+
+The lots get the settings of the service, nothing changes if any lot cannot be restored.
+The changes made before can no longer be undone, a snapshot is not loaded while a transaction is open.
+With a journal, the loaded lots are compacted into the state file right away, they replace whatever the journal holds.
+*/
+func (ls *LotService) LoadSnapshot(ctx context.Context, fileName string) error {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	var snapshot sessionSnapshot
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		return fmt.Errorf("%w: %v", pm.ErrInvalidSnapshot, err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSnapshot, snapshot.Version)
+	}
+	if _, ok := snapshot.Lots[snapshot.ActiveLot]; !ok && len(snapshot.Lots) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownLot, snapshot.ActiveLot)
+	}
+
+	ls.journalMu.Lock()
+	defer ls.journalMu.Unlock()
+
+	if err := ls.restoreSnapshot(ls.atOneInstant(ctx), &snapshot); err != nil {
+		return err
+	}
+
+	ls.journalSeq = max(ls.journalSeq, snapshot.JournalSeq)
+	if ls.journal == nil {
+		return nil
+	}
+	ls.journal.resumeAfter(ls.journalSeq)
+	return ls.compact()
+}
+
+// puts the lots of the snapshot in place, the caller holds journalMu. The open transaction is checked first, a refused load changes nothing.
+func (ls *LotService) restoreSnapshot(ctx context.Context, snapshot *sessionSnapshot) error {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.transaction != nil {
+		ls.transaction.fail(TokenForLoadSnapshot)
+		return ErrTransactionOpen
+	}
+	lots := make(map[string]*pm.ParkingLot, len(snapshot.Lots))
+	for name, lotSnapshot := range snapshot.Lots {
+		if lotSnapshot == nil {
+			return fmt.Errorf("%w: lot %s is empty", pm.ErrInvalidSnapshot, name)
+		}
+		parkingLot, err := pm.RestoreParkingLot(lotSnapshot, append(ls.lotOptions(), pm.WithEventLog(ls.events, name))...)
+		if err != nil {
+			return fmt.Errorf("lot %s: %w", name, err)
+		}
+		if parkingLot.GetCapacity() > ls.config.MaxSlots {
+			return fmt.Errorf("lot %s: %w: %d", name, ErrMaxSlotExceeded, ls.config.MaxSlots)
+		}
+		lots[name] = parkingLot
+	}
+	if err := ls.tickets.ResumeAfter(snapshot.LastTicket); err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	ls.lots, ls.activeLot = lots, snapshot.ActiveLot
+	ls.recordSnapshotLoaded(ctx, lots, snapshot.ActiveLot)
+	ls.mu.Unlock()
+	// the changes were made to the lots replaced
+	ls.forgetChanges()
+	return nil
+}
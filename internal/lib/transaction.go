@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+)
+
+var (
+	ErrTransactionOpen = errors.New("a transaction is open")
+	ErrNoTransaction   = errors.New("no transaction is open")
+)
+
+type (
+	// transaction is the changes made between begin and commit, they are all kept or all undone.
+	transaction struct {
+		changes []change
+		failed  string // the command line of the first command which failed, empty while none did
+	}
+
+	// TransactionFailedError is returned by Commit when a command of the transaction failed, the changes made are rolled back.
+	TransactionFailedError struct {
+		CommandLine string
+		RolledBack  int // the number of changes undone
+	}
+
+	// batch is the changes of a committed transaction, undone and redone as one.
+	batch []ReversibleCommander
+
+	// rejectedCommand stands for a command which could not be parsed, it fails the transaction it is part of.
+	rejectedCommand struct {
+		lotService  *LotService
+		commandLine string
+	}
+)
+
+func (err *TransactionFailedError) Error() string {
+	return fmt.Sprintf("%s failed, rolled back %s", err.CommandLine, countOf(err.RolledBack, "change"))
+}
+
+func (b batch) Execute(ctx context.Context) error {
+	for _, command := range b {
+		if err := command.Execute(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the inverses of the changes, the latest first
+func (b batch) Inverse() ReversibleCommander {
+	inverse := make(batch, len(b))
+	for i, command := range b {
+		inverse[len(b)-1-i] = command.Inverse()
+	}
+	return inverse
+}
+
+func (rc *rejectedCommand) Execute(ctx context.Context) error {
+	rc.lotService.FailTransaction(rc.commandLine)
+	return nil
+}
+
+/*
+Opens a transaction, the changes made until Commit are kept together or not at all.
+
+A change which fails within the transaction (e.g. park to a full lot) makes Commit roll all the changes back,
+so do undo, redo and a nested begin, which are refused while it is open. With an event log file,
+the events of the transaction are written to it once it ends, a crash in between leaves none of them.
+*/
+func (ls *LotService) Begin() error {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.transaction != nil {
+		ls.transaction.fail(TokenForBegin)
+		return ErrTransactionOpen
+	}
+	ls.transaction = &transaction{}
+	ls.holdEvents()
+	return nil
+}
+
+/*
+Ends the transaction keeping its changes, returns how many there are. They are undone and redone as one from now on.
+
+When a command of the transaction failed, its changes are rolled back instead and a *TransactionFailedError is returned.
+*/
+func (ls *LotService) Commit(ctx context.Context) (int, error) {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	tx := ls.transaction
+	if tx == nil {
+		return 0, ErrNoTransaction
+	}
+	if tx.failed != "" {
+		rolledBack, err := ls.rollback(ctx)
+		if err != nil {
+			return rolledBack, err
+		}
+		return 0, &TransactionFailedError{CommandLine: tx.failed, RolledBack: rolledBack}
+	}
+
+	ls.transaction = nil
+	ls.releaseEvents()
+	if len(tx.changes) > 0 && ls.config.UndoLimit > 0 {
+		commandLines, changes := make([]string, 0, len(tx.changes)), make(batch, 0, len(tx.changes))
+		for _, change := range tx.changes {
+			commandLines, changes = append(commandLines, change.commandLine), append(changes, change.command)
+		}
+		ls.remember(change{commandLine: strings.Join(commandLines, "; "), command: changes})
+	}
+	return len(tx.changes), nil
+}
+
+// Ends the transaction undoing its changes, the latest first, returns how many were undone.
+func (ls *LotService) Rollback(ctx context.Context) (int, error) {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.transaction == nil {
+		return 0, ErrNoTransaction
+	}
+	return ls.rollback(ctx)
+}
+
+// Fails the open transaction, if any, e.g. because one of its commands could not be parsed.
+func (ls *LotService) FailTransaction(commandLine string) {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.transaction != nil {
+		ls.transaction.fail(commandLine)
+	}
+}
+
+func (ls *LotService) InTransaction() bool {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	return ls.transaction != nil
+}
+
+// see Rollback, the caller holds changeMu. A change which cannot be undone empties the undo history, as Undo does.
+func (ls *LotService) rollback(ctx context.Context) (int, error) {
+	tx := ls.transaction
+	ls.transaction = nil
+	defer ls.releaseEvents()
+
+	for i := len(tx.changes) - 1; i >= 0; i-- {
+		if err := tx.changes[i].command.Inverse().Execute(ctx); err != nil {
+			ls.forgetChanges()
+			return len(tx.changes) - 1 - i, err
+		}
+	}
+	return len(tx.changes), nil
+}
+
+// keeps the first command which failed
+func (tx *transaction) fail(commandLine string) {
+	if tx.failed == "" {
+		tx.failed = commandLine
+	}
+}
+
+// keeps the events from the event log file until the transaction ends, see releaseEvents
+func (ls *LotService) holdEvents() {
+	ls.eventFileMu.Lock()
+	defer ls.eventFileMu.Unlock()
+
+	if ls.eventFile != nil {
+		ls.heldEvents = make([]pm.Event, 0)
+	}
+}
+
+// writes the events held back to the event log file, the undone changes of a rollback with their Undone events
+func (ls *LotService) releaseEvents() {
+	ls.eventFileMu.Lock()
+	defer ls.eventFileMu.Unlock()
+
+	for _, event := range ls.heldEvents {
+		ls.writeEvent(event)
+	}
+	ls.heldEvents = nil
+}
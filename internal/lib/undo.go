@@ -0,0 +1,354 @@
+package lib
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+
+	pm "github.com/ilivestrong/internal/lib/parking_manager"
+)
+
+const DefaultUndoLimit = 100
+
+// the events recorded by the lot service itself, the lots they are about are replaced or selected rather than changed
+var serviceEvents = map[pm.EventType]bool{
+	pm.EventLotCreated:     true,
+	pm.EventLotRestored:    true,
+	pm.EventLotSelected:    true,
+	pm.EventLotDropped:     true,
+	pm.EventSnapshotLoaded: true,
+}
+
+type (
+	/*
+		ReversibleCommander is a command which can be undone once it has been executed.
+
+		Its inverse puts the lots back as they were before the command, the inverse of the inverse executes it again.
+		The lot service keeps the latest reversible commands executed, see LotService.Undo and LotService.Redo.
+	*/
+	ReversibleCommander interface {
+		Commander
+		Inverse() ReversibleCommander
+	}
+
+	// trackedCommand is told what it changed by the lot service as it is executed, see reversible
+	trackedCommand interface {
+		ReversibleCommander
+		track(changes *changeSet)
+		hasFailed() bool
+	}
+
+	// reversible is embedded by the commands changing the lots, it makes them a trackedCommand.
+	reversible struct {
+		changes *changeSet
+		failed  bool // the command reported why it could not make its change, see fail
+	}
+
+	// changeSet is what a command changed: the events of the lots, and the lots and the active lot before and after it.
+	changeSet struct {
+		lotService     *LotService
+		id             uint64 // the events recorded by the command are tagged with, see LotService.lotAt
+		commandLine    string
+		fromSeq        uint64 // the last event recorded before the command
+		events         []pm.Event
+		positions      map[string]*int64 // of the allocation strategies of the lots before the command
+		lots           map[string]*pm.ParkingLot
+		lotsAfter      map[string]*pm.ParkingLot
+		activeLot      string
+		activeLotAfter string
+	}
+
+	// revertCommand undoes a change.
+	revertCommand struct {
+		changes *changeSet
+	}
+
+	// reapplyCommand redoes a change which was undone.
+	reapplyCommand struct {
+		changes *changeSet
+	}
+
+	// change is an entry of the undo and redo histories of a lot service.
+	change struct {
+		commandLine string
+		command     ReversibleCommander
+	}
+
+	// changeKey is the context key of the ID of the change a command makes.
+	changeKey struct{}
+
+	// lotEvents are the events a change recorded for one lot.
+	lotEvents struct {
+		lot    string
+		events []pm.Event
+	}
+)
+
+func (r *reversible) track(changes *changeSet) {
+	r.changes = changes
+}
+
+// marks the command failed, it fails the transaction it is part of
+func (r *reversible) fail() {
+	r.failed = true
+}
+
+func (r *reversible) hasFailed() bool {
+	return r.failed
+}
+
+func (r *reversible) Inverse() ReversibleCommander {
+	return &revertCommand{changes: r.changes}
+}
+
+func (rc *revertCommand) Execute(ctx context.Context) error {
+	return rc.changes.revert(ctx)
+}
+
+func (rc *revertCommand) Inverse() ReversibleCommander {
+	return &reapplyCommand{changes: rc.changes}
+}
+
+func (rc *reapplyCommand) Execute(ctx context.Context) error {
+	return rc.changes.reapply(ctx)
+}
+
+func (rc *reapplyCommand) Inverse() ReversibleCommander {
+	return &revertCommand{changes: rc.changes}
+}
+
+/*
+Undoes the latest change still in the history, returns the command line of the change and false when there is none.
+
+A change which cannot be undone, e.g. because the lot changed since without a command, empties the histories:
+the lots may be partly undone and the older changes no longer fit them. Nothing is undone while a transaction is open.
+*/
+func (ls *LotService) Undo(ctx context.Context) (string, bool, error) {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.transaction != nil {
+		ls.transaction.fail(TokenForUndo)
+		return "", true, ErrTransactionOpen
+	}
+	if len(ls.undoHistory) == 0 {
+		return "", false, nil
+	}
+	latest := ls.undoHistory[len(ls.undoHistory)-1]
+	ls.undoHistory = ls.undoHistory[:len(ls.undoHistory)-1]
+	inverse := latest.command.Inverse()
+	if err := inverse.Execute(ctx); err != nil {
+		ls.forgetChanges()
+		return latest.commandLine, true, err
+	}
+	ls.redoHistory = append(ls.redoHistory, change{commandLine: latest.commandLine, command: inverse})
+	return latest.commandLine, true, nil
+}
+
+// Redoes the latest change undone, see Undo. Any other change made since the undo forgets the changes undone.
+func (ls *LotService) Redo(ctx context.Context) (string, bool, error) {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.transaction != nil {
+		ls.transaction.fail(TokenForRedo)
+		return "", true, ErrTransactionOpen
+	}
+	if len(ls.redoHistory) == 0 {
+		return "", false, nil
+	}
+	latest := ls.redoHistory[len(ls.redoHistory)-1]
+	ls.redoHistory = ls.redoHistory[:len(ls.redoHistory)-1]
+	inverse := latest.command.Inverse()
+	if err := inverse.Execute(ctx); err != nil {
+		ls.forgetChanges()
+		return latest.commandLine, true, err
+	}
+	ls.undoHistory = append(ls.undoHistory, change{commandLine: latest.commandLine, command: inverse})
+	return latest.commandLine, true, nil
+}
+
+/*
+Executes the command, tracking a reversible one for undo.
+
+What it changed becomes the latest change of the undo history, or of the open transaction, see Begin.
+A command which changed nothing is not tracked, one which failed fails the open transaction.
+*/
+func (ls *LotService) execute(ctx context.Context, command Commander, commandLine string) error {
+	tracked, ok := command.(trackedCommand)
+	if !ok {
+		return command.Execute(ctx)
+	}
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	if ls.config.UndoLimit == 0 && ls.transaction == nil {
+		return command.Execute(ctx)
+	}
+	changes := ls.beginChanges(commandLine)
+	err := command.Execute(withChange(ctx, changes.id))
+	if ls.transaction != nil && (err != nil || tracked.hasFailed()) {
+		ls.transaction.fail(commandLine)
+	}
+	if !ls.endChanges(changes) {
+		return err
+	}
+	tracked.track(changes)
+	if ls.transaction != nil {
+		ls.transaction.changes = append(ls.transaction.changes, change{commandLine: commandLine, command: tracked})
+		return err
+	}
+	ls.remember(change{commandLine: commandLine, command: tracked})
+	return err
+}
+
+// makes the change the latest one of the undo history, which keeps Config.UndoLimit changes, the changes undone before are forgotten
+func (ls *LotService) remember(latest change) {
+	ls.undoHistory = append(ls.undoHistory, latest)
+	if len(ls.undoHistory) > ls.config.UndoLimit {
+		ls.undoHistory = slices.Delete(ls.undoHistory, 0, len(ls.undoHistory)-ls.config.UndoLimit)
+	}
+	ls.redoHistory = nil
+}
+
+// Empties the undo and redo histories, e.g. once the lots are replaced by a snapshot.
+func (ls *LotService) ForgetChanges() {
+	ls.changeMu.Lock()
+	defer ls.changeMu.Unlock()
+
+	ls.forgetChanges()
+}
+
+func (ls *LotService) forgetChanges() {
+	ls.undoHistory, ls.redoHistory = nil, nil
+}
+
+// the state a command starts from, the caller holds changeMu
+func (ls *LotService) beginChanges(commandLine string) *changeSet {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	ls.changeSeq++
+	changes := &changeSet{
+		lotService:  ls,
+		id:          ls.changeSeq,
+		commandLine: commandLine,
+		fromSeq:     ls.events.LastSeq(),
+		positions:   make(map[string]*int64, len(ls.lots)),
+		lots:        maps.Clone(ls.lots),
+		activeLot:   ls.activeLot,
+	}
+	for name, parkingLot := range ls.lots {
+		changes.positions[name] = parkingLot.StrategyPosition()
+	}
+	return changes
+}
+
+// collects what the command changed, false when it changed nothing. The events other commands recorded meanwhile are left out.
+func (ls *LotService) endChanges(changes *changeSet) bool {
+	for _, event := range ls.events.Since(changes.fromSeq) {
+		if event.Change == changes.id {
+			changes.events = append(changes.events, event)
+		}
+	}
+
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	changes.lotsAfter, changes.activeLotAfter = maps.Clone(ls.lots), ls.activeLot
+	return len(changes.events) > 0
+}
+
+// puts the lots back as they were before the change: the events of the lots are undone, then the lots replaced or selected are put back
+func (changes *changeSet) revert(ctx context.Context) error {
+	ls := changes.lotService
+	byLot := changes.eventsByLot()
+	for i := len(byLot) - 1; i >= 0; i-- {
+		parkingLot, err := ls.GetNamedParkingLot(byLot[i].lot)
+		if err != nil {
+			return err
+		}
+		if err := ls.lotAt(ctx, parkingLot).Revert(byLot[i].events, changes.positions[byLot[i].lot]); err != nil {
+			return err
+		}
+	}
+	ls.switchLots(ctx, changes.lots, changes.activeLot)
+	return nil
+}
+
+// makes the change again, see revert
+func (changes *changeSet) reapply(ctx context.Context) error {
+	ls := changes.lotService
+	ls.switchLots(ctx, changes.lotsAfter, changes.activeLotAfter)
+	for _, lotEvents := range changes.eventsByLot() {
+		parkingLot, err := ls.GetNamedParkingLot(lotEvents.lot)
+		if err != nil {
+			return err
+		}
+		if err := ls.lotAt(ctx, parkingLot).Reapply(lotEvents.events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the events the lots recorded themselves, per lot in the order the lots were changed
+func (changes *changeSet) eventsByLot() []lotEvents {
+	byLot := make([]lotEvents, 0, 1)
+	for _, event := range changes.events {
+		if serviceEvents[event.Type] {
+			continue
+		}
+		i := slices.IndexFunc(byLot, func(lotEvents lotEvents) bool { return lotEvents.lot == event.Lot })
+		if i < 0 {
+			byLot, i = append(byLot, lotEvents{lot: event.Lot}), len(byLot)
+		}
+		byLot[i].events = append(byLot[i].events, event)
+	}
+	return byLot
+}
+
+// the context of a command making the change with the given ID
+func withChange(ctx context.Context, id uint64) context.Context {
+	return context.WithValue(ctx, changeKey{}, id)
+}
+
+// the ID of the change the command of the context makes, 0 when it is not tracked
+func changeOf(ctx context.Context) uint64 {
+	id, _ := ctx.Value(changeKey{}).(uint64)
+	return id
+}
+
+// puts the given lots and active lot in place, recording the lots put back (LotRestored) or taken away (LotDropped)
+func (ls *LotService) switchLots(ctx context.Context, lots map[string]*pm.ParkingLot, activeLot string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	names := slices.Collect(maps.Keys(ls.lots))
+	for name := range lots {
+		if _, ok := ls.lots[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parkingLot, ok := lots[name]
+		if ls.lots[name] == parkingLot {
+			continue
+		}
+		if !ok {
+			delete(ls.lots, name)
+			ls.record(ctx, pm.Event{Type: pm.EventLotDropped, Lot: name})
+			continue
+		}
+		ls.lots[name] = parkingLot
+		ls.record(ctx, pm.Event{Type: pm.EventLotRestored, Lot: name, State: parkingLot.Snapshot()})
+	}
+	if ls.activeLot != activeLot {
+		ls.activeLot = activeLot
+		if activeLot != "" {
+			ls.record(ctx, pm.Event{Type: pm.EventLotSelected, Lot: activeLot})
+		}
+	}
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/ilivestrong/internal/lib"
+	"github.com/ilivestrong/internal/lib/pricing"
 )
 
 const (
@@ -18,38 +22,138 @@ const (
 	CommandExit     = "exit"
 )
 
+// the commands which can be run before a lot is created, the creation of the only lot can be undone and redone
+var commandsWithoutLot = map[string]bool{
+	lib.TokenForCreateParkingLot: true,
+	lib.TokenForLoadSnapshot:     true,
+	lib.TokenForUndo:             true,
+	lib.TokenForRedo:             true,
+	lib.TokenForBegin:            true,
+	lib.TokenForCommit:           true,
+	lib.TokenForRollback:         true,
+}
+
 func main() {
+	// flags take precedence over the environment
+	cfg, err := lib.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.IntVar(&cfg.MaxSlots, "max-slots", cfg.MaxSlots, "maximum number of slots a parking lot can be created with (env "+lib.EnvMaxNumberOfSlots+")")
+	flag.StringVar(&cfg.RegistrationFormat, "registration-format", cfg.RegistrationFormat, "registration number format: in, generic (env "+lib.EnvRegistrationFormat+")")
+	flag.BoolVar(&cfg.StrictRegistration, "strict-registration", cfg.StrictRegistration, "refuse to park invalid registration numbers (env "+lib.EnvStrictRegistration+")")
+	flag.Func("color-palette", "comma separated colours which can be parked, any colour when empty (env "+lib.EnvColorPalette+")", func(value string) error {
+		cfg.ColorPalette = lib.ParseColorPalette(value)
+		return nil
+	})
+	flag.StringVar(&cfg.SpecialSlots, "special-slots", cfg.SpecialSlots, "who gets the tagged (accessible, ev, staff, compact) slots: kept - only the vehicles needing them, last-resort - anyone once the other slots are taken (env "+lib.EnvSpecialSlots+")")
+	flag.BoolVar(&cfg.Waitlist, "waitlist", cfg.Waitlist, "queue the vehicles which find the lot full, they are parked as slots are freed (env "+lib.EnvWaitlist+")")
+	flag.DurationVar(&cfg.ReservationGrace, "reservation-grace", cfg.ReservationGrace, "how long a reserved slot is held for a vehicle which has not shown up (env "+lib.EnvReservationGrace+")")
+	flag.DurationVar(&cfg.ReservationLead, "reservation-lead", cfg.ReservationLead, "how long before its window a reserved slot is kept free for the vehicle (env "+lib.EnvReservationLead+")")
+	flag.Func("tariff-file", "JSON file with the tariff the fees are computed with, a built-in tariff when not given (env "+lib.EnvTariffFile+")", func(value string) error {
+		tariff, err := pricing.LoadTariff(value)
+		if err != nil {
+			return err
+		}
+		cfg.Tariff = tariff
+		return nil
+	})
+	flag.StringVar(&cfg.StateFile, "state-file", cfg.StateFile, "snapshot file the lots are restored from on startup (when it exists) and saved to on exit (env "+lib.EnvStateFile+")")
+	flag.StringVar(&cfg.JournalFile, "journal-file", cfg.JournalFile, "journal the commands changing the lots are written to before they are applied and replayed from on startup, needs -state-file (env "+lib.EnvJournalFile+")")
+	flag.IntVar(&cfg.CompactEvery, "compact-every", cfg.CompactEvery, "number of journal records after which the journal is compacted into the state file (env "+lib.EnvCompactEvery+")")
+	flag.StringVar(&cfg.EventLogFile, "event-log-file", cfg.EventLogFile, "file the events of the lots are appended to and the lots derived from on startup, instead of -state-file (env "+lib.EnvEventLogFile+")")
+	flag.IntVar(&cfg.UndoLimit, "undo-limit", cfg.UndoLimit, "number of changes to the lots which can be undone, 0 turns undo off (env "+lib.EnvUndoLimit+")")
+	flag.IntVar(&cfg.HistoryLimit, "history-limit", cfg.HistoryLimit, "number of the latest events kept in memory for the history commands (env "+lib.EnvHistoryLimit+")")
+	allOrNothing := flag.Bool("all-or-nothing", false, "run the input file as one transaction, none of its changes are kept when any of them fails")
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
 	defer cancel()
 
-	if len(os.Args) > 1 {
-		inputFileName := os.Args[1]
-		runFileBasedMode(ctx, inputFileName, os.Stdout)
+	lotService, err := startLotService(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer lotService.Close()
+
+	if flag.NArg() > 0 {
+		inputFileName := flag.Arg(0)
+		runFileBasedMode(ctx, lotService, inputFileName, *allOrNothing, os.Stdout)
 	} else {
-		runInteractiveMode(ctx, os.Stdin, os.Stdout)
+		runInteractiveMode(ctx, lotService, os.Stdin, os.Stdout)
+	}
+
+	if cfg.StateFile != "" {
+		if err := lotService.Compact(); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// restores the lots saved to the state file and replays the journal on top of them, or derives them from the event log, when they are configured
+func startLotService(ctx context.Context, cfg lib.Config) (*lib.LotService, error) {
+	lotService := lib.NewLotService(cfg)
+	if cfg.EventLogFile != "" {
+		if err := lotService.OpenEventLog(cfg.EventLogFile); err != nil {
+			return nil, err
+		}
+		return lotService, nil
+	}
+	if cfg.StateFile != "" {
+		if err := lotService.LoadSnapshot(ctx, cfg.StateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if cfg.JournalFile == "" {
+		return lotService, nil
+	}
+
+	journal, records, err := lib.OpenJournal(cfg.JournalFile)
+	if err != nil {
+		return nil, err
 	}
+	if journal.Recovered > 0 {
+		log.Printf("dropped a torn record (%d bytes) at the end of the journal %s", journal.Recovered, cfg.JournalFile)
+	}
+	if err := lotService.Recover(ctx, journal, records); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	return lotService, nil
 }
 
-func runFileBasedMode(ctx context.Context, inputFileName string, output io.Writer) {
+func runFileBasedMode(ctx context.Context, lotService *lib.LotService, inputFileName string, allOrNothing bool, output io.Writer) {
 	writer := bufio.NewWriter(output)
 	defer writer.Flush()
 
-	cmdBuilder := lib.NewCommandBuilder(ModeFileBased, writer)
+	cmdBuilder := lib.NewCommandBuilder(ModeFileBased, writer, lotService)
+	defer rollbackOpenTransaction(ctx, cmdBuilder, lotService)
+	if allOrNothing {
+		// begun quietly, so the output starts as without it, the lot created first is part of the transaction
+		quietBuilder := lib.NewCommandBuilder(ModeFileBased, bufio.NewWriter(io.Discard), lotService)
+		quietBuilder.ParseCommand(lib.TokenForBegin).Execute(ctx)
+	}
 	commands, err := cmdBuilder.BuildCommands(ctx, inputFileName)
 	if err != nil {
 		return
 	}
+	if allOrNothing {
+		commands = append(commands, cmdBuilder.ParseCommand(lib.TokenForCommit))
+	}
 	executeCommands(ctx, commands)
 }
 
-func runInteractiveMode(ctx context.Context, input io.Reader, output io.Writer) {
+func runInteractiveMode(ctx context.Context, lotService *lib.LotService, input io.Reader, output io.Writer) {
 	reader := bufio.NewReader(input)
 	writer := bufio.NewWriter(output)
 	defer writer.Flush()
 
-	cmdBuilder := lib.NewCommandBuilder(ModeInteractive, writer)
+	cmdBuilder := lib.NewCommandBuilder(ModeInteractive, writer, lotService)
+	defer rollbackOpenTransaction(ctx, cmdBuilder, lotService)
 
-	parkingLotCreated := false
 	for {
 		input, _ := reader.ReadString('\n')
 		commandName, args := tokenize(input)
@@ -64,13 +168,13 @@ func runInteractiveMode(ctx context.Context, input io.Reader, output io.Writer)
 
 		cmd := cmdBuilder.ParseCommand(commandName, args...)
 		if cmd == nil {
+			lotService.FailTransaction(strings.TrimSpace(input))
 			continue
 		}
 
-		if commandName == lib.TokenForCreateParkingLot {
-			parkingLotCreated = true
-		} else if !parkingLotCreated {
+		if !commandsWithoutLot[commandName] && !lotService.HasParkingLot() {
 			writeToOutput(writer, "\nPlease create a parking lot first\n\n")
+			lotService.FailTransaction(strings.TrimSpace(input))
 			continue
 		}
 
@@ -81,6 +185,13 @@ func runInteractiveMode(ctx context.Context, input io.Reader, output io.Writer)
 	}
 }
 
+// rolls back the transaction the input left open, its changes were never committed
+func rollbackOpenTransaction(ctx context.Context, cmdBuilder *lib.CommandBuilder, lotService *lib.LotService) {
+	if lotService.InTransaction() {
+		cmdBuilder.ParseCommand(lib.TokenForRollback).Execute(ctx)
+	}
+}
+
 func executeCommands(ctx context.Context, commands []lib.Commander) {
 	for _, command := range commands {
 		command.Execute(ctx)
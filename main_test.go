@@ -1,20 +1,48 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
-	"fmt"
+	"encoding/binary"
+	"errors"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ilivestrong/internal/lib"
+	"github.com/ilivestrong/internal/lib/pricing"
 )
 
+// fakeClock starts at a fixed time and moves on by step every time it is read.
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func newFakeClock(step time.Duration) *fakeClock {
+	return &fakeClock{now: time.Date(2024, time.November, 1, 9, 0, 0, 0, time.UTC), step: step}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	now := fc.now
+	fc.now = fc.now.Add(fc.step)
+	return now
+}
+
 func TestRunFileBasedMode(t *testing.T) {
 	tests := []struct {
 		name           string
+		configure      func(cfg *lib.Config)
+		allOrNothing   bool
 		fileContent    string
 		expectedOutput string
 	}{
@@ -24,8 +52,8 @@ func TestRunFileBasedMode(t *testing.T) {
 			park KA-01-HH-1234 White
 			park KA-01-HH-9999 White`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2`,
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002`,
 		},
 		{
 			name: "Filebased - create a slot of 6, park 2 cars, leave slot 2",
@@ -34,9 +62,9 @@ func TestRunFileBasedMode(t *testing.T) {
 			park KA-01-HH-9999 White
 			leave 2`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2
-			Slot number 2 is free`,
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Slot number 2 is free, parked for 0h00m, fee 20.00`,
 		},
 		{
 			name: "Filebased - create a slot of 6, park 2 cars, leave slot 2, park new car and get slot 2",
@@ -46,13 +74,13 @@ func TestRunFileBasedMode(t *testing.T) {
 			leave 2
 			park KA-01-HH-4444 Red`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2
-			Slot number 2 is free
-			Allocated slot number: 2`,
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Slot number 2 is free, parked for 0h00m, fee 20.00
+			Allocated slot number: 2, ticket: T20241101090000-0003`,
 		},
 		{
-			name: "Filebased - create a slot of 6, park 5 cars, get registration numbers for Red cars",
+			name: "Filebased - create a slot of 6, park 5 cars (one of them twice), get registration numbers for Red cars",
 			fileContent: `create_parking_lot 6
 			park KA-01-HH-1234 White
 			park KA-01-HH-9999 Red
@@ -61,13 +89,30 @@ func TestRunFileBasedMode(t *testing.T) {
 			park KA-01-HH-4444 Red
 			registration_numbers_for_cars_with_color Red`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2
-			Allocated slot number: 3
-			Allocated slot number: 4
-			Allocated slot number: 5
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 1
+			Allocated slot number: 3, ticket: T20241101090000-0003
+			Allocated slot number: 4, ticket: T20241101090000-0004
 			KA-01-HH-9999, KA-01-HH-8888, KA-01-HH-4444`,
 		},
+		{
+			name: "Filebased - park the same car twice, leave its slot, it is gone from every index",
+			fileContent: `create_parking_lot 6
+			park KA-01-HH-1234 White
+			park KA-01-HH-1234 Red
+			leave 1
+			slot_number_for_registration_number KA-01-HH-1234
+			park KA-01-HH-1234 Red
+			slot_numbers_for_cars_with_color Red`,
+			expectedOutput: `Created a parking lot with 6 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 1
+			Slot number 1 is free, parked for 0h00m, fee 20.00Not found
+
+			Allocated slot number: 1, ticket: T20241101090000-0002
+			1`,
+		},
 		{
 			name: "Filebased - create a slot of 30k, get error",
 			fileContent: `create_parking_lot 30000
@@ -79,6 +124,265 @@ func TestRunFileBasedMode(t *testing.T) {
 			registration_numbers_for_cars_with_color Red`,
 			expectedOutput: `cannot create :30000 slots. max slots available: 20000`,
 		},
+		{
+			name:      "Filebased - raise the slot limit, create a slot of 150k, park 2 cars, leave slot 1",
+			configure: func(cfg *lib.Config) { cfg.MaxSlots = 200000 },
+			fileContent: `create_parking_lot 150000
+			park KA-01-HH-1234 White
+			park KA-01-HH-9999 Red
+			leave 1
+			park KA-01-HH-8888 Red`,
+			expectedOutput: `Created a parking lot with 150000 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Slot number 1 is free, parked for 0h00m, fee 20.00
+			Allocated slot number: 1, ticket: T20241101090000-0003`,
+		},
+		{
+			name:      "Filebased - lower the slot limit, create a slot of 10, get error",
+			configure: func(cfg *lib.Config) { cfg.MaxSlots = 5 },
+			fileContent: `create_parking_lot 10
+			park KA-01-HH-1234 White`,
+			expectedOutput: `cannot create :10 slots. max slots available: 5`,
+		},
+		{
+			name: "Filebased - registration numbers are normalized on park and lookup",
+			fileContent: `create_parking_lot 6
+			park ka-01-hh-1234 White
+			park KA01HH1234 White
+			park KA-1-HH-99 Red
+			slot_number_for_registration_number ka01hh0099
+			registration_numbers_for_cars_with_color Red`,
+			expectedOutput: `Created a parking lot with 6 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 1
+		    Allocated slot number: 2, ticket: T20241101090000-00022
+
+			KA-01-HH-0099`,
+		},
+		{
+			name:      "Filebased - strict registration, invalid registration numbers are refused",
+			configure: func(cfg *lib.Config) { cfg.StrictRegistration = true },
+			fileContent: `create_parking_lot 6
+			park KA-01-HH-1234 White
+			park invalid_11 White
+			park KA-01-HH-9999 Red`,
+			expectedOutput: `Created a parking lot with 6 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, invalid registration number: INVALID_11
+		    Allocated slot number: 2, ticket: T20241101090000-0002`,
+		},
+		{
+			name: "Filebased - generic registration format, strict",
+			configure: func(cfg *lib.Config) {
+				cfg.RegistrationFormat = "generic"
+				cfg.StrictRegistration = true
+			},
+			fileContent: `create_parking_lot 6
+			park ab-123-cd White
+			park AB*123 White
+			slot_number_for_registration_number AB123CD`,
+			expectedOutput: `Created a parking lot with 6 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, invalid registration number: AB*1231`,
+		},
+		{
+			name: "Filebased - colours are case insensitive and aliases are resolved on park and query",
+			fileContent: `create_parking_lot 6
+			park KA-01-HH-1234 White
+			park KA-01-HH-9999 grey
+			park KA-01-HH-1235 WHITE
+			park KA-01-HH-8888 Gray
+			registration_numbers_for_cars_with_color white
+			slot_numbers_for_cars_with_color GREY`,
+			expectedOutput: `Created a parking lot with 6 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Allocated slot number: 3, ticket: T20241101090000-0003
+			Allocated slot number: 4, ticket: T20241101090000-0004
+			KA-01-HH-1234, KA-01-HH-1235
+			2, 4`,
+		},
+		{
+			name:      "Filebased - fixed colour palette, unknown colours are refused",
+			configure: func(cfg *lib.Config) { cfg.ColorPalette = []string{"white", "red"} },
+			fileContent: `create_parking_lot 6
+			park KA-01-HH-1234 White
+			park KA-01-HH-9999 Purple
+			park KA-01-HH-8888 RED
+			registration_numbers_for_cars_with_color Purple`,
+			expectedOutput: `Created a parking lot with 6 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, unknown color: Purple
+			Allocated slot number: 2, ticket: T20241101090000-0002Not found`,
+		},
+		{
+			name: "Filebased - multi-level lot, fills the lowest level first, slots are labelled per level",
+			fileContent: `create_parking_lot L1:2 L2:small=1 L2:2
+			park KA-01-HH-1234 White
+			park KA-01-HH-9999 Red motorcycle
+			park KA-01-HH-8888 Red
+			park KA-01-HH-7777 Red
+			leave L1-002
+			park KA-01-HH-6666 Red
+			slot_numbers_for_cars_with_color Red`,
+			expectedOutput: `Created a parking lot with 5 slots on 2 levels
+		    Allocated slot number: L1-001, ticket: T20241101090000-0001
+		    Allocated slot number: L2-001, ticket: T20241101090000-0002
+			Allocated slot number: L1-002, ticket: T20241101090000-0003
+			Allocated slot number: L2-002, ticket: T20241101090000-0004
+			Slot number L1-002 is free, parked for 0h00m, fee 20.00
+			Allocated slot number: L1-002, ticket: T20241101090000-0005
+			L2-001, L2-002, L1-002`,
+		},
+		{
+			name: "Filebased - multi-level lot, fills the highest level first",
+			fileContent: `create_parking_lot L1:2 L2:2 --fill-order highest
+			park KA-01-HH-1234 White
+			park KA-01-HH-1235 White
+			park KA-01-HH-1236 White
+			leave 3`,
+			expectedOutput: `Created a parking lot with 4 slots on 2 levels
+		    Allocated slot number: L2-001, ticket: T20241101090000-0001
+		    Allocated slot number: L2-002, ticket: T20241101090000-0002
+			Allocated slot number: L1-001, ticket: T20241101090000-0003
+			Slot number L2-001 is free, parked for 0h00m, fee 20.00`,
+		},
+		{
+			name: "Filebased - multi-level lot, round-robin across the levels",
+			fileContent: `create_parking_lot L1:2 L2:2 L3:2 --strategy round-robin
+			park KA-01-HH-1234 White
+			park KA-01-HH-1235 White
+			park KA-01-HH-1236 White
+			park KA-01-HH-1237 White
+			leave L1-001
+			park KA-01-HH-1238 White`,
+			expectedOutput: `Created a parking lot with 6 slots on 3 levels
+		    Allocated slot number: L1-001, ticket: T20241101090000-0001
+		    Allocated slot number: L2-001, ticket: T20241101090000-0002
+			Allocated slot number: L3-001, ticket: T20241101090000-0003
+			Allocated slot number: L1-002, ticket: T20241101090000-0004
+			Slot number L1-001 is free, parked for 0h00m, fee 20.00
+			Allocated slot number: L2-002, ticket: T20241101090000-0005`,
+		},
+		{
+			name: "Filebased - farthest slot first",
+			fileContent: `create_parking_lot 5 --strategy farthest
+			park KA-01-HH-1234 White
+			park KA-01-HH-1235 White
+			leave 5
+			park KA-01-HH-1236 White`,
+			expectedOutput: `Created a parking lot with 5 slots
+		    Allocated slot number: 5, ticket: T20241101090000-0001
+		    Allocated slot number: 4, ticket: T20241101090000-0002
+			Slot number 5 is free, parked for 0h00m, fee 20.00
+		    Allocated slot number: 5, ticket: T20241101090000-0003`,
+		},
+		{
+			name: "Filebased - named lots are independent of each other",
+			fileContent: `create_parking_lot 2 --lot north
+			create_parking_lot 1 --lot south
+			park KA-01-HH-1234 White
+			park KA-01-HH-9999 White
+			park KA-01-HH-9999 White --lot north
+			leave 1 --lot north
+			slot_number_for_registration_number KA-01-HH-1234`,
+			expectedOutput: `Created parking lot north with 2 slots
+			Created parking lot south with 1 slots
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, parking lot is full
+			Allocated slot number: 1, ticket: T20241101090000-0002
+			Slot number 1 is free, parked for 0h00m, fee 20.001`,
+		},
+		{
+			name: "Filebased - a block with a failing park is rolled back, a committed block is undone as one",
+			fileContent: `create_parking_lot 2
+			park KA-01-HH-1234 White
+			begin
+			park KA-01-HH-9999 Red
+			leave 1
+			park KA-01-HH-7777 Blue
+			park KA-01-HH-2701 Black
+			commit
+			status
+			begin
+			park KA-01-HH-9999 Red
+			leave 1
+			commit
+			undo
+			status
+			rollback
+			`,
+			expectedOutput: `Created a parking lot with 2 slots
+			Allocated slot number: 1, ticket: T20241101090000-0001
+			Began a transaction
+			Allocated slot number: 2, ticket: T20241101090000-0002
+			Slot number 1 is free, parked for 0h00m, fee 20.00
+			Allocated slot number: 1, ticket: T20241101090000-0003
+			Sorry, parking lot is full
+			Sorry, park KA-01-HH-2701 Black failed, rolled back 3 changes
+			Slot No.   Registration No      Color      Type      
+			1          KA-01-HH-1234        White      car       
+			Began a transaction
+			Allocated slot number: 2, ticket: T20241101090000-0004
+			Slot number 1 is free, parked for 0h00m, fee 20.00
+			Committed 2 changes
+			Undone: park KA-01-HH-9999 Red; leave 1
+			Slot No.   Registration No      Color      Type      
+			1          KA-01-HH-1234        White      car       
+			Sorry, no transaction to roll back`,
+		},
+		{
+			name: "Filebased - a block with an invalid command is rolled back, a block left open at the end of the file too",
+			fileContent: `create_parking_lot 2
+			begin
+			park KA-01-HH-1234 White
+			prak KA-01-HH-9999 Red
+			commit
+			begin
+			park KA-01-HH-1234 White
+			`,
+			expectedOutput: `Created a parking lot with 2 slots
+			invalid command: prak, skipping...
+			
+			
+			Began a transaction
+			Allocated slot number: 1, ticket: T20241101090000-0001
+			Sorry, prak KA-01-HH-9999 Red failed, rolled back 1 change
+			Began a transaction
+			Allocated slot number: 1, ticket: T20241101090000-0002
+			Rolled back 1 change`,
+		},
+		{
+			name:         "Filebased - all or nothing, a failing command rolls the whole file back",
+			allOrNothing: true,
+			fileContent: `create_parking_lot 2
+			park KA-01-HH-1234 White
+			park KA-01-HH-9999 Red
+			park KA-01-HH-7777 Blue
+			status
+			`,
+			expectedOutput: `Created a parking lot with 2 slots
+			Allocated slot number: 1, ticket: T20241101090000-0001
+			Allocated slot number: 2, ticket: T20241101090000-0002
+			Sorry, parking lot is full
+			Slot No.   Registration No      Color      Type      
+			1          KA-01-HH-1234        White      car       
+			2          KA-01-HH-9999        Red        car       
+			Sorry, park KA-01-HH-7777 Blue failed, rolled back 3 changes`,
+		},
+		{
+			name:         "Filebased - all or nothing, every command succeeds",
+			allOrNothing: true,
+			fileContent: `create_parking_lot 2
+			park KA-01-HH-1234 White
+			leave 1
+			`,
+			expectedOutput: `Created a parking lot with 2 slots
+			Allocated slot number: 1, ticket: T20241101090000-0001
+			Slot number 1 is free, parked for 0h00m, fee 20.00
+			Committed 3 changes`,
+		},
 		{
 			name: "Filebased - create a slot of 6, park 5 cars, get slot numbers for White cars",
 			fileContent: `create_parking_lot 6
@@ -89,11 +393,11 @@ func TestRunFileBasedMode(t *testing.T) {
 			park KA-01-HH-4444 Red
 			slot_numbers_for_cars_with_color White`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2
-			Allocated slot number: 3
-			Allocated slot number: 4
-			Allocated slot number: 5
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Allocated slot number: 3, ticket: T20241101090000-0003
+			Allocated slot number: 4, ticket: T20241101090000-0004
+			Allocated slot number: 5, ticket: T20241101090000-0005
 			1, 3`,
 		},
 		{
@@ -106,11 +410,11 @@ func TestRunFileBasedMode(t *testing.T) {
 			park KA-01-HH-4444 Red
 			slot_number_for_registration_number KA-01-HH-9999`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2
-			Allocated slot number: 3
-			Allocated slot number: 4
-			Allocated slot number: 52`,
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Allocated slot number: 3, ticket: T20241101090000-0003
+			Allocated slot number: 4, ticket: T20241101090000-0004
+			Allocated slot number: 5, ticket: T20241101090000-00052`,
 		},
 		{
 			name: "Filebased - create a slot of 6, park 5 cars, get slot numbers for invalid registration number",
@@ -122,16 +426,19 @@ func TestRunFileBasedMode(t *testing.T) {
 			park KA-01-HH-4444 Red
 			slot_number_for_registration_number invalid_11`,
 			expectedOutput: `Created a parking lot with 6 slots
-		    Allocated slot number: 1
-		    Allocated slot number: 2
-			Allocated slot number: 3
-			Allocated slot number: 4
-			Allocated slot number: 5Not found`,
+		    Allocated slot number: 1, ticket: T20241101090000-0001
+		    Allocated slot number: 2, ticket: T20241101090000-0002
+			Allocated slot number: 3, ticket: T20241101090000-0003
+			Allocated slot number: 4, ticket: T20241101090000-0004
+			Allocated slot number: 5, ticket: T20241101090000-0005Not found`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			// every case owns its lot service, so the cases can run side by side
+			t.Parallel()
+
 			// Create a temporary file
 			tempFile, err := os.CreateTemp("", "testfile_*.txt")
 			if err != nil {
@@ -150,8 +457,14 @@ func TestRunFileBasedMode(t *testing.T) {
 
 			var output bytes.Buffer
 
+			cfg := lib.DefaultConfig()
+			cfg.Clock = newFakeClock(0)
+			if tt.configure != nil {
+				tt.configure(&cfg)
+			}
+
 			// Run the function
-			runFileBasedMode(ctx, tempFile.Name(), &output)
+			runFileBasedMode(ctx, lib.NewLotService(cfg), tempFile.Name(), tt.allOrNothing, &output)
 
 			// Normalize output: Trim spaces, replace \r\n with \n, and remove leading spaces from each line
 			actualOutput := normalizeOutput(output.String())
@@ -183,6 +496,7 @@ func normalizeOutput(input string) string {
 func TestRunInteractiveMode(t *testing.T) {
 	tests := []struct {
 		name           string
+		configure      func(cfg *lib.Config)
 		input          string
 		expectedOutput string
 	}{
@@ -193,7 +507,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		park KA-01-HH-9999 White
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1Allocated slot number: 2`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002`,
 		},
 		{
 			name: "Create parking lot and park three cars, leave slot 2 and exit",
@@ -204,7 +518,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		leave 2
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 4 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Slot number 2 is free`,
+			expectedOutput: `Created a parking lot with 4 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Slot number 2 is free, parked for 0h00m, fee 20.00`,
 		},
 		{
 			name: "Create parking lot with 4 slots and exit without parking",
@@ -229,7 +543,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		status
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 10 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Slot No.   Registration No      Color     1          KA-01-HH-1234        White     2          KA-01-HH-9999        White     3          KA-01-HH-9531        Red       `,
+			expectedOutput: `Created a parking lot with 10 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Slot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       2          KA-01-HH-9999        White      car       3          KA-01-HH-9531        Red        car       `,
 		},
 		{
 			name: "Create parking lot with 30K slots",
@@ -238,7 +552,271 @@ func TestRunInteractiveMode(t *testing.T) {
 		park KA-01-HH-9999 White
 		exit
 		`,
-			expectedOutput: fmt.Sprintf(`cannot create :30000 slots. %s`, lib.ErrMaxSlotExceeded),
+			expectedOutput: `cannot create :30000 slots. max slots available: 20000`,
+		},
+		{
+			name: "Create parking lot and park the same car twice, get status",
+			input: `create_parking_lot 4
+		park KA-01-HH-1234 White
+		park KA-01-HH-1234 White
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 4 slotsAllocated slot number: 1, ticket: T20241101090000-0001Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 1Slot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       `,
+		},
+		{
+			name: "Create parking lot and park cars with differently spelled colours, status keeps the spelling",
+			input: `create_parking_lot 4
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 WHITE
+		registration_numbers_for_cars_with_color white
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 4 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002KA-01-HH-1234, KA-01-HH-9999Slot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       2          KA-01-HH-9999        WHITE      car       `,
+		},
+		{
+			name: "Create parking lot with slot sizes, park vehicles of each type into the smallest slot they fit, get status",
+			input: `create_parking_lot small=1 medium=2 large=2
+		park KA-01-HH-1234 White van
+		park KA-01-HH-9999 Red motorcycle
+		park KA-01-HH-8888 Red motorcycle
+		park KA-01-HH-7777 Blue
+		park KA-01-HH-6666 Blue bus
+		park KA-01-HH-5555 Blue car
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 5 slotsAllocated slot number: 4, ticket: T20241101090000-0001Allocated slot number: 1, ticket: T20241101090000-0002Allocated slot number: 2, ticket: T20241101090000-0003Allocated slot number: 3, ticket: T20241101090000-0004Sorry, no free slot for a busAllocated slot number: 5, ticket: T20241101090000-0005Slot No.   Registration No      Color      Type      1          KA-01-HH-9999        Red        motorcycle2          KA-01-HH-8888        Red        motorcycle3          KA-01-HH-7777        Blue       car       4          KA-01-HH-1234        White      van       5          KA-01-HH-5555        Blue       car       `,
+		},
+		{
+			name: "Create multi-level parking lot, park cars, get status with per level breakdown",
+			input: `create_parking_lot L1:2 L2:3
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 White
+		park KA-01-HH-8888 Red
+		leave L9-001
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 5 slots on 2 levelsAllocated slot number: L1-001, ticket: T20241101090000-0001Allocated slot number: L1-002, ticket: T20241101090000-0002Allocated slot number: L2-001, ticket: T20241101090000-0003slot L9-001 is not occupiedSlot No.   Registration No      Color      Type      L1-001     KA-01-HH-1234        White      car       L1-002     KA-01-HH-9999        White      car       L2-001     KA-01-HH-8888        Red        car       Level      Occupied   Free      L1         2          0         L2         1          2         `,
+		},
+		{
+			name: "Create parking lot mixing levelled and flat slots",
+			input: `create_parking_lot L1:2 3
+		exit
+		`,
+			expectedOutput: `invalid layout: either every slot group is on a level (from 1) or none is`,
+		},
+		{
+			name: "Create two named parking lots, park into each, switch the active lot, find a registration number across lots",
+			input: `create_parking_lot 3 --lot north
+		create_parking_lot 2 --lot south
+		create_parking_lot 4 --lot north
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 White --lot north
+		use_lot north
+		park KA-01-HH-1234 Red
+		status --lot south
+		leave 1 --lot nowhere
+		leave 1 --lot
+		leave 1 --level 2
+		use_lot nowhere
+		lot_for_registration_number KA-01-HH-1234
+		lot_for_registration_number KA-01-HH-0000
+		registration_numbers_for_cars_with_color white
+		exit
+		`,
+			expectedOutput: `Created parking lot north with 3 slotsCreated parking lot south with 2 slotsSorry, parking lot north exists alreadyAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 1, ticket: T20241101090000-0002Using parking lot northSorry, vehicle KA-01-HH-1234 is already parked in lot south at slot number: 1Slot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       Sorry, unknown parking lot: nowheremissing value for flag: --lotunknown flag: --levelSorry, unknown parking lot: nowheresouth: 1Not foundKA-01-HH-9999`,
+		},
+		{
+			name:      "Create parking lot, park two cars, get status with times, leave one and get the parked duration",
+			configure: func(cfg *lib.Config) { cfg.Clock = newFakeClock(25 * time.Minute) },
+			input: `create_parking_lot 3
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		status --times
+		leave 1
+		status --since 09:00
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 3 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101092500-0001Slot No.   Registration No      Color      Type       Since            Duration  1          KA-01-HH-1234        White      car        2024-11-01 09:00 0h50m     2          KA-01-HH-9999        Red        car        2024-11-01 09:25 0h25m     Slot number 1 is free, parked for 1h15m, fee 30.00unknown flag: --since`,
+		},
+		{
+			name:      "Create parking lot, park a car and a van, quote their fees, leave both",
+			configure: func(cfg *lib.Config) { cfg.Clock = newFakeClock(40 * time.Minute) },
+			input: `create_parking_lot large=1 medium=1
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red van
+		fee_for_registration_number KA-01-HH-1234
+		fee_for_registration_number KA-01-HH-0000
+		leave 1
+		leave 2
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 2, ticket: T20241101090000-0001Allocated slot number: 1, ticket: T20241101094000-000130.00, parked for 1h20mNot foundSlot number 1 is free, parked for 1h20m, fee 45.00Slot number 2 is free, parked for 2h40m, fee 40.00`,
+		},
+		{
+			name:      "Create two lots, park in both, look a ticket up and leave by ticket",
+			configure: func(cfg *lib.Config) { cfg.Clock = newFakeClock(30 * time.Minute) },
+			input: `create_parking_lot 2 --lot north
+		create_parking_lot 2 --lot south
+		park KA-01-HH-1234 White --lot north
+		park KA-01-HH-9999 Red
+		ticket_info T20241101090000-0001
+		leave_by_ticket T20241101090000-0001 --lot south
+		leave_by_ticket T20241101090000-0001
+		leave_by_ticket T20241101090000-0001
+		ticket_info T20241101093000-0001
+		exit
+		`,
+			expectedOutput: `Created parking lot north with 2 slotsCreated parking lot south with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 1, ticket: T20241101093000-0001Ticket T20241101090000-0001: KA-01-HH-1234 White car at slot number 1 since 2024-11-01 09:00, parked for 1h00m, fee 20.00Sorry, unknown ticket: T20241101090000-0001Slot number 1 is free, parked for 1h30m, fee 30.00Sorry, unknown ticket: T20241101090000-0001Ticket T20241101093000-0001: KA-01-HH-9999 Red car at slot number 1 since 2024-11-01 09:30, parked for 1h30m, fee 30.00`,
+		},
+		{
+			name: "Create parking lot, park two cars, leave by registration number and reuse the slot",
+			input: `create_parking_lot 3
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 White
+		leave_by_registration_number ka01hh1234
+		leave_by_registration_number KA-01-HH-1234
+		registration_numbers_for_cars_with_color White
+		park KA-01-HH-4444 Red
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 3 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Slot number 1 is free, parked for 0h00m, fee 20.00Sorry, vehicle KA-01-HH-1234 is not parkedKA-01-HH-9999Allocated slot number: 1, ticket: T20241101090000-0003`,
+		},
+		{
+			name: "Create parking lot, reserve a slot, it is skipped by park, shown by status and claimed by its car",
+			input: `create_parking_lot 3
+		reserve KA-01-HH-1234 09:10 11:00
+		reserve KA-01-HH-1234 10:00 11:00
+		reserve KA-01-HH-5555 2024-11-01T08:00 2024-11-01T08:30
+		reserve KA-01-HH-5555 10:00 9am
+		reserve KA-01-HH-5555 08:00 08:30
+		park KA-01-HH-9999 White
+		status
+		park KA-01-HH-1234 Red
+		reserve KA-01-HH-1234 10:00 11:00
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 3 slotsReserved slot number: 1 from 2024-11-01 09:10 to 2024-11-01 11:00Sorry, vehicle KA-01-HH-1234 already has a reservationSorry, invalid reservation: the window is overSorry, invalid time: 9amReserved slot number: 1 from 2024-11-02 08:00 to 2024-11-02 08:30Allocated slot number: 2, ticket: T20241101090000-0001Slot No.   Registration No      Color      Type      1          KA-01-HH-1234        reserved   car       2          KA-01-HH-9999        White      car       Allocated slot number: 1, ticket: T20241101090000-0002Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 1Slot No.   Registration No      Color      Type      1          KA-01-HH-1234        Red        car       2          KA-01-HH-9999        White      car       `,
+		},
+		{
+			name: "Reservations hold their slot only around their window, later windows share it",
+			input: `create_parking_lot 1
+		reserve KA-01-HH-1234 2030-01-01T10:00 2030-01-01T12:00
+		park KA-01-HH-9999 White
+		reserve KA-01-HH-5555 2030-01-01T12:15 2030-01-01T13:00
+		reserve KA-01-HH-7777 2030-01-01T11:00 2030-01-01T12:30
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 1 slotsReserved slot number: 1 from 2030-01-01 10:00 to 2030-01-01 12:00Allocated slot number: 1, ticket: T20241101090000-0001Reserved slot number: 1 from 2030-01-01 12:15 to 2030-01-01 13:00Sorry, every slot for a car is reserved during the windowSlot No.   Registration No      Color      Type      1          KA-01-HH-9999        White      car       `,
+		},
+		{
+			name:      "Create parking lot with a waitlist, queue two cars, cancel one, leave and admit the other",
+			configure: func(cfg *lib.Config) { cfg.Waitlist = true },
+			input: `create_parking_lot 1
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		park KA-01-HH-8888 Blue
+		waitlist
+		cancel_waitlist KA-01-HH-9999
+		cancel_waitlist KA-01-HH-9999
+		leave 1
+		waitlist
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 1 slotsAllocated slot number: 1, ticket: T20241101090000-0001Sorry, parking lot is full, vehicle KA-01-HH-9999 is waitlisted at position: 1Sorry, parking lot is full, vehicle KA-01-HH-8888 is waitlisted at position: 2Position   Registration No      Color      Type      1          KA-01-HH-9999        Red        car       2          KA-01-HH-8888        Blue       car       Removed vehicle KA-01-HH-9999 from the waitlistSorry, vehicle KA-01-HH-9999 is not waitlistedSlot number 1 is free, parked for 0h00m, fee 20.00Allocated slot number: 1 to waitlisted vehicle KA-01-HH-8888, ticket: T20241101090000-0002Waitlist is empty`,
+		},
+		{
+			name: "Create parking lot with EV and accessible slots, park cars needing them, tag a slot",
+			input: `create_parking_lot 2 medium=1+ev small=1+accessible+ev
+		park KA-01-HH-1234 White --needs ev
+		park KA-01-HH-9999 Red motorcycle --needs accessible
+		park KA-01-HH-8888 Red --needs staff
+		park KA-01-HH-7777 Red --needs valet
+		tag_slot 2 staff
+		tag_slot 9 staff
+		park KA-01-HH-8888 Red --needs staff
+		park KA-01-HH-6666 Blue
+		park KA-01-HH-5555 Blue
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 4 slotsAllocated slot number: 3, ticket: T20241101090000-0001Allocated slot number: 4, ticket: T20241101090000-0002Sorry, no free slot with staff for a carunknown slot attribute: valetSlot number 2 is tagged staffSorry, invalid slot number: 9Allocated slot number: 2, ticket: T20241101090000-0003Allocated slot number: 1, ticket: T20241101090000-0004Sorry, parking lot is full`,
+		},
+		{
+			name:      "Create parking lot with an EV slot, untagged cars may take it as a last resort",
+			configure: func(cfg *lib.Config) { cfg.SpecialSlots = "last-resort" },
+			input: `create_parking_lot 1+ev 1
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 2, ticket: T20241101090000-0001Allocated slot number: 1, ticket: T20241101090000-0002`,
+		},
+		{
+			name: "Create parking lot with a custom tariff, park overnight and leave",
+			configure: func(cfg *lib.Config) {
+				cfg.Clock = newFakeClock(13 * time.Hour)
+				cfg.Tariff = &pricing.Tariff{
+					Night: pricing.Night{Start: "20:00", End: "08:00"},
+					Rates: map[string]pricing.Rate{pricing.DefaultRateName: {FirstHour: 3, Hourly: 2, NightHourly: 1, DailyCap: 30}},
+				}
+			},
+			input: `create_parking_lot 1
+		park KA-01-HH-1234 White
+		leave 1
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 1 slotsAllocated slot number: 1, ticket: T20241101090000-0001Slot number 1 is free, parked for 13h00m, fee 25.00`,
+		},
+		{
+			name: "Create parking lot with entry gates and park nearest to a gate",
+			input: `create_parking_lot 6 --gates testdata/gates.json
+		park KA-01-HH-1234 White --gate G2
+		park KA-01-HH-9999 White --gate G2
+		park KA-01-HH-0001 White
+		park KA-01-HH-7777 White --gate G1
+		leave 6
+		park KA-01-HH-2701 Blue --gate G1
+		park KA-01-HH-3141 Black --gate G2
+		park KA-01-HH-5555 Red --gate G9
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 6, ticket: T20241101090000-0001Allocated slot number: 5, ticket: T20241101090000-0002Allocated slot number: 1, ticket: T20241101090000-0003Allocated slot number: 2, ticket: T20241101090000-0004Slot number 6 is free, parked for 0h00m, fee 20.00Allocated slot number: 3, ticket: T20241101090000-0005Allocated slot number: 6, ticket: T20241101090000-0006Sorry, unknown gate: G9`,
+		},
+		{
+			name: "Create parking lot with gates not fitting its slots",
+			input: `create_parking_lot 4 --gates testdata/gates.json
+		exit
+		`,
+			expectedOutput: `invalid gates: invalid gate: G1 has 6 distances for 4 slots`,
+		},
+		{
+			name: "Create parking lot and park at chosen slots",
+			input: `create_parking_lot small=1 4
+		park_at 4 KA-01-HH-1234 White
+		park_at 4 KA-01-HH-9999 White
+		park_at 1 KA-01-HH-9999 White
+		park_at 9 KA-01-HH-9999 White
+		park_at 2 KA-01-HH-1234 White
+		park KA-01-HH-9999 White
+		park KA-01-HH-7777 Red
+		park KA-01-HH-2701 Blue
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 5 slotsAllocated slot number: 4, ticket: T20241101090000-0001Sorry, slot number 4 is occupiedSorry, slot number 1 is too small for a carSorry, invalid slot number: 9Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 4Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 5, ticket: T20241101090000-0004Slot No.   Registration No      Color      Type      2          KA-01-HH-9999        White      car       3          KA-01-HH-7777        Red        car       4          KA-01-HH-1234        White      car       5          KA-01-HH-2701        Blue       car       `,
+		},
+		{
+			name: "Create parking lot and park a vehicle of an unknown type",
+			input: `create_parking_lot 2
+		park KA-01-HH-1234 White tractor
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsinvalid vehicle type: tractor`,
 		},
 		{
 			name: "Create parking lot of 2 cars and try to park 3 cars, get parking lot full error",
@@ -248,7 +826,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		park KA-01-HH-8888 White
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 1Allocated slot number: 2Sorry, parking lot is full`,
+			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Sorry, parking lot is full`,
 		},
 		{
 			name: "Create parking lot of 6 cars and park 4 cars, get registration number for white color",
@@ -260,7 +838,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		registration_numbers_for_cars_with_color White
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Allocated slot number: 4KA-01-HH-1234, KA-01-HH-9999, KA-01-GG-1121`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 4, ticket: T20241101090000-0004KA-01-HH-1234, KA-01-HH-9999, KA-01-GG-1121`,
 		},
 		{
 			name: "Create parking lot of 6 cars and park 4 cars, get slot number for Red color",
@@ -272,7 +850,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		slot_numbers_for_cars_with_color Red
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Allocated slot number: 41, 3`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 4, ticket: T20241101090000-00041, 3`,
 		},
 		{
 			name: "Create parking lot of 6 cars and park 4 cars, get slot number for registration no - KA-01-HH-8888",
@@ -284,7 +862,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		slot_number_for_registration_number KA-01-HH-8888
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Allocated slot number: 43`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 4, ticket: T20241101090000-00043`,
 		},
 		{
 			name: "Create parking lot of 6 cars and park 4 cars, get slot number for invalid registration no - invalid_1111",
@@ -296,7 +874,7 @@ func TestRunInteractiveMode(t *testing.T) {
 		slot_number_for_registration_number invalid_1111
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Allocated slot number: 4Not found`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 4, ticket: T20241101090000-0004Not found`,
 		},
 		{
 			name: "Create parking lot of 6 cars and park 4 cars, leave slot 3, park 1 car, get last available slot - 3",
@@ -309,7 +887,125 @@ func TestRunInteractiveMode(t *testing.T) {
 		park KA-01-KK-4532 Blue
 		exit
 		`,
-			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1Allocated slot number: 2Allocated slot number: 3Allocated slot number: 4Slot number 3 is freeAllocated slot number: 3`,
+			expectedOutput: `Created a parking lot with 6 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 4, ticket: T20241101090000-0004Slot number 3 is free, parked for 0h00m, fee 20.00Allocated slot number: 3, ticket: T20241101090000-0005`,
+		},
+		{
+			name: "History of a vehicle across lots and of a slot",
+			input: `create_parking_lot 2
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		leave 1
+		tag_slot 1 ev
+		create_parking_lot 2 --lot north
+		park ka01hh1234 White
+		history_for_registration_number KA-01-HH-1234
+		history_for_slot 1 --lot default
+		history_for_slot 2
+		history_for_registration_number KA-01-HH-0000
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Slot number 1 is free, parked for 0h00m, fee 20.00Slot number 1 is tagged evCreated parking lot north with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0003` +
+				`Time             Lot        Event                Slot No.   Detail` +
+				`2024-11-01 09:00 default    Parked               1          T20241101090000-0001` +
+				`2024-11-01 09:00 default    Left                 1          T20241101090000-0001` +
+				`2024-11-01 09:00 north      Parked               1          T20241101090000-0003` +
+				`Time             Event                Registration No      Detail` +
+				`2024-11-01 09:00 Parked               KA-01-HH-1234        T20241101090000-0001` +
+				`2024-11-01 09:00 Left                 KA-01-HH-1234        T20241101090000-0001` +
+				`2024-11-01 09:00 SlotTagged           -                    ev` +
+				`Not foundNot found`,
+		},
+		{
+			name: "Undo and redo a leave, the vehicle gets its slot and its place among its colour back",
+			input: `create_parking_lot 4
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		park KA-01-HH-7777 White
+		park KA-01-HH-2701 White
+		leave 3
+		park KA-01-HH-3141 Blue
+		undo
+		undo
+		registration_numbers_for_cars_with_color White
+		slot_numbers_for_cars_with_color White
+		park KA-01-HH-7777 White
+		redo
+		redo
+		registration_numbers_for_cars_with_color White
+		undo
+		leave 1
+		redo
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 4 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Allocated slot number: 4, ticket: T20241101090000-0004Slot number 3 is free, parked for 0h00m, fee 20.00Allocated slot number: 3, ticket: T20241101090000-0005Undone: park KA-01-HH-3141 BlueUndone: leave 3KA-01-HH-1234, KA-01-HH-7777, KA-01-HH-27011, 3, 4Sorry, vehicle KA-01-HH-7777 is already parked at slot number: 3Redone: leave 3Redone: park KA-01-HH-3141 BlueKA-01-HH-1234, KA-01-HH-2701Undone: park KA-01-HH-3141 BlueSlot number 1 is free, parked for 0h00m, fee 20.00Nothing to redo`,
+		},
+		{
+			name: "Undo the creation of lots and a switch between them",
+			input: `undo
+		create_parking_lot 2
+		park KA-01-HH-1234 White
+		create_parking_lot 3 --lot north
+		use_lot default
+		undo
+		undo
+		status
+		use_lot north
+		undo
+		undo
+		status
+		redo
+		status
+		exit
+		`,
+			expectedOutput: `Nothing to undoCreated a parking lot with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Created parking lot north with 3 slotsUsing parking lot defaultUndone: use_lot defaultUndone: create_parking_lot 3 --lot northSlot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       Sorry, unknown parking lot: northUndone: park KA-01-HH-1234 WhiteUndone: create_parking_lot 2Please create a parking lot firstRedone: create_parking_lot 2Slot No.   Registration No      Color      Type      `,
+		},
+		{
+			name:      "Undo a waitlisted vehicle admitted on leave, a reservation and a tag, within the undo limit",
+			configure: func(cfg *lib.Config) { cfg.Waitlist, cfg.UndoLimit = true, 3 },
+			input: `create_parking_lot 2
+		park KA-01-HH-1234 White
+		reserve KA-01-HH-9999 09:10 11:00
+		park KA-01-HH-7777 Red
+		tag_slot 2 ev
+		leave 1
+		waitlist
+		undo
+		waitlist
+		undo
+		undo
+		undo
+		status
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Reserved slot number: 2 from 2024-11-01 09:10 to 2024-11-01 11:00Sorry, parking lot is full, vehicle KA-01-HH-7777 is waitlisted at position: 1Slot number 2 is tagged evSlot number 1 is free, parked for 0h00m, fee 20.00Allocated slot number: 1 to waitlisted vehicle KA-01-HH-7777, ticket: T20241101090000-0002Waitlist is emptyUndone: leave 1Position   Registration No      Color      Type      1          KA-01-HH-7777        Red        car       Undone: tag_slot 2 evUndone: park KA-01-HH-7777 RedNothing to undoSlot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       2          KA-01-HH-9999        reserved   car       `,
+		},
+		{
+			name: "Transaction refuses undo and a nested begin, exit rolls an open transaction back",
+			input: `begin
+		create_parking_lot 2
+		park KA-01-HH-1234 White
+		commit
+		begin
+		park KA-01-HH-9999 Red
+		undo
+		begin
+		commit
+		status
+		begin
+		park KA-01-HH-9999 Red
+		exit
+		`,
+			expectedOutput: `Began a transactionCreated a parking lot with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Committed 2 changesBegan a transactionAllocated slot number: 2, ticket: T20241101090000-0002Sorry, cannot undo within a transactionSorry, a transaction is open alreadySorry, undo failed, rolled back 1 changeSlot No.   Registration No      Color      Type      1          KA-01-HH-1234        White      car       Began a transactionAllocated slot number: 2, ticket: T20241101090000-0003Rolled back 1 change`,
+		},
+		{
+			name:      "Undo turned off",
+			configure: func(cfg *lib.Config) { cfg.UndoLimit = 0 },
+			input: `create_parking_lot 2
+		park KA-01-HH-1234 White
+		undo
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsAllocated slot number: 1, ticket: T20241101090000-0001Nothing to undo`,
 		},
 		{
 			name: "Create parking lot of 3 cars, try to park 1 car with only 0 argument provided",
@@ -331,6 +1027,8 @@ func TestRunInteractiveMode(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
 			// Prepare the context
 			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
 			defer cancel()
@@ -339,8 +1037,14 @@ func TestRunInteractiveMode(t *testing.T) {
 			input := strings.NewReader(tt.input)
 			var output bytes.Buffer
 
+			cfg := lib.DefaultConfig()
+			cfg.Clock = newFakeClock(0)
+			if tt.configure != nil {
+				tt.configure(&cfg)
+			}
+
 			// Call the function
-			runInteractiveMode(ctx, input, &output)
+			runInteractiveMode(ctx, lib.NewLotService(cfg), input, &output)
 
 			actual := strings.ReplaceAll(output.String(), "\n", "")
 
@@ -350,3 +1054,356 @@ func TestRunInteractiveMode(t *testing.T) {
 		})
 	}
 }
+
+func TestSnapshotAcrossSessions(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	tests := []struct {
+		name           string
+		input          string
+		expectedOutput string
+	}{
+		{
+			name: "Save the lot",
+			input: `create_parking_lot 3
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		park KA-01-BB-0001 White
+		leave 2
+		save_snapshot ` + stateFile + `
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 3 slotsAllocated slot number: 1, ticket: T20241101090000-0001Allocated slot number: 2, ticket: T20241101090000-0002Allocated slot number: 3, ticket: T20241101090000-0003Slot number 2 is free, parked for 0h00m, fee 20.00Saved snapshot to state.json`,
+		},
+		{
+			name: "Load the lot in a new session",
+			input: `load_snapshot ` + stateFile + `
+		registration_numbers_for_cars_with_color White
+		park KA-01-HH-7777 Blue
+		park KA-01-HH-1234 White
+		park KA-01-HH-2701 Black
+		exit
+		`,
+			expectedOutput: `Loaded snapshot from state.jsonKA-01-HH-1234, KA-01-BB-0001Allocated slot number: 2, ticket: T20241101090000-0004Sorry, vehicle KA-01-HH-1234 is already parked at slot number: 1Sorry, parking lot is full`,
+		},
+		{
+			name: "Load refused while a transaction is open",
+			input: `create_parking_lot 2
+		begin
+		load_snapshot ` + stateFile + `
+		rollback
+		park KA-01-HH-5555 Green
+		exit
+		`,
+			expectedOutput: `Created a parking lot with 2 slotsBegan a transactionSorry, failed to load snapshot: a transaction is openRolled back 0 changesAllocated slot number: 1, ticket: T20241101090000-0001`,
+		},
+		{
+			name: "Load a missing snapshot",
+			input: `load_snapshot ` + stateFile + `.missing
+		exit
+		`,
+			expectedOutput: `Sorry, failed to load snapshot: open state.json.missing: no such file or directory`,
+		},
+	}
+
+	// in order, every session starts from the file the previous one saved
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Second)
+			defer cancel()
+
+			var output bytes.Buffer
+			cfg := lib.DefaultConfig()
+			cfg.Clock = newFakeClock(0)
+			runInteractiveMode(ctx, lib.NewLotService(cfg), strings.NewReader(tt.input), &output)
+
+			actual := strings.ReplaceAll(strings.ReplaceAll(output.String(), "\n", ""), stateFile, "state.json")
+			if actual != tt.expectedOutput {
+				t.Errorf("output did not match expected. Got:\n%s\nExpected:\n%s", actual, tt.expectedOutput)
+			}
+		})
+	}
+}
+
+func TestJournalRecovery(t *testing.T) {
+	dir := t.TempDir()
+	newConfig := func() lib.Config {
+		cfg := lib.DefaultConfig()
+		cfg.Clock = newFakeClock(10 * time.Minute)
+		cfg.StateFile = filepath.Join(dir, "state.json")
+		cfg.JournalFile = filepath.Join(dir, "journal")
+		cfg.CompactEvery = 3
+		return cfg
+	}
+	run := func(lotService *lib.LotService, input string) string {
+		var output bytes.Buffer
+		runInteractiveMode(context.Background(), lotService, strings.NewReader(input+"\nexit\n"), &output)
+		return strings.ReplaceAll(output.String(), "\n", "")
+	}
+
+	// compacted after the first 3 commands, the session crashes with the last 2 in the journal only
+	lotService, err := startLotService(context.Background(), newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(lotService, `create_parking_lot 4 --strategy random
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		leave_by_registration_number KA-01-HH-9999
+		park KA-01-HH-7777 Blue`)
+	expectedStatus := run(lotService, "status")
+	lotService.Close()
+
+	// a crash while appending a record
+	journal, err := os.OpenFile(newConfig().JournalFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := journal.Seek(0, 2)
+	journal.Write([]byte{0, 0, 0, 64, 1, 2, 3, 4, '{', '"'})
+	journal.Close()
+
+	lotService, err = startLotService(context.Background(), newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lotService.Close()
+	if info, _ := os.Stat(newConfig().JournalFile); info.Size() != before {
+		t.Fatalf("expected the torn record to be cut off the journal, %d bytes instead of %d", info.Size(), before)
+	}
+	if status := run(lotService, "status"); status != expectedStatus {
+		t.Fatalf("status did not match after recovery. Got:\n%s\nExpected:\n%s", status, expectedStatus)
+	}
+	if output := run(lotService, "park KA-01-HH-2701 Black"); !strings.HasSuffix(output, "ticket: T20241101094000-0002") {
+		t.Fatalf("expected the tickets to go on after recovery, got %s", output)
+	}
+}
+
+func TestJournalCorruption(t *testing.T) {
+	dir := t.TempDir()
+	cfg := lib.DefaultConfig()
+	cfg.StateFile = filepath.Join(dir, "state.json")
+	cfg.JournalFile = filepath.Join(dir, "journal")
+
+	lotService, err := startLotService(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	runInteractiveMode(context.Background(), lotService, strings.NewReader("create_parking_lot 4\npark KA-01-HH-1234 White\nexit\n"), &output)
+	lotService.Close()
+
+	content, err := os.ReadFile(cfg.JournalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a damaged record followed by a good one is no torn append, whatever part of it is damaged
+	tests := []struct {
+		name   string
+		damage func(content []byte)
+	}{
+		{"payload", func(content []byte) { content[10] ^= 0xff }},
+		{"length running past the end of the file", func(content []byte) { binary.BigEndian.PutUint32(content[0:4], uint32(len(content))) }},
+		{"length ending within the next record", func(content []byte) { content[3]++ }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := slices.Clone(content)
+			tt.damage(damaged)
+			if err := os.WriteFile(cfg.JournalFile, damaged, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := startLotService(context.Background(), cfg); !errors.Is(err, lib.ErrCorruptJournal) {
+				t.Fatalf("expected %v, got %v", lib.ErrCorruptJournal, err)
+			}
+			if kept, _ := os.ReadFile(cfg.JournalFile); !bytes.Equal(kept, damaged) {
+				t.Errorf("expected the journal to be left as it is, %d of %d bytes kept", len(kept), len(damaged))
+			}
+		})
+	}
+}
+
+func TestEventLogAcrossSessions(t *testing.T) {
+	dir := t.TempDir()
+	newConfig := func() lib.Config {
+		cfg := lib.DefaultConfig()
+		cfg.Clock = newFakeClock(10 * time.Minute)
+		cfg.EventLogFile = filepath.Join(dir, "events")
+		return cfg
+	}
+	run := func(lotService *lib.LotService, input string) string {
+		var output bytes.Buffer
+		runInteractiveMode(context.Background(), lotService, strings.NewReader(input+"\nexit\n"), &output)
+		return strings.ReplaceAll(output.String(), "\n", "")
+	}
+
+	lotService, err := startLotService(context.Background(), newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(lotService, `create_parking_lot 4 --strategy random --seed 7
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		create_parking_lot 2 --lot north
+		park KA-01-HH-7777 Blue --lot north
+		leave_by_registration_number KA-01-HH-9999
+		tag_slot 2 ev --lot north
+		use_lot default`)
+	expectedStatus := run(lotService, "status\nstatus --lot north")
+	expectedHistory := run(lotService, "history_for_registration_number KA-01-HH-9999")
+	lotService.Close()
+
+	// a crash while appending an event
+	events, err := os.OpenFile(newConfig().EventLogFile, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := events.Seek(0, 2)
+	events.Write([]byte(`{"seq":12,"type":"Par`))
+	events.Close()
+
+	lotService, err = startLotService(context.Background(), newConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lotService.Close()
+	if info, _ := os.Stat(newConfig().EventLogFile); info.Size() != before {
+		t.Fatalf("expected the torn event to be cut off the event log, %d bytes instead of %d", info.Size(), before)
+	}
+	if status := run(lotService, "status\nstatus --lot north"); status != expectedStatus {
+		t.Fatalf("status did not match after a restart. Got:\n%s\nExpected:\n%s", status, expectedStatus)
+	}
+	if history := run(lotService, "history_for_registration_number KA-01-HH-9999"); history != expectedHistory {
+		t.Fatalf("history did not match after a restart. Got:\n%s\nExpected:\n%s", history, expectedHistory)
+	}
+	if output := run(lotService, "park KA-01-HH-2701 Black"); !strings.HasSuffix(output, "ticket: T20241101092000-0002") {
+		t.Fatalf("expected the tickets to go on after a restart, got %s", output)
+	}
+}
+
+func TestEventLogCorruption(t *testing.T) {
+	cfg := lib.DefaultConfig()
+	cfg.EventLogFile = filepath.Join(t.TempDir(), "events")
+
+	lotService, err := startLotService(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	runInteractiveMode(context.Background(), lotService, strings.NewReader("create_parking_lot 4\npark KA-01-HH-1234 White\nexit\n"), &output)
+	lotService.Close()
+
+	// a damaged event followed by a complete one is no torn append
+	content, err := os.ReadFile(cfg.EventLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content[0] = '['
+	if err := os.WriteFile(cfg.EventLogFile, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := startLotService(context.Background(), cfg); !errors.Is(err, lib.ErrCorruptEventLog) {
+		t.Fatalf("expected %v, got %v", lib.ErrCorruptEventLog, err)
+	}
+}
+
+func TestUndoAcrossSessions(t *testing.T) {
+	dir := t.TempDir()
+	run := func(lotService *lib.LotService, input string) string {
+		var output bytes.Buffer
+		runInteractiveMode(context.Background(), lotService, strings.NewReader(input+"\nexit\n"), &output)
+		return strings.ReplaceAll(output.String(), "\n", "")
+	}
+	commands := `create_parking_lot 4 --strategy random --seed 7
+		park KA-01-HH-1234 White
+		park KA-01-HH-9999 Red
+		park KA-01-HH-7777 White
+		leave_by_registration_number KA-01-HH-1234
+		undo
+		create_parking_lot 2 --lot north
+		park KA-01-HH-2701 Blue --lot north
+		undo
+		undo
+		redo
+		use_lot default`
+	for _, configure := range []func(cfg *lib.Config){
+		func(cfg *lib.Config) {
+			cfg.StateFile, cfg.JournalFile = filepath.Join(dir, "state.json"), filepath.Join(dir, "journal")
+		},
+		func(cfg *lib.Config) { cfg.EventLogFile = filepath.Join(dir, "events") },
+	} {
+		newConfig := func() lib.Config {
+			cfg := lib.DefaultConfig()
+			cfg.Clock = newFakeClock(10 * time.Minute)
+			configure(&cfg)
+			return cfg
+		}
+		lotService, err := startLotService(context.Background(), newConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		run(lotService, commands)
+		expectedStatus := run(lotService, "status\nstatus --lot north\nregistration_numbers_for_cars_with_color White")
+		lotService.Close()
+
+		// the undone changes stay undone after a restart
+		lotService, err = startLotService(context.Background(), newConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := run(lotService, "status\nstatus --lot north\nregistration_numbers_for_cars_with_color White"); status != expectedStatus {
+			t.Fatalf("status did not match after a restart. Got:\n%s\nExpected:\n%s", status, expectedStatus)
+		}
+		lotService.Close()
+	}
+}
+
+func TestTransactionInterruptedByACrash(t *testing.T) {
+	dir := t.TempDir()
+	run := func(lotService *lib.LotService, input string) string {
+		var output bytes.Buffer
+		runInteractiveMode(context.Background(), lotService, strings.NewReader(input+"\nexit\n"), &output)
+		return strings.ReplaceAll(output.String(), "\n", "")
+	}
+	for _, configure := range []func(cfg *lib.Config){
+		func(cfg *lib.Config) {
+			cfg.StateFile, cfg.JournalFile = filepath.Join(dir, "state.json"), filepath.Join(dir, "journal")
+			cfg.CompactEvery = 2
+		},
+		func(cfg *lib.Config) { cfg.EventLogFile = filepath.Join(dir, "events") },
+	} {
+		newConfig := func() lib.Config {
+			cfg := lib.DefaultConfig()
+			cfg.Clock = newFakeClock(10 * time.Minute)
+			configure(&cfg)
+			return cfg
+		}
+		lotService, err := startLotService(context.Background(), newConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		run(lotService, "create_parking_lot 3\npark KA-01-HH-1234 White")
+		expectedStatus := run(lotService, "status")
+
+		// the session is gone before the commit, without rolling back
+		var output bytes.Buffer
+		cmdBuilder := lib.NewCommandBuilder(ModeInteractive, bufio.NewWriter(&output), lotService)
+		for _, line := range []string{"begin", "park KA-01-HH-9999 Red", "leave 1", "park KA-01-HH-7777 Blue"} {
+			commandName, args := tokenize(line)
+			cmdBuilder.ParseCommand(commandName, args...).Execute(context.Background())
+		}
+		lotService.Close()
+
+		lotService, err = startLotService(context.Background(), newConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status := run(lotService, "status"); status != expectedStatus {
+			t.Fatalf("expected the transaction to be rolled back. Got:\n%s\nExpected:\n%s", status, expectedStatus)
+		}
+		if output := run(lotService, "begin\npark KA-01-HH-9999 Red\ncommit"); !strings.HasSuffix(output, "Committed 1 change") {
+			t.Fatalf("expected a new transaction to be committed, got %s", output)
+		}
+		lotService.Close()
+	}
+}